@@ -0,0 +1,311 @@
+// Package access allows or denies sign-ins, signups and sessions by the
+// country and IP address they come from, for everyone or for given roles,
+// e.g. to keep out sanctioned countries or hold admins to corporate ranges.
+package access
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/otyang/go-authsvc/audit"
+	"github.com/otyang/go-authsvc/geoip"
+	"github.com/otyang/go-authsvc/session"
+)
+
+// Flow is where a request is checked.
+type Flow string
+
+const (
+	FlowSignIn       Flow = "signin"
+	FlowSignUp       Flow = "signup"
+	FlowAuthenticate Flow = "authenticate"
+)
+
+var ErrDenied = errors.New("access denied from this location")
+
+// DeniedError says which rule refused a request and why. It matches
+// ErrDenied with errors.Is.
+type DeniedError struct {
+	Rule    string
+	Reason  string
+	IP      string
+	Country string
+}
+
+func (e *DeniedError) Error() string {
+	return ErrDenied.Error() + ": " + e.Reason
+}
+
+func (e *DeniedError) Is(target error) bool {
+	return target == ErrDenied
+}
+
+// Rule allows or denies countries, as ISO 3166-1 alpha-2 codes, and IP
+// ranges, as CIDRs or single addresses.
+//
+// A request matching a deny list is denied. When the rule has allow lists,
+// a request must also match one of them: its country or its IP. A request
+// whose country or IP is unknown matches no list, so it passes deny lists
+// unless DenyUnknown is set.
+type Rule struct {
+	Name string
+	// Roles limits the rule to users with one of these roles; empty applies
+	// to everyone, including visitors signing up.
+	Roles []string
+
+	AllowCountries []string
+	DenyCountries  []string
+	AllowCIDRs     []string
+	DenyCIDRs      []string
+
+	// DenyUnknown denies requests whose country cannot be told, as a
+	// sanctions rule should.
+	DenyUnknown bool
+}
+
+type compiledRule struct {
+	name          string
+	roles         map[string]bool
+	allowCountry  map[string]bool
+	denyCountry   map[string]bool
+	allowNets     []*net.IPNet
+	denyNets      []*net.IPNet
+	hasAllowLists bool
+	denyUnknown   bool
+}
+
+// Request is what a Policy checks.
+type Request struct {
+	Flow      Flow
+	UserID    string
+	SessionID string
+	// Email identifies visitors signing up, who have no UserID yet.
+	Email string
+	// Role is the user's role; empty only global rules apply to.
+	Role string
+	IP   string
+	// Country is the client's claim; with a Locator it is ignored.
+	Country string
+}
+
+// Locator finds the country of an IP address; *geoip.DB implements it.
+type Locator interface {
+	Lookup(ip net.IP) (geoip.Location, error)
+}
+
+type Policy struct {
+	rules    []compiledRule
+	auditLog audit.Logger
+	locator  Locator
+}
+
+type Option func(*Policy)
+
+// WithAuditLogger records every denial as audit.ActionAccessDenied.
+func WithAuditLogger(l audit.Logger) Option {
+	return func(p *Policy) { p.auditLog = l }
+}
+
+// WithLocator takes the country from the IP address instead of trusting
+// Request.Country, which comes from the client. An IP that l cannot place
+// has an unknown country.
+func WithLocator(l Locator) Option {
+	return func(p *Policy) { p.locator = l }
+}
+
+// New compiles the rules, returning an error on the first malformed CIDR.
+func New(rules []Rule, opts ...Option) (*Policy, error) {
+	p := &Policy{}
+
+	for i, r := range rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+
+		c := compiledRule{
+			name:          r.Name,
+			roles:         set(r.Roles, false),
+			allowCountry:  set(r.AllowCountries, true),
+			denyCountry:   set(r.DenyCountries, true),
+			hasAllowLists: len(r.AllowCountries) > 0 || len(r.AllowCIDRs) > 0,
+			denyUnknown:   r.DenyUnknown,
+		}
+
+		var err error
+		if c.allowNets, err = parseNets(r.AllowCIDRs); err != nil {
+			return nil, fmt.Errorf("access: %s: %w", r.Name, err)
+		}
+		if c.denyNets, err = parseNets(r.DenyCIDRs); err != nil {
+			return nil, fmt.Errorf("access: %s: %w", r.Name, err)
+		}
+
+		p.rules = append(p.rules, c)
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p, nil
+}
+
+func set(items []string, upper bool) map[string]bool {
+	m := make(map[string]bool, len(items))
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if upper {
+			item = strings.ToUpper(item)
+		}
+		m[item] = true
+	}
+	return m
+}
+
+func parseNets(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if !strings.Contains(e, "/") {
+			ip := net.ParseIP(e)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", e)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			e = fmt.Sprintf("%s/%d", ip, bits)
+		}
+
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+// Check returns a *DeniedError, after recording it, when a rule refuses r.
+// A nil Policy allows everything.
+func (p *Policy) Check(ctx context.Context, r Request) error {
+	if p == nil {
+		return nil
+	}
+
+	ip := net.ParseIP(r.IP)
+	country := p.country(r.Country, ip)
+
+	for _, rule := range p.rules {
+		reason := rule.deny(r.Role, country, ip)
+		if reason == "" {
+			continue
+		}
+
+		err := &DeniedError{Rule: rule.name, Reason: reason, IP: r.IP, Country: country}
+		if auditErr := p.record(ctx, r, err); auditErr != nil {
+			return auditErr
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (p *Policy) country(claimed string, ip net.IP) string {
+	if p.locator == nil {
+		return strings.ToUpper(strings.TrimSpace(claimed))
+	}
+	if ip == nil {
+		return ""
+	}
+
+	loc, err := p.locator.Lookup(ip)
+	if err != nil {
+		return ""
+	}
+	return strings.ToUpper(loc.Country)
+}
+
+// deny returns why the rule refuses the request, or "".
+func (r compiledRule) deny(role, country string, ip net.IP) string {
+	if len(r.roles) > 0 && !r.roles[role] {
+		return ""
+	}
+
+	if country == "" && r.denyUnknown {
+		return "location unknown"
+	}
+	if country != "" && r.denyCountry[country] {
+		return fmt.Sprintf("country %s is denied", country)
+	}
+	if contains(r.denyNets, ip) {
+		return fmt.Sprintf("IP address %s is in a denied range", ip)
+	}
+
+	if !r.hasAllowLists {
+		return ""
+	}
+	if (country != "" && r.allowCountry[country]) || contains(r.allowNets, ip) {
+		return ""
+	}
+
+	if len(r.roles) > 0 {
+		return fmt.Sprintf("role %s may not sign in from outside its allowed locations", role)
+	}
+	return "not in an allowed location"
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) record(ctx context.Context, r Request, denied *DeniedError) error {
+	data := map[string]any{
+		"flow":    string(r.Flow),
+		"rule":    denied.Rule,
+		"ip":      r.IP,
+		"country": denied.Country,
+	}
+	if r.Role != "" {
+		data["role"] = r.Role
+	}
+	if r.Email != "" {
+		data["email"] = r.Email
+	}
+
+	return audit.Log(ctx, p.auditLog, audit.Event{
+		Action:    audit.ActionAccessDenied,
+		ActorID:   r.UserID,
+		UserID:    r.UserID,
+		SessionID: r.SessionID,
+		Reason:    denied.Reason,
+		Data:      data,
+	})
+}
+
+// CheckSession implements session.SessionChecker, so Authenticate refuses
+// sessions used from a denied location.
+func (p *Policy) CheckSession(ctx context.Context, info session.SessionInfo) error {
+	return p.Check(ctx, Request{
+		Flow:      FlowAuthenticate,
+		UserID:    info.UserID,
+		SessionID: info.SessionID,
+		Role:      info.Role,
+		IP:        info.Claims.DeviceIPAddress,
+		Country:   info.Claims.IPAddressCountry,
+	})
+}
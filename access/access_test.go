@@ -0,0 +1,146 @@
+package access
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/otyang/go-authsvc/audit"
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/geoip"
+	"github.com/otyang/go-authsvc/session"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	p, err := New([]Rule{
+		{Name: "sanctions", DenyCountries: []string{"ir", "KP"}},
+		{Name: "abuse", DenyCIDRs: []string{"198.51.100.0/24"}},
+		{Name: "admins on vpn", Roles: []string{"admin"}, AllowCIDRs: []string{"10.0.0.0/8", "203.0.113.7"}},
+		{Name: "support in EU", Roles: []string{"support"}, AllowCountries: []string{"DE", "FR"}, AllowCIDRs: []string{"10.0.0.0/8"}},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		req      Request
+		wantRule string
+	}{
+		{"allowed", Request{IP: "81.2.69.142", Country: "GB"}, ""},
+		{"sanctioned country", Request{IP: "5.160.0.1", Country: "IR"}, "sanctions"},
+		{"country code case", Request{Country: "kp"}, "sanctions"},
+		{"denied range", Request{IP: "198.51.100.9", Country: "GB"}, "abuse"},
+		{"unknown location passes deny lists", Request{}, ""},
+		{"admin on corporate range", Request{Role: "admin", IP: "10.1.2.3", Country: "GB"}, ""},
+		{"admin on listed address", Request{Role: "admin", IP: "203.0.113.7"}, ""},
+		{"admin elsewhere", Request{Role: "admin", IP: "81.2.69.142", Country: "GB"}, "admins on vpn"},
+		{"admin unknown location", Request{Role: "admin"}, "admins on vpn"},
+		{"role rules skip others", Request{Role: "customer", IP: "81.2.69.142"}, ""},
+		{"support by country", Request{Role: "support", IP: "81.2.69.142", Country: "DE"}, ""},
+		{"support by range", Request{Role: "support", IP: "10.9.9.9", Country: "NG"}, ""},
+		{"support elsewhere", Request{Role: "support", IP: "81.2.69.142", Country: "GB"}, "support in EU"},
+		{"global rules bind every role", Request{Role: "admin", IP: "10.1.2.3", Country: "IR"}, "sanctions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Check(context.TODO(), tt.req)
+			if tt.wantRule == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, ErrDenied)
+			var denied *DeniedError
+			if assert.ErrorAs(t, err, &denied) {
+				assert.Equal(t, tt.wantRule, denied.Rule)
+			}
+		})
+	}
+}
+
+type locatorFunc func(ip net.IP) (geoip.Location, error)
+
+func (f locatorFunc) Lookup(ip net.IP) (geoip.Location, error) { return f(ip) }
+
+func TestPolicy_UnknownCountry(t *testing.T) {
+	rules := []Rule{{Name: "sanctions", DenyCountries: []string{"IR"}, DenyUnknown: true}}
+
+	p, _ := New(rules)
+	assert.NoError(t, p.Check(context.TODO(), Request{IP: "81.2.69.142", Country: "GB"}))
+	assert.ErrorIs(t, p.Check(context.TODO(), Request{IP: "5.160.0.1"}), ErrDenied, "a blank country is denied")
+
+	lenient, _ := New([]Rule{{Name: "sanctions", DenyCountries: []string{"IR"}}})
+	assert.NoError(t, lenient.Check(context.TODO(), Request{IP: "5.160.0.1"}), "without DenyUnknown a blank country passes")
+
+	places := map[string]string{"5.160.0.1": "ir", "81.2.69.142": "GB"}
+	located, _ := New(rules, WithLocator(locatorFunc(func(ip net.IP) (geoip.Location, error) {
+		c, ok := places[ip.String()]
+		if !ok {
+			return geoip.Location{}, errors.New("not found")
+		}
+		return geoip.Location{Country: c}, nil
+	})))
+
+	err := located.Check(context.TODO(), Request{IP: "5.160.0.1", Country: "GB"})
+	var denied *DeniedError
+	if assert.ErrorAs(t, err, &denied, "a forged country is ignored") {
+		assert.Equal(t, "IR", denied.Country)
+	}
+	assert.NoError(t, located.Check(context.TODO(), Request{IP: "81.2.69.142"}))
+	assert.ErrorIs(t, located.Check(context.TODO(), Request{IP: "192.0.2.1", Country: "GB"}), ErrDenied, "an unplaceable IP is unknown")
+	assert.ErrorIs(t, located.Check(context.TODO(), Request{Country: "GB"}), ErrDenied, "no IP is unknown")
+}
+
+func TestNew_invalid(t *testing.T) {
+	_, err := New([]Rule{{Name: "bad", DenyCIDRs: []string{"10.0.0.0/33"}}})
+	assert.ErrorContains(t, err, "bad")
+
+	_, err = New([]Rule{{AllowCIDRs: []string{"not-an-ip"}}})
+	assert.ErrorContains(t, err, "rule 1")
+}
+
+func TestPolicy_audit(t *testing.T) {
+	log := audit.NewMemoryStore()
+	p, _ := New([]Rule{{Name: "sanctions", DenyCountries: []string{"IR"}}}, WithAuditLogger(log))
+
+	assert.NoError(t, p.Check(context.TODO(), Request{Flow: FlowSignUp, Email: "ada@example.com", Country: "GB"}))
+	assert.Empty(t, log.Events(), "only denials are recorded")
+
+	err := p.Check(context.TODO(), Request{Flow: FlowSignUp, Email: "ada@example.com", IP: "5.160.0.1", Country: "IR"})
+	assert.ErrorIs(t, err, ErrDenied)
+
+	events := log.Events()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, audit.ActionAccessDenied, events[0].Action)
+		assert.Equal(t, "country IR is denied", events[0].Reason)
+		assert.Equal(t, "signup", events[0].Data["flow"])
+		assert.Equal(t, "ada@example.com", events[0].Data["email"])
+	}
+}
+
+func TestPolicy_CheckSession(t *testing.T) {
+	log := audit.NewMemoryStore()
+	p, _ := New([]Rule{{Name: "admins on vpn", Roles: []string{"admin"}, AllowCIDRs: []string{"10.0.0.0/8"}}}, WithAuditLogger(log))
+
+	info := session.SessionInfo{
+		UserID:    "user-1",
+		SessionID: "s1",
+		Role:      "admin",
+		Claims:    dto.SessionClaims{DeviceIPAddress: "81.2.69.142", IPAddressCountry: "GB"},
+	}
+	assert.ErrorIs(t, p.CheckSession(context.TODO(), info), ErrDenied)
+
+	info.Claims.DeviceIPAddress = "10.0.0.5"
+	assert.NoError(t, p.CheckSession(context.TODO(), info))
+
+	if events := log.Events(); assert.Len(t, events, 1) {
+		assert.Equal(t, "s1", events[0].SessionID)
+		assert.Equal(t, "authenticate", events[0].Data["flow"])
+		assert.Equal(t, "admin", events[0].Data["role"])
+	}
+
+	var none *Policy
+	assert.NoError(t, none.Check(context.TODO(), Request{Country: "IR"}))
+}
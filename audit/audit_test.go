@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLog(t *testing.T) {
+	store := NewMemoryStore()
+
+	assert.NoError(t, Log(context.TODO(), store, Event{Action: ActionImpersonationStart, ActorID: "admin", UserID: "u1"}))
+	assert.NoError(t, Log(context.TODO(), store, Event{Action: ActionImpersonationEnd, ActorID: "admin", UserID: "u2"}))
+	assert.NoError(t, Log(context.TODO(), nil, Event{Action: "dropped"}))
+
+	events, err := store.ForUser(context.TODO(), "u1")
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.False(t, events[0].Time.IsZero())
+
+	events, err = store.ForUser(context.TODO(), "admin")
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+}
+
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+
+	assert.NoError(t, Log(context.TODO(), NewJSONLogger(&buf), Event{Action: ActionImpersonationStart, UserID: "u1", Reason: "ticket 42"}))
+
+	var got Event
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "u1", got.UserID)
+	assert.Equal(t, "ticket 42", got.Reason)
+}
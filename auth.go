@@ -1,10 +1,23 @@
 package auth
 
 import (
+	"context"
 	"log"
+	"time"
 
+	"github.com/otyang/go-authsvc/access"
+	"github.com/otyang/go-authsvc/audit"
 	"github.com/otyang/go-authsvc/custom"
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/hook"
+	"github.com/otyang/go-authsvc/idgen"
+	"github.com/otyang/go-authsvc/inbox"
+	"github.com/otyang/go-authsvc/migrate"
+	"github.com/otyang/go-authsvc/notify"
+	"github.com/otyang/go-authsvc/rbac"
+	"github.com/otyang/go-authsvc/risk"
 	"github.com/otyang/go-authsvc/session"
+	"github.com/otyang/go-authsvc/signinalert"
 	"github.com/otyang/go-authsvc/user"
 
 	"github.com/stytchauth/stytch-go/v11/stytch/consumer/stytchapi"
@@ -14,19 +27,262 @@ type Auth struct {
 	Custom       *custom.CustomService
 	User         *user.UserService
 	Session      *session.SessionService
+	Hooks        *hook.Hooks
+	Notifier     *notify.Router
+	Inbox        *inbox.Inbox
+	SignInAlerts *signinalert.Alerter
+	Risk         *risk.Monitor
+	Access       *access.Policy
+	// Migrations is the registry given to WithMigrations, if any
+	Migrations   *migrate.Registry
 	StytchClient *stytchapi.API
 }
 
-func New(stytchProjectID string, stytchSecret string) (*Auth, error) {
+type options struct {
+	idGenerator   idgen.Generator
+	hooks         *hook.Hooks
+	roles         *rbac.Registry
+	auditLog      audit.Logger
+	deletionGrace time.Duration
+	migrations    *migrate.Registry
+	userLocks     bool
+	inboxStore    inbox.Store
+	pushTokens    session.PushTokenStore
+	enrichers     []session.ClaimsEnricher
+	knownDevices  signinalert.Store
+	revokeLinks   *signinalert.RevokeLinks
+	riskMonitor   bool
+	riskOpts      []risk.MonitorOption
+	signInRisk    risk.Scorer
+	signInRules   []risk.Rule
+	attempts      risk.AttemptStore
+	accessRules   []access.Rule
+}
+
+type Option func(*options)
+
+// WithIDGenerator overrides how SystemUserIDs are generated for new users.
+func WithIDGenerator(gen idgen.Generator) Option {
+	return func(o *options) { o.idGenerator = gen }
+}
+
+// WithHooks shares an existing event registry instead of creating one.
+func WithHooks(h *hook.Hooks) Option {
+	return func(o *options) { o.hooks = h }
+}
+
+// WithRoles replaces rbac.Default in the role validation and role-admin
+// checks of profile updates.
+func WithRoles(reg *rbac.Registry) Option {
+	return func(o *options) { o.roles = reg }
+}
+
+// WithAuditLogger sets where security sensitive actions are recorded.
+func WithAuditLogger(l audit.Logger) Option {
+	return func(o *options) { o.auditLog = l }
+}
+
+// WithDeletionGracePeriod schedules account deletions d in the future,
+// leaving time to cancel them.
+func WithDeletionGracePeriod(d time.Duration) Option {
+	return func(o *options) { o.deletionGrace = d }
+}
+
+// WithMigrations upgrades stored trusted metadata to the registry's latest
+// schema version as users are read, and stamps new users with it.
+func WithMigrations(r *migrate.Registry) Option {
+	return func(o *options) { o.migrations = r }
+}
+
+// WithUserLocks serialises profile updates to the same user within this
+// process, on top of the revision check every update makes.
+func WithUserLocks() Option {
+	return func(o *options) { o.userLocks = true }
+}
+
+// WithInbox keeps in-app notifications in store. Auth.Inbox is then set,
+// receives the in-app channel of Notifier and records security events.
+func WithInbox(store inbox.Store) Option {
+	return func(o *options) { o.inboxStore = store }
+}
+
+// WithPushTokens keeps device push tokens in store, tied to the session
+// that registered them.
+func WithPushTokens(store session.PushTokenStore) Option {
+	return func(o *options) { o.pushTokens = store }
+}
+
+// WithClaimsEnrichers fills in session claims, such as the location from a
+// geoip.DB or the device from a useragent.Parser, for every session SignIn
+// or Impersonate creates.
+func WithClaimsEnrichers(e ...session.ClaimsEnricher) Option {
+	return func(o *options) { o.enrichers = append(o.enrichers, e...) }
+}
+
+// WithSignInAlerts remembers the devices users sign in from in store and
+// notifies them of sign-ins from new ones. links, which may be nil, adds a
+// "this wasn't me" link served by Auth.SignInAlerts.Handler.
+func WithSignInAlerts(store signinalert.Store, links *signinalert.RevokeLinks) Option {
+	return func(o *options) { o.knownDevices, o.revokeLinks = store, links }
+}
+
+// WithRiskMonitor assesses every session Authenticate verifies for
+// impossible travel, IP bursts and TOR or datacenter networks, and alerts,
+// asks for step-up or revokes as the risk.Rules say. opts adjust the
+// detectors and rules.
+func WithRiskMonitor(opts ...risk.MonitorOption) Option {
+	return func(o *options) { o.riskMonitor, o.riskOpts = true, opts }
+}
+
+// WithSignInRisk scores sign-ins with scorer and lets them through, asks
+// for a TOTP or email code, or blocks them, as rules say; see
+// custom.WithSignInRisk. For risk.NewDevice, use a signinalert.Alerter over
+// the store given to WithSignInAlerts as its History.
+func WithSignInRisk(scorer risk.Scorer, rules ...risk.Rule) Option {
+	return func(o *options) { o.signInRisk, o.signInRules = scorer, rules }
+}
+
+// WithSignInAttempts records failed sign-ins in store for
+// risk.FailedAttempts, and wrong transaction PINs for CustomService.VerifyPin.
+func WithSignInAttempts(store risk.AttemptStore) Option {
+	return func(o *options) { o.attempts = store }
+}
+
+// WithAccessRules refuses sign-ins, signups and sessions from the countries
+// and IP ranges the rules deny, recording each refusal in the audit log.
+// Countries come from a geoip.DB passed to WithClaimsEnrichers when there
+// is one, and otherwise from the client's claims.
+func WithAccessRules(rules ...access.Rule) Option {
+	return func(o *options) { o.accessRules = append(o.accessRules, rules...) }
+}
+
+func New(stytchProjectID string, stytchSecret string, opts ...Option) (*Auth, error) {
 	client, err := stytchapi.NewClient(stytchProjectID, stytchSecret)
 	if err != nil {
 		log.Fatalf("error instantiating API client %s", err)
 	}
 
+	o := options{
+		idGenerator: idgen.Default,
+		hooks:       hook.New(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	userOpts := []user.Option{
+		user.WithRoles(o.roles),
+		user.WithHooks(o.hooks),
+		user.WithAuditLogger(o.auditLog),
+		user.WithDeletionGracePeriod(o.deletionGrace),
+		user.WithMigrations(o.migrations),
+	}
+	if o.userLocks {
+		userOpts = append(userOpts, user.WithUserLocks())
+	}
+
+	var (
+		userSvc    *user.UserService
+		sessionSvc *session.SessionService
+		checkers   []session.SessionChecker
+		monitor    *risk.Monitor
+	)
+
+	// the router looks users up only when sending, once userSvc is built
+	notifier := notify.NewRouter(notify.UserGetterFunc(func(ctx context.Context, userID string) (*dto.User, error) {
+		u, err := userSvc.Get(ctx, userID)
+		return u, dto.LenientMetadata(err)
+	}))
+
+	var accessPolicy *access.Policy
+	if len(o.accessRules) > 0 {
+		accessOpts := []access.Option{access.WithAuditLogger(o.auditLog)}
+		for _, e := range o.enrichers {
+			// a geoip.DB passed to WithClaimsEnrichers places IPs itself
+			if l, ok := e.(access.Locator); ok {
+				accessOpts = append(accessOpts, access.WithLocator(l))
+			}
+		}
+
+		accessPolicy, err = access.New(o.accessRules, accessOpts...)
+		if err != nil {
+			return nil, err
+		}
+		checkers = append(checkers, accessPolicy)
+	}
+
+	if o.riskMonitor {
+		revoke := func(ctx context.Context, sessionID string) error {
+			return sessionSvc.Logout(ctx, session.SessionLogoutParams{SessionID: sessionID})
+		}
+
+		// listing sessions needs none of the options below
+		monitor = risk.NewMonitor(session.NewSessionService(client), append([]risk.MonitorOption{
+			risk.WithRevoker(revoke),
+			risk.WithNotifier(notifier),
+			risk.WithHooks(o.hooks),
+		}, o.riskOpts...)...)
+		checkers = append(checkers, monitor)
+	}
+
+	sessionSvc = session.NewSessionService(client,
+		session.WithAuditLogger(o.auditLog),
+		session.WithMigrations(o.migrations),
+		session.WithPushTokens(o.pushTokens),
+		session.WithClaimsEnrichers(o.enrichers...),
+		session.WithSessionCheckers(checkers...),
+	)
+	userSvc = user.NewUserService(client, append(userOpts, user.WithSessionService(sessionSvc))...)
+
+	var in *inbox.Inbox
+	if o.inboxStore != nil {
+		in = inbox.New(o.inboxStore)
+		if o.knownDevices != nil {
+			// new-device alerts reach the inbox through the in-app channel
+			in.Attach(o.hooks, hook.EventPasswordChanged, hook.EventPinLocked)
+		} else {
+			in.Attach(o.hooks)
+		}
+		notifier.Register(notify.ChannelInApp, in.Sender())
+	}
+
+	var alerts *signinalert.Alerter
+	if o.knownDevices != nil {
+		alerts = signinalert.New(o.knownDevices,
+			signinalert.WithNotifier(notifier),
+			signinalert.WithRevokeLinks(o.revokeLinks, signinalert.Revoke(sessionSvc, userSvc)),
+		)
+		alerts.Attach(o.hooks)
+	}
+
+	customOpts := []custom.Option{
+		custom.WithIDGenerator(o.idGenerator),
+		custom.WithHooks(o.hooks),
+		custom.WithMigrations(o.migrations),
+		custom.WithSessionService(sessionSvc),
+		custom.WithUserService(userSvc),
+		custom.WithAuditLogger(o.auditLog),
+		custom.WithSignInAttempts(o.attempts),
+		custom.WithAccessPolicy(accessPolicy),
+	}
+	if o.attempts != nil {
+		customOpts = append(customOpts, custom.WithPinAttempts(o.attempts))
+	}
+	if o.signInRisk != nil {
+		customOpts = append(customOpts, custom.WithSignInRisk(o.signInRisk, o.signInRules...))
+	}
+
 	return &Auth{
-		Custom:       custom.NewCustomService(client),
-		User:         user.NewUserService(client),
-		Session:      session.NewSessionService(client),
+		Custom:       custom.NewCustomService(client, customOpts...),
+		User:         userSvc,
+		Session:      sessionSvc,
+		Hooks:        o.hooks,
+		Notifier:     notifier,
+		Inbox:        in,
+		SignInAlerts: alerts,
+		Risk:         monitor,
+		Access:       accessPolicy,
+		Migrations:   o.migrations,
 		StytchClient: client,
 	}, nil
 }
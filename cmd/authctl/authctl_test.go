@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetaFlag(t *testing.T) {
+	var m metaFlag
+
+	assert.NoError(t, m.Set("notification_sms=false"))
+	assert.NoError(t, m.Set("user_role=admin"))
+	assert.NoError(t, m.Set("webhook_url=null"))
+	assert.NoError(t, m.Set(`note="a=b"`))
+	assert.Error(t, m.Set("novalue"))
+
+	assert.Equal(t, metaFlag{
+		"notification_sms": false,
+		"user_role":        "admin",
+		"webhook_url":      nil,
+		"note":             "a=b",
+	}, m)
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"project_id":"file-project","secret":"file-secret"}`), 0o600))
+
+	t.Setenv("STYTCH_PROJECT_ID", "")
+	t.Setenv("STYTCH_SECRET", "env-secret")
+
+	cfg, err := loadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, config{ProjectID: "file-project", Secret: "env-secret"}, cfg)
+
+	_, err = loadConfig(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestPrinter_Users(t *testing.T) {
+	var buf bytes.Buffer
+
+	out, err := newPrinter(&buf, "table")
+	assert.NoError(t, err)
+
+	email := "a@example.com"
+	assert.NoError(t, out.users([]dto.User{{UserID: "user-1", Email: &email, TrustedMetadata: dto.TrustedMetadata{SystemMetadata: dto.SystemMetadata{UserRole: "admin"}}}}))
+	assert.Contains(t, buf.String(), "USER_ID")
+	assert.Contains(t, buf.String(), "a@example.com")
+
+	_, err = newPrinter(&buf, "yaml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	auth "github.com/otyang/go-authsvc"
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/idgen"
+	"github.com/otyang/go-authsvc/importer"
+	"github.com/otyang/go-authsvc/session"
+	"github.com/otyang/go-authsvc/user"
+)
+
+func userGet(ctx context.Context, a *auth.Auth, out *printer, args []string) error {
+	fs := flag.NewFlagSet("user-get", flag.ExitOnError)
+	email := fs.String("email", "", "look the user up by email instead of id")
+	_ = fs.Parse(args)
+
+	if *email != "" {
+		page, err := a.User.Search(ctx, user.SearchParams{Email: *email}, "")
+		if err != nil {
+			return err
+		}
+		if len(page.Users) == 0 {
+			return user.ErrUserNotFound
+		}
+		return out.users(page.Users[:1])
+	}
+
+	if err := requireArgs(fs, 1, "<user-id>"); err != nil {
+		return err
+	}
+
+	// a user with malformed metadata is still shown, then the error
+	u, err := a.User.Get(ctx, fs.Arg(0))
+	if u == nil {
+		return err
+	}
+
+	if printErr := out.users([]dto.User{*u}); printErr != nil {
+		return printErr
+	}
+	return err
+}
+
+func userSearch(ctx context.Context, a *auth.Auth, out *printer, args []string) error {
+	var (
+		fs   = flag.NewFlagSet("user-search", flag.ExitOnError)
+		p    user.SearchParams
+		meta metaFlag
+	)
+
+	fs.StringVar(&p.Email, "email", "", "exact email address")
+	fs.StringVar(&p.PhoneNumber, "phone", "", "phone number")
+	fs.StringVar(&p.Status, "status", "", "active or pending")
+	fs.StringVar(&p.Role, "role", "", "user role")
+	fs.StringVar(&p.SystemUserID, "system-id", "", "system user id or referral code")
+	after := fs.String("created-after", "", "RFC 3339 time")
+	before := fs.String("created-before", "", "RFC 3339 time")
+	fs.Var(&meta, "meta", "trusted metadata key=value, repeatable")
+	_ = fs.Parse(args)
+
+	var err error
+	if p.CreatedAfter, err = parseTime(*after); err != nil {
+		return err
+	}
+	if p.CreatedBefore, err = parseTime(*before); err != nil {
+		return err
+	}
+	p.TrustedMetadata = meta
+
+	var (
+		found []dto.User
+		it    = a.User.Iterate(p)
+	)
+	for it.Next(ctx) {
+		found = append(found, it.User())
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	// users whose metadata cannot be migrated are named rather than listed
+	for _, sk := range it.Skipped() {
+		fmt.Fprintf(os.Stderr, "skipped user %s: %v\n", sk.UserID, sk.Err)
+	}
+
+	return out.users(found)
+}
+
+func userSetMeta(ctx context.Context, a *auth.Auth, out *printer, args []string) error {
+	if len(args) < 2 {
+		return errors.New("expected <user-id> key=value...")
+	}
+
+	var patch metaFlag
+	for _, kv := range args[1:] {
+		if err := patch.Set(kv); err != nil {
+			return err
+		}
+	}
+
+	// roles, PINs and suspensions have their own vetted paths
+	for k := range patch {
+		if dto.IsSystemKey(k) {
+			return fmt.Errorf("%w: %s", user.ErrSystemMetadataKey, k)
+		}
+	}
+
+	if err := a.User.PatchTrustedMetadata(ctx, args[0], patch); err != nil {
+		return err
+	}
+
+	return out.message("updated %d fields on %s", len(patch), args[0])
+}
+
+func userSuspend(ctx context.Context, a *auth.Auth, out *printer, args []string) error {
+	fs := flag.NewFlagSet("user-suspend", flag.ExitOnError)
+	reason := fs.String("reason", "", "why the user is suspended (required)")
+	_ = fs.Parse(args)
+
+	if err := requireArgs(fs, 1, "<user-id>"); err != nil {
+		return err
+	}
+	if *reason == "" {
+		return errors.New("-reason is required")
+	}
+
+	if err := a.User.Suspend(ctx, fs.Arg(0), *reason); err != nil {
+		return err
+	}
+
+	return out.message("suspended %s", fs.Arg(0))
+}
+
+func userReactivate(ctx context.Context, a *auth.Auth, out *printer, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected <user-id>")
+	}
+
+	if err := a.User.Reactivate(ctx, args[0]); err != nil {
+		return err
+	}
+
+	return out.message("reactivated %s", args[0])
+}
+
+func userBootstrap(ctx context.Context, a *auth.Auth, out *printer, args []string) error {
+	fs := flag.NewFlagSet("user-bootstrap", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "list the users without updating them")
+	_ = fs.Parse(args)
+
+	updated, err := a.User.BootstrapTrustedMetadata(ctx, idgen.Default, *dryRun)
+	if out.json {
+		if encErr := out.encode(map[string]any{"users": updated, "dry_run": *dryRun}); encErr != nil {
+			return encErr
+		}
+	} else {
+		for _, id := range updated {
+			fmt.Fprintln(out.w, id)
+		}
+		fmt.Fprintf(out.w, "%d users bootstrapped (dry run: %t)\n", len(updated), *dryRun)
+	}
+
+	return err
+}
+
+func userExport(ctx context.Context, a *auth.Auth, out *printer, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected <user-id>")
+	}
+
+	archive, err := a.User.Export(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	// an archive has no sensible table form
+	return out.encode(archive)
+}
+
+func userDelete(ctx context.Context, a *auth.Auth, out *printer, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected <user-id>")
+	}
+
+	if err := a.User.Delete(ctx, args[0]); err != nil {
+		return err
+	}
+
+	return out.message("deletion requested for %s", args[0])
+}
+
+func userPurge(ctx context.Context, a *auth.Auth, out *printer, args []string) error {
+	purged, err := a.User.PurgeDueDeletions(ctx, time.Now())
+	if msgErr := out.message("purged %d users %v", len(purged), purged); msgErr != nil {
+		return msgErr
+	}
+	return err
+}
+
+func userImport(ctx context.Context, a *auth.Auth, out *printer, args []string) error {
+	var (
+		fs         = flag.NewFlagSet("user-import", flag.ExitOnError)
+		dryRun     = fs.Bool("dry-run", false, "validate rows without creating users")
+		checkpoint = fs.String("checkpoint", "", "file recording progress, to resume an interrupted import")
+		reportPath = fs.String("report", "", "CSV file listing failed rows (default stderr)")
+	)
+	_ = fs.Parse(args)
+
+	if err := requireArgs(fs, 1, "<users.csv|users.jsonl>"); err != nil {
+		return err
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var src importer.Reader = importer.NewCSVReader(f)
+	if strings.HasSuffix(fs.Arg(0), ".jsonl") || strings.HasSuffix(fs.Arg(0), ".ndjson") {
+		src = importer.NewJSONLReader(f)
+	}
+
+	var report io.Writer = os.Stderr
+	if *reportPath != "" {
+		rf, err := os.Create(*reportPath)
+		if err != nil {
+			return err
+		}
+		defer rf.Close()
+		report = rf
+	}
+
+	opts := []importer.Option{importer.WithReport(report), importer.WithUserService(a.User), importer.WithMigrations(a.Migrations)}
+	if *dryRun {
+		opts = append(opts, importer.WithDryRun())
+	}
+	if *checkpoint != "" {
+		opts = append(opts, importer.WithCheckpoint(*checkpoint))
+	}
+
+	sum, err := importer.New(a.StytchClient, opts...).Run(ctx, src)
+	if msgErr := out.message("imported %d, skipped %d, failed %d (dry run: %t)", sum.Imported, sum.Skipped, sum.Failed, *dryRun); msgErr != nil {
+		return msgErr
+	}
+
+	return err
+}
+
+func sessionList(ctx context.Context, a *auth.Auth, out *printer, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected <user-id>")
+	}
+
+	list, err := a.Session.List(ctx, args[0], "")
+	if err != nil {
+		return err
+	}
+
+	return out.sessions(list)
+}
+
+func sessionRevoke(ctx context.Context, a *auth.Auth, out *printer, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected <session-id>")
+	}
+
+	if err := a.Session.Logout(ctx, session.SessionLogoutParams{SessionID: args[0]}); err != nil {
+		return err
+	}
+
+	return out.message("revoked %s", args[0])
+}
+
+func sessionRevokeAll(ctx context.Context, a *auth.Auth, out *printer, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected <user-id>")
+	}
+
+	if err := a.User.RevokeAllSessions(ctx, args[0]); err != nil {
+		return err
+	}
+
+	return out.message("revoked all sessions of %s", args[0])
+}
+
+// metaFlag collects key=value pairs. Values that parse as JSON (true, 12,
+// null, "quoted") keep their type, anything else is a string.
+type metaFlag map[string]any
+
+func (m *metaFlag) String() string { return fmt.Sprint(map[string]any(*m)) }
+
+func (m *metaFlag) Set(kv string) error {
+	key, raw, ok := strings.Cut(kv, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", kv)
+	}
+
+	var v any
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		v = raw
+	}
+
+	if *m == nil {
+		*m = metaFlag{}
+	}
+	(*m)[key] = v
+
+	return nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+type config struct {
+	ProjectID string `json:"project_id"`
+	Secret    string `json:"secret"`
+}
+
+// loadConfig reads path, or the default config file when path is empty, and
+// lets STYTCH_PROJECT_ID and STYTCH_SECRET override what it holds.
+func loadConfig(path string) (config, error) {
+	var cfg config
+
+	explicit := path != ""
+	if !explicit {
+		if dir, err := os.UserConfigDir(); err == nil {
+			path = filepath.Join(dir, "authctl", "config.json")
+		}
+	}
+
+	if path != "" {
+		b, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(b, &cfg); err != nil {
+				return cfg, err
+			}
+		case explicit || !errors.Is(err, os.ErrNotExist):
+			return cfg, err
+		}
+	}
+
+	if v := os.Getenv("STYTCH_PROJECT_ID"); v != "" {
+		cfg.ProjectID = v
+	}
+	if v := os.Getenv("STYTCH_SECRET"); v != "" {
+		cfg.Secret = v
+	}
+
+	if cfg.ProjectID == "" || cfg.Secret == "" {
+		return cfg, errors.New("missing credentials: set STYTCH_PROJECT_ID and STYTCH_SECRET or use -config")
+	}
+
+	return cfg, nil
+}
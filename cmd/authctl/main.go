@@ -0,0 +1,108 @@
+// Command authctl runs admin operations against the users and sessions of a
+// Stytch project.
+//
+//	authctl [-config file] [-o table|json] <command> [flags] [args]
+//
+// Credentials come from STYTCH_PROJECT_ID and STYTCH_SECRET, or from a JSON
+// config file holding "project_id" and "secret".
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	auth "github.com/otyang/go-authsvc"
+)
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, a *auth.Auth, out *printer, args []string) error
+}
+
+var commands = map[string]command{
+	"user-get":           {"user-get <user-id> | user-get -email <email>", userGet},
+	"user-search":        {"user-search [-email] [-phone] [-status] [-role] [-system-id] [-created-after] [-created-before] [-meta key=value]...", userSearch},
+	"user-set-meta":      {"user-set-meta <user-id> key=value... (application keys only)", userSetMeta},
+	"user-suspend":       {"user-suspend -reason <reason> <user-id>", userSuspend},
+	"user-reactivate":    {"user-reactivate <user-id>", userReactivate},
+	"user-bootstrap":     {"user-bootstrap [-dry-run]", userBootstrap},
+	"user-export":        {"user-export <user-id>", userExport},
+	"user-delete":        {"user-delete <user-id>", userDelete},
+	"user-purge":         {"user-purge", userPurge},
+	"user-import":        {"user-import [-dry-run] [-checkpoint file] [-report file] <users.csv|users.jsonl>", userImport},
+	"session-list":       {"session-list <user-id>", sessionList},
+	"session-revoke":     {"session-revoke <session-id>", sessionRevoke},
+	"session-revoke-all": {"session-revoke-all <user-id>", sessionRevokeAll},
+}
+
+func main() {
+	var (
+		configPath = flag.String("config", "", "JSON config file with project_id and secret")
+		output     = flag.String("o", "table", "output format: table or json")
+	)
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	out, err := newPrinter(os.Stdout, *output)
+	if err != nil {
+		fatal(err)
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fatal(err)
+	}
+
+	a, err := auth.New(cfg.ProjectID, cfg.Secret)
+	if err != nil {
+		fatal(err)
+	}
+
+	if err := cmd.run(context.Background(), a, out, flag.Args()[1:]); err != nil {
+		fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: authctl [-config file] [-o table|json] <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "authctl:", err)
+	os.Exit(1)
+}
+
+// requireArgs checks a command got exactly n positional arguments.
+func requireArgs(fs *flag.FlagSet, n int, what ...string) error {
+	if fs.NArg() != n {
+		return fmt.Errorf("expected %s", strings.Join(what, " "))
+	}
+	return nil
+}
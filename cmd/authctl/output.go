@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+)
+
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+func newPrinter(w io.Writer, format string) (*printer, error) {
+	switch format {
+	case "table":
+		return &printer{w: w}, nil
+	case "json":
+		return &printer{w: w, json: true}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+func (p *printer) users(list []dto.User) error {
+	if p.json {
+		return p.encode(list)
+	}
+
+	rows := make([][]string, 0, len(list))
+	for _, u := range list {
+		rows = append(rows, []string{
+			u.UserID,
+			u.SytstemUserID,
+			deref(u.Email),
+			u.FullName,
+			u.TrustedMetadata.UserRole,
+			fmt.Sprint(u.IsAccountActive),
+			fmt.Sprint(u.IsSuspended),
+			u.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return p.table([]string{"USER_ID", "SYSTEM_ID", "EMAIL", "NAME", "ROLE", "ACTIVE", "SUSPENDED", "CREATED"}, rows)
+}
+
+func (p *printer) sessions(list []dto.SessionListResponse) error {
+	if p.json {
+		return p.encode(list)
+	}
+
+	rows := make([][]string, 0, len(list))
+	for _, s := range list {
+		rows = append(rows, []string{
+			s.SessionID,
+			s.StartedAt.Format(time.RFC3339),
+			s.LastAccessedAt.Format(time.RFC3339),
+			s.DeviceIPAddress,
+			s.IPAddressCountry,
+			s.DeviceType,
+			s.DeviceName,
+			s.ImpersonatedBy,
+		})
+	}
+
+	return p.table([]string{"SESSION_ID", "STARTED", "LAST_ACCESSED", "IP", "COUNTRY", "DEVICE", "DEVICE_NAME", "IMPERSONATED_BY"}, rows)
+}
+
+// message prints a plain confirmation, or {"result": msg} as json.
+func (p *printer) message(format string, args ...any) error {
+	msg := fmt.Sprintf(format, args...)
+	if p.json {
+		return p.encode(map[string]string{"result": msg})
+	}
+
+	_, err := fmt.Fprintln(p.w, msg)
+	return err
+}
+
+func (p *printer) encode(v any) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (p *printer) table(header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
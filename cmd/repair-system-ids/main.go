@@ -0,0 +1,38 @@
+// Command repair-system-ids gives a fresh SystemUserID to every user that
+// shares one with an older account.
+//
+//	STYTCH_PROJECT_ID=... STYTCH_SECRET=... repair-system-ids [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/otyang/go-authsvc/idgen"
+	"github.com/otyang/go-authsvc/user"
+
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/stytchapi"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "print the reassignments without applying them")
+	flag.Parse()
+
+	client, err := stytchapi.NewClient(os.Getenv("STYTCH_PROJECT_ID"), os.Getenv("STYTCH_SECRET"))
+	if err != nil {
+		log.Fatalf("error instantiating API client %s", err)
+	}
+
+	plan, err := user.NewUserService(client).ReassignDuplicateSystemUserIDs(context.Background(), idgen.Default, *dryRun)
+	for _, r := range plan {
+		fmt.Printf("%s\t%s -> %s\n", r.UserID, r.OldSystemUserID, r.NewSystemUserID)
+	}
+	if err != nil {
+		log.Fatalf("repair stopped after %d users: %s", len(plan), err)
+	}
+
+	fmt.Printf("%d users reassigned (dry run: %t)\n", len(plan), *dryRun)
+}
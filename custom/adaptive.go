@@ -0,0 +1,409 @@
+package custom
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/otyang/go-authsvc/audit"
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/hook"
+	"github.com/otyang/go-authsvc/risk"
+	session_svc "github.com/otyang/go-authsvc/session"
+
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/otp"
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/otp/email"
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/totps"
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/users"
+	"github.com/stytchauth/stytch-go/v11/stytch/stytcherror"
+)
+
+// StepUpTTL is how long a step-up challenge can be answered.
+const StepUpTTL = 10 * time.Minute
+
+// maxStepUpAttempts is how many wrong codes end a challenge
+const maxStepUpAttempts = 5
+
+var (
+	ErrSignInBlocked          = errors.New("sign-in blocked")
+	ErrInvalidStepUpChallenge = errors.New("invalid or expired step-up challenge")
+)
+
+// StepUpMethod is how a risky sign-in proves itself, as a risky session
+// does with SessionService.StepUp.
+type StepUpMethod = session_svc.StepUpMethod
+
+const (
+	StepUpTOTP     = session_svc.StepUpTOTP
+	StepUpEmailOTP = session_svc.StepUpEmailOTP
+)
+
+// SignInRiskError refuses a sign-in the risk scorer objected to. It matches
+// ErrSignInBlocked or session.ErrStepUpRequired with errors.Is. After a
+// step-up, answer the challenge with CompleteStepUp.
+type SignInRiskError struct {
+	Decision risk.Decision
+	// ChallengeID and Method are set when a step-up is required
+	ChallengeID string
+	Method      StepUpMethod
+	err         error
+}
+
+func (e *SignInRiskError) Error() string {
+	return e.err.Error()
+}
+
+func (e *SignInRiskError) Is(target error) bool {
+	return target == e.err
+}
+
+// StepUpChallenge is a sign-in waiting for its second factor. It holds the
+// session token, so a ChallengeStore must be kept private.
+type StepUpChallenge struct {
+	ID          string
+	UserID      string
+	SessionID   string
+	Token       string
+	Method      StepUpMethod
+	EmailID     string // the OTP's method id for StepUpEmailOTP
+	Claims      dto.SessionClaims
+	Email       string
+	DurationMin int32
+	Score       int
+	Attempts    int
+	ExpiresAt   time.Time
+}
+
+// ChallengeStore keeps pending step-up challenges.
+type ChallengeStore interface {
+	Save(ctx context.Context, c StepUpChallenge) error
+	// Get returns nil and no error for an unknown challenge.
+	Get(ctx context.Context, id string) (*StepUpChallenge, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// MemoryChallengeStore keeps challenges in memory; sign-ins must then be
+// completed by the process that started them.
+type MemoryChallengeStore struct {
+	mu         sync.Mutex
+	challenges map[string]StepUpChallenge
+}
+
+func NewMemoryChallengeStore() *MemoryChallengeStore {
+	return &MemoryChallengeStore{challenges: map[string]StepUpChallenge{}}
+}
+
+func (m *MemoryChallengeStore) Save(ctx context.Context, c StepUpChallenge) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, old := range m.challenges {
+		if now.After(old.ExpiresAt) {
+			delete(m.challenges, id)
+		}
+	}
+
+	m.challenges[c.ID] = c
+	return nil
+}
+
+func (m *MemoryChallengeStore) Get(ctx context.Context, id string) (*StepUpChallenge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.challenges[id]
+	if !ok {
+		return nil, nil
+	}
+	return &c, nil
+}
+
+func (m *MemoryChallengeStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.challenges, id)
+	return nil
+}
+
+// WithSignInRisk scores every sign-in with a correct password and, by
+// rules (risk.DefaultSignInRules when none are given), lets it through,
+// requires a step-up or blocks it.
+func WithSignInRisk(scorer risk.Scorer, rules ...risk.Rule) Option {
+	return func(s *CustomService) {
+		s.riskScorer, s.riskRules = scorer, rules
+		if len(rules) == 0 {
+			s.riskRules = risk.DefaultSignInRules
+		}
+	}
+}
+
+// WithSignInAttempts records failed sign-ins in store, for
+// risk.FailedAttempts to score.
+func WithSignInAttempts(store risk.AttemptStore) Option {
+	return func(s *CustomService) { s.attempts = store }
+}
+
+// WithStepUpChallenges replaces the in-memory store of pending step-ups,
+// as needed when several processes serve sign-ins.
+func WithStepUpChallenges(store ChallengeStore) Option {
+	return func(s *CustomService) { s.challenges = store }
+}
+
+// WithAuditLogger records sign-in risk decisions and step-up outcomes.
+func WithAuditLogger(l audit.Logger) Option {
+	return func(s *CustomService) { s.auditLog = l }
+}
+
+// assessSignIn scores a sign-in whose password was right. A refused
+// sign-in's session is revoked, or parked until the step-up is answered.
+func (s *CustomService) assessSignIn(ctx context.Context, param SigninParams, sess signedIn) error {
+	if s.riskScorer == nil {
+		return nil
+	}
+
+	d, err := s.scoreSignIn(ctx, param, sess)
+	if err != nil {
+		// fail closed: an unscored sign-in is not let through
+		_ = s.sessionSvc.Logout(ctx, session_svc.SessionLogoutParams{SessionID: sess.SessionID})
+		return err
+	}
+
+	data := map[string]any{
+		"score":    d.Score,
+		"action":   string(d.Action),
+		"findings": d.Findings,
+		"ip":       param.SessionClaims.DeviceIPAddress,
+		"device":   param.SessionClaims.DeviceName(),
+	}
+
+	var riskErr *SignInRiskError
+	switch d.Action {
+	case risk.ActionBlock:
+		_ = s.sessionSvc.Logout(ctx, session_svc.SessionLogoutParams{SessionID: sess.SessionID})
+		riskErr = &SignInRiskError{Decision: d, err: ErrSignInBlocked}
+	case risk.ActionStepUp:
+		c, err := s.startStepUp(ctx, param, sess, d)
+		if err != nil {
+			_ = s.sessionSvc.Logout(ctx, session_svc.SessionLogoutParams{SessionID: sess.SessionID})
+			return err
+		}
+		data["method"] = string(c.Method)
+		riskErr = &SignInRiskError{Decision: d, ChallengeID: c.ID, Method: c.Method, err: session_svc.ErrStepUpRequired}
+	}
+
+	err = audit.Log(ctx, s.auditLog, audit.Event{
+		Action:    audit.ActionSignInAssessed,
+		ActorID:   sess.User.UserID,
+		UserID:    sess.User.UserID,
+		SessionID: sess.SessionID,
+		Data:      data,
+	})
+	if err != nil {
+		// a sign-in that is not on record must not stay usable
+		_ = s.sessionSvc.Logout(ctx, session_svc.SessionLogoutParams{SessionID: sess.SessionID})
+		return err
+	}
+
+	if riskErr != nil {
+		return riskErr
+	}
+	return nil
+}
+
+func (s *CustomService) scoreSignIn(ctx context.Context, param SigninParams, sess signedIn) (risk.Decision, error) {
+	list, err := s.sessionSvc.List(ctx, sess.User.UserID, sess.SessionID)
+	if err != nil {
+		return risk.Decision{}, err
+	}
+
+	a, err := s.riskScorer.Score(ctx, risk.Input{
+		UserID:    sess.User.UserID,
+		SessionID: sess.SessionID,
+		Email:     param.Email,
+		At:        time.Now(),
+		Claims:    param.SessionClaims,
+		Others:    risk.Others(list, sess.SessionID),
+	})
+	if err != nil {
+		return risk.Decision{}, err
+	}
+
+	return risk.Decision{Assessment: a, Action: risk.Decide(a.Score, s.riskRules)}, nil
+}
+
+func (s *CustomService) startStepUp(ctx context.Context, param SigninParams, sess signedIn, d risk.Decision) (*StepUpChallenge, error) {
+	id := make([]byte, 24)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	c := StepUpChallenge{
+		ID:          hex.EncodeToString(id),
+		UserID:      sess.User.UserID,
+		SessionID:   sess.SessionID,
+		Token:       sess.SessionToken,
+		Method:      StepUpEmailOTP,
+		Claims:      param.SessionClaims,
+		Email:       param.Email,
+		DurationMin: param.SessionDurationMinutes,
+		Score:       d.Score,
+		ExpiresAt:   time.Now().Add(StepUpTTL),
+	}
+
+	if sess.User.TotpIsEnabled {
+		c.Method = StepUpTOTP
+	} else {
+		r, err := s.client.OTPs.Email.Send(ctx, &email.SendParams{
+			Email:             param.Email,
+			ExpirationMinutes: int32(StepUpTTL / time.Minute),
+		})
+		if err != nil {
+			return nil, dto.HandleError(err)
+		}
+		c.EmailID = r.EmailID
+	}
+
+	if err := s.challenges.Save(ctx, c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// CompleteStepUp answers the challenge of a SignInRiskError with the TOTP or
+// emailed code. The sign-in then completes as SignIn would have.
+func (s *CustomService) CompleteStepUp(ctx context.Context, param CompleteStepUpParams) (*SigninResponse, error) {
+	c, err := s.challenges.Get(ctx, param.ChallengeID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, ErrInvalidStepUpChallenge
+	}
+	if time.Now().After(c.ExpiresAt) {
+		s.endStepUp(ctx, c, "expired")
+		return nil, ErrInvalidStepUpChallenge
+	}
+
+	var (
+		requestID, token, jwt string
+		stytchUser            users.User
+	)
+	switch c.Method {
+	case StepUpTOTP:
+		var resp *totps.AuthenticateResponse
+		resp, err = s.client.TOTPs.Authenticate(ctx, &totps.AuthenticateParams{
+			UserID:                 c.UserID,
+			TOTPCode:               param.Code,
+			SessionToken:           c.Token,
+			SessionDurationMinutes: c.DurationMin,
+		})
+		if err == nil {
+			requestID, token, jwt, stytchUser = resp.RequestID, resp.SessionToken, resp.SessionJWT, resp.User
+		}
+	default:
+		var resp *otp.AuthenticateResponse
+		resp, err = s.client.OTPs.Authenticate(ctx, &otp.AuthenticateParams{
+			MethodID:               c.EmailID,
+			Code:                   param.Code,
+			SessionToken:           c.Token,
+			SessionDurationMinutes: c.DurationMin,
+		})
+		if err == nil {
+			requestID, token, jwt, stytchUser = resp.RequestID, resp.SessionToken, resp.SessionJWT, resp.User
+		}
+	}
+	if err != nil {
+		if rejected(err) {
+			s.failStepUp(ctx, c)
+		}
+		return nil, dto.HandleError(err)
+	}
+
+	_ = s.challenges.Delete(ctx, c.ID)
+
+	if err := s.sessionSvc.RevokeAll(ctx, c.UserID, c.SessionID); err != nil {
+		return nil, dto.HandleError(err)
+	}
+	s.resetFailures(ctx, c.Email)
+
+	err = audit.Log(ctx, s.auditLog, audit.Event{
+		Action:    audit.ActionSignInStepUpPassed,
+		ActorID:   c.UserID,
+		UserID:    c.UserID,
+		SessionID: c.SessionID,
+		Data:      map[string]any{"method": string(c.Method), "score": c.Score},
+	})
+	if err != nil {
+		_ = s.sessionSvc.Logout(ctx, session_svc.SessionLogoutParams{SessionID: c.SessionID})
+		return nil, err
+	}
+
+	data := c.Claims.EventData()
+	data["session_id"] = c.SessionID
+	s.hooks.Emit(ctx, hook.Event{Type: hook.EventSignedIn, UserID: c.UserID, Data: data})
+
+	return &SigninResponse{
+		RequestID:    requestID,
+		SessionID:    c.SessionID,
+		SessionToken: token,
+		SessionJWT:   jwt,
+		User:         dto.ConvertStytchUserToUser(stytchUser),
+	}, nil
+}
+
+// failStepUp counts a wrong code, ending the challenge after too many.
+func (s *CustomService) failStepUp(ctx context.Context, c *StepUpChallenge) {
+	s.recordFailure(ctx, c.Email)
+
+	c.Attempts++
+	if c.Attempts >= maxStepUpAttempts {
+		s.endStepUp(ctx, c, "too many attempts")
+		return
+	}
+	_ = s.challenges.Save(ctx, *c)
+}
+
+// endStepUp gives up on a challenge and revokes its session.
+func (s *CustomService) endStepUp(ctx context.Context, c *StepUpChallenge, reason string) {
+	_ = s.challenges.Delete(ctx, c.ID)
+	_ = s.sessionSvc.Logout(ctx, session_svc.SessionLogoutParams{SessionID: c.SessionID})
+
+	_ = audit.Log(ctx, s.auditLog, audit.Event{
+		Action:    audit.ActionSignInStepUpFailed,
+		ActorID:   c.UserID,
+		UserID:    c.UserID,
+		SessionID: c.SessionID,
+		Reason:    reason,
+		Data:      map[string]any{"method": string(c.Method), "score": c.Score},
+	})
+}
+
+func (s *CustomService) recordFailure(ctx context.Context, email string) {
+	if s.attempts != nil && email != "" {
+		_ = s.attempts.RecordFailure(ctx, risk.AttemptKey(email), time.Now())
+	}
+}
+
+func (s *CustomService) resetFailures(ctx context.Context, email string) {
+	if s.attempts != nil && email != "" {
+		_ = s.attempts.Reset(ctx, risk.AttemptKey(email))
+	}
+}
+
+// rejected tells Stytch refusing the credentials apart from it failing.
+func rejected(err error) bool {
+	var se stytcherror.Error
+	return errors.As(err, &se) && se.StatusCode >= 400 && se.StatusCode < 500 && se.StatusCode != 429
+}
+
+// signedIn is what SignIn knows once the password checked out.
+type signedIn struct {
+	SessionID    string
+	SessionToken string
+	User         dto.User
+}
@@ -0,0 +1,218 @@
+package custom
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/otyang/go-authsvc/audit"
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/risk"
+	session_svc "github.com/otyang/go-authsvc/session"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/stytchapi"
+)
+
+// fakeStytch answers the session and TOTP calls sign-in risk makes: users
+// have no other sessions and every TOTP code is wrong.
+type fakeStytch struct {
+	mu      sync.Mutex
+	revoked int
+}
+
+func (f *fakeStytch) client(t *testing.T) *stytchapi.API {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/v1/sessions":
+			_, _ = w.Write([]byte(`{"status_code":200,"sessions":[]}`))
+		case "/v1/sessions/revoke":
+			f.mu.Lock()
+			f.revoked++
+			f.mu.Unlock()
+			_, _ = w.Write([]byte(`{"status_code":200}`))
+		case "/v1/totps/authenticate":
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"status_code":401,"error_type":"otp_code_not_found","error_message":"wrong code"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := stytchapi.NewClient(stytchProjectID, stytchSecret,
+		stytchapi.WithBaseURI(srv.URL), stytchapi.WithSkipJWKSInitialization())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func (f *fakeStytch) revokes() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.revoked
+}
+
+// scoreOf scores every sign-in score, or fails with err.
+func scoreOf(score int, err error) risk.Scorer {
+	return risk.Detectors{risk.DetectorFunc(func(ctx context.Context, in risk.Input) ([]risk.Finding, error) {
+		return []risk.Finding{{Detector: "test", Score: score, Reason: "test"}}, err
+	})}
+}
+
+func TestCustomService_assessSignIn(t *testing.T) {
+	var (
+		param = SigninParams{Email: "ada@example.com", SessionClaims: dto.SessionClaims{DeviceIPAddress: "203.0.113.7"}}
+		sess  = signedIn{SessionID: "session-1", SessionToken: "token-1", User: dto.User{UserID: "user-1", TotpIsEnabled: true}}
+	)
+
+	testCases := []struct {
+		name     string
+		scorer   risk.Scorer
+		err      error
+		revoked  int
+		action   risk.Action
+		audited  bool
+		parkedAs StepUpMethod
+	}{
+		{name: "let through", scorer: scoreOf(10, nil), action: risk.ActionNone, audited: true},
+		{name: "step-up", scorer: scoreOf(60, nil), err: session_svc.ErrStepUpRequired, action: risk.ActionStepUp, audited: true, parkedAs: StepUpTOTP},
+		{name: "blocked", scorer: scoreOf(90, nil), err: ErrSignInBlocked, revoked: 1, action: risk.ActionBlock, audited: true},
+		{name: "scorer fails closed", scorer: scoreOf(0, errors.New("geoip down")), err: errors.New("geoip down"), revoked: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				fake       = &fakeStytch{}
+				client     = fake.client(t)
+				log        = audit.NewMemoryStore()
+				challenges = NewMemoryChallengeStore()
+				s          = NewCustomService(client,
+					WithSignInRisk(tc.scorer),
+					WithAuditLogger(log),
+					WithStepUpChallenges(challenges),
+				)
+			)
+
+			err := s.assessSignIn(context.TODO(), param, sess)
+			switch {
+			case tc.err == nil:
+				assert.NoError(t, err)
+			case errors.Is(tc.err, ErrSignInBlocked), errors.Is(tc.err, session_svc.ErrStepUpRequired):
+				assert.ErrorIs(t, err, tc.err)
+			default:
+				assert.EqualError(t, err, tc.err.Error())
+			}
+			assert.Equal(t, tc.revoked, fake.revokes())
+
+			events := log.Events()
+			if !tc.audited {
+				assert.Empty(t, events)
+				return
+			}
+			if assert.Len(t, events, 1) {
+				assert.Equal(t, audit.ActionSignInAssessed, events[0].Action)
+				assert.Equal(t, string(tc.action), events[0].Data["action"])
+			}
+
+			var riskErr *SignInRiskError
+			if tc.parkedAs == "" {
+				assert.False(t, errors.As(err, &riskErr) && riskErr.ChallengeID != "")
+				return
+			}
+			if assert.ErrorAs(t, err, &riskErr) {
+				assert.Equal(t, tc.parkedAs, riskErr.Method)
+
+				c, _ := challenges.Get(context.TODO(), riskErr.ChallengeID)
+				if assert.NotNil(t, c) {
+					assert.Equal(t, "token-1", c.Token)
+					assert.Equal(t, 60, c.Score)
+				}
+			}
+		})
+	}
+}
+
+func TestCustomService_CompleteStepUp_failures(t *testing.T) {
+	var (
+		ctx        = context.TODO()
+		fake       = &fakeStytch{}
+		log        = audit.NewMemoryStore()
+		attempts   = risk.NewMemoryAttemptStore(0)
+		challenges = NewMemoryChallengeStore()
+		s          = NewCustomService(fake.client(t),
+			WithAuditLogger(log),
+			WithSignInAttempts(attempts),
+			WithStepUpChallenges(challenges),
+		)
+	)
+
+	_ = challenges.Save(ctx, StepUpChallenge{
+		ID:        "c1",
+		UserID:    "user-1",
+		SessionID: "session-1",
+		Method:    StepUpTOTP,
+		Email:     "ada@example.com",
+		ExpiresAt: time.Now().Add(StepUpTTL),
+	})
+
+	for i := 1; i < maxStepUpAttempts; i++ {
+		_, err := s.CompleteStepUp(ctx, CompleteStepUpParams{ChallengeID: "c1", Code: "111111"})
+		assert.Error(t, err)
+
+		c, _ := challenges.Get(ctx, "c1")
+		if assert.NotNil(t, c, "attempt %d keeps the challenge", i) {
+			assert.Equal(t, i, c.Attempts)
+		}
+	}
+	assert.Zero(t, fake.revokes())
+
+	_, err := s.CompleteStepUp(ctx, CompleteStepUpParams{ChallengeID: "c1", Code: "111111"})
+	assert.Error(t, err)
+
+	c, _ := challenges.Get(ctx, "c1")
+	assert.Nil(t, c, "too many wrong codes end the challenge")
+	assert.Equal(t, 1, fake.revokes())
+
+	n, _ := attempts.Failures(ctx, risk.AttemptKey("ada@example.com"), time.Now().Add(-time.Hour))
+	assert.Equal(t, maxStepUpAttempts, n)
+
+	events := log.Events()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, audit.ActionSignInStepUpFailed, events[0].Action)
+		assert.Equal(t, "too many attempts", events[0].Reason)
+	}
+
+	_, err = s.CompleteStepUp(ctx, CompleteStepUpParams{ChallengeID: "c1", Code: "000000"})
+	assert.ErrorIs(t, err, ErrInvalidStepUpChallenge)
+}
+
+func TestCustomService_CompleteStepUp_expired(t *testing.T) {
+	var (
+		ctx        = context.TODO()
+		fake       = &fakeStytch{}
+		log        = audit.NewMemoryStore()
+		challenges = NewMemoryChallengeStore()
+		s          = NewCustomService(fake.client(t), WithAuditLogger(log), WithStepUpChallenges(challenges))
+	)
+
+	// saved directly, past the sweep Save does of expired challenges
+	challenges.challenges["c1"] = StepUpChallenge{ID: "c1", UserID: "user-1", SessionID: "session-1", ExpiresAt: time.Now().Add(-time.Second)}
+
+	_, err := s.CompleteStepUp(ctx, CompleteStepUpParams{ChallengeID: "c1", Code: "000000"})
+	assert.ErrorIs(t, err, ErrInvalidStepUpChallenge)
+	assert.Equal(t, 1, fake.revokes())
+
+	events := log.Events()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "expired", events[0].Reason)
+	}
+}
@@ -2,31 +2,96 @@ package custom
 
 import (
 	"context"
+	"errors"
 
+	"github.com/otyang/go-authsvc/access"
+	"github.com/otyang/go-authsvc/audit"
 	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/hook"
+	"github.com/otyang/go-authsvc/idgen"
+	"github.com/otyang/go-authsvc/migrate"
+	"github.com/otyang/go-authsvc/risk"
 	session_svc "github.com/otyang/go-authsvc/session"
+	user_svc "github.com/otyang/go-authsvc/user"
 
 	"github.com/stytchauth/stytch-go/v11/stytch/consumer/otp"
 	"github.com/stytchauth/stytch-go/v11/stytch/consumer/otp/email"
 	"github.com/stytchauth/stytch-go/v11/stytch/consumer/passwords"
 	"github.com/stytchauth/stytch-go/v11/stytch/consumer/passwords/session"
-	"github.com/stytchauth/stytch-go/v11/stytch/consumer/sessions"
 	"github.com/stytchauth/stytch-go/v11/stytch/consumer/stytchapi"
-	"github.com/stytchauth/stytch-go/v11/stytch/consumer/users"
-	"golang.org/x/sync/errgroup"
 )
 
 // CustomService encapsulates interactions with Stytch sessions API
 type CustomService struct {
 	client     *stytchapi.API
 	sessionSvc *session_svc.SessionService
+	userSvc    *user_svc.UserService
+	idGen      idgen.Generator
+	hooks      *hook.Hooks
+	migrations *migrate.Registry
+
+	riskScorer  risk.Scorer
+	riskRules   []risk.Rule
+	attempts    risk.AttemptStore
+	pinAttempts risk.AttemptStore
+	challenges  ChallengeStore
+	auditLog    audit.Logger
+	access      *access.Policy
+}
+
+type Option func(*CustomService)
+
+// WithIDGenerator sets the generator used for SystemUserID on signup.
+func WithIDGenerator(gen idgen.Generator) Option {
+	return func(s *CustomService) { s.idGen = gen }
+}
+
+// WithHooks sets where signup events such as accepted referrals are sent.
+func WithHooks(h *hook.Hooks) Option {
+	return func(s *CustomService) { s.hooks = h }
+}
+
+// WithMigrations stamps new users with the latest metadata schema version.
+func WithMigrations(r *migrate.Registry) Option {
+	return func(s *CustomService) { s.migrations = r }
+}
+
+// WithSessionService shares a configured SessionService, so that the
+// sessions SignIn revokes are cleaned up the same way as on Logout.
+func WithSessionService(svc *session_svc.SessionService) Option {
+	return func(s *CustomService) { s.sessionSvc = svc }
+}
+
+// WithUserService shares a configured UserService, so signup metadata and
+// password reset flags are written with its locks, migrations and audit log.
+func WithUserService(svc *user_svc.UserService) Option {
+	return func(s *CustomService) { s.userSvc = svc }
 }
 
-func NewCustomService(client *stytchapi.API) *CustomService {
-	return &CustomService{
-		client:     client,
-		sessionSvc: session_svc.NewSessionService(client),
+// WithAccessPolicy refuses sign-ins and signups from the countries and IP
+// ranges p denies.
+func WithAccessPolicy(p *access.Policy) Option {
+	return func(s *CustomService) { s.access = p }
+}
+
+func NewCustomService(client *stytchapi.API, opts ...Option) *CustomService {
+	s := &CustomService{
+		client:      client,
+		sessionSvc:  session_svc.NewSessionService(client),
+		idGen:       idgen.Default,
+		challenges:  NewMemoryChallengeStore(),
+		pinAttempts: risk.NewMemoryAttemptStore(0),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.userSvc == nil {
+		s.userSvc = user_svc.NewUserService(client, user_svc.WithSessionService(s.sessionSvc))
 	}
+
+	return s
 }
 
 func (s *CustomService) SignIn(ctx context.Context, param SigninParams) (*SigninResponse, error) {
@@ -34,7 +99,18 @@ func (s *CustomService) SignIn(ctx context.Context, param SigninParams) (*Signin
 		param.SessionDurationMinutes = dto.DefaultSessionDurationMinutes
 	}
 
-	sclaims, err := dto.DecodeFromXToX[map[string]any](param.SessionClaims, false)
+	sclaims, err := s.prepareClaims(ctx, &param.SessionClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	// global rules first, so a denied location learns nothing of the password
+	err = s.access.Check(ctx, access.Request{
+		Flow:    access.FlowSignIn,
+		Email:   param.Email,
+		IP:      param.SessionClaims.DeviceIPAddress,
+		Country: param.SessionClaims.IPAddressCountry,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -46,48 +122,106 @@ func (s *CustomService) SignIn(ctx context.Context, param SigninParams) (*Signin
 		SessionCustomClaims:    *sclaims,
 	})
 	if err != nil {
+		if rejected(err) {
+			s.recordFailure(ctx, param.Email)
+		}
 		return nil, dto.HandleError(err)
 	}
 
-	// Lets clear all sessions
-	{
-		listOfSessions, err := s.sessionSvc.List(ctx, resp.UserID, resp.Session.SessionID)
-		if err != nil {
-			return nil, dto.HandleError(err)
-		}
+	user := dto.ConvertStytchUserToUser(resp.User)
 
-		if len(listOfSessions) > 0 {
-			var g errgroup.Group
-
-			for _, sesn := range listOfSessions {
-				if sesn.CurrentSession {
-					continue
-				}
-
-				g.Go(func(sc *CustomService) func() error {
-					return func() error {
-						_, err := sc.client.Sessions.Revoke(ctx, &sessions.RevokeParams{SessionID: sesn.SessionID})
-						return err
-					}
-				}(s))
-
-				if err := g.Wait(); err != nil {
-					return nil, dto.HandleError(err)
-				}
-			}
-		}
+	if err := s.checkCanSignIn(user); err != nil {
+		// the password was right, but this session must not be usable
+		_ = s.sessionSvc.Logout(ctx, session_svc.SessionLogoutParams{SessionID: resp.Session.SessionID})
+		return nil, err
+	}
+
+	err = s.access.Check(ctx, access.Request{
+		Flow:      access.FlowSignIn,
+		UserID:    user.UserID,
+		SessionID: resp.Session.SessionID,
+		Role:      user.TrustedMetadata.UserRole,
+		IP:        param.SessionClaims.DeviceIPAddress,
+		Country:   param.SessionClaims.IPAddressCountry,
+	})
+	if err != nil {
+		_ = s.sessionSvc.Logout(ctx, session_svc.SessionLogoutParams{SessionID: resp.Session.SessionID})
+		return nil, err
+	}
+
+	err = s.assessSignIn(ctx, param, signedIn{
+		SessionID:    resp.Session.SessionID,
+		SessionToken: resp.SessionToken,
+		User:         user,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Lets clear all sessions
+	if err := s.sessionSvc.RevokeAll(ctx, resp.UserID, resp.Session.SessionID); err != nil {
+		return nil, dto.HandleError(err)
 	}
+	s.resetFailures(ctx, param.Email)
+
+	data := param.SessionClaims.EventData()
+	data["session_id"] = resp.Session.SessionID
+	s.hooks.Emit(ctx, hook.Event{Type: hook.EventSignedIn, UserID: resp.UserID, Data: data})
 
 	return &SigninResponse{
 		RequestID:    resp.RequestID,
 		SessionID:    resp.Session.SessionID,
 		SessionToken: resp.SessionToken,
 		SessionJWT:   resp.SessionJWT,
-		User:         dto.ConvertStytchUserToUser(resp.User),
-	}, err
+		User:         user,
+	}, nil
+}
+
+// prepareClaims enriches c and encodes it as session custom claims.
+func (s *CustomService) prepareClaims(ctx context.Context, c *dto.SessionClaims) (*map[string]any, error) {
+	// only SessionService.Impersonate may mark a session as impersonated
+	c.ImpersonatedBy = ""
+	c.ImpersonationReason = ""
+	c.ImpersonationExpiresAt = ""
+
+	s.sessionSvc.EnrichClaims(ctx, c)
+
+	return dto.DecodeFromXToX[map[string]any](*c, false)
+}
+
+func (s *CustomService) checkCanSignIn(user dto.User) error {
+	if err := session_svc.CheckSuspended(user); err != nil {
+		return err
+	}
+
+	if err := session_svc.CheckDeletionScheduled(user); err != nil {
+		return err
+	}
+
+	if user.TrustedMetadata.PasswordResetRequired {
+		return ErrPasswordResetRequired
+	}
+
+	return nil
 }
 
 func (s *CustomService) SignupStart(ctx context.Context, p SignupStartParams) (string, error) {
+	s.sessionSvc.EnrichClaims(ctx, &p.SessionClaims)
+
+	err := s.access.Check(ctx, access.Request{
+		Flow:    access.FlowSignUp,
+		Email:   p.Email,
+		IP:      p.SessionClaims.DeviceIPAddress,
+		Country: p.SessionClaims.IPAddressCountry,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := s.resolveReferrer(ctx, p.ReferralCode); err != nil {
+		return "", err
+	}
+
 	resp, err := s.client.OTPs.Email.LoginOrCreate(ctx, &email.LoginOrCreateParams{
 		Email:               p.Email,
 		ExpirationMinutes:   p.CodeExpirationMinutes,
@@ -101,30 +235,57 @@ func (s *CustomService) SignupStart(ctx context.Context, p SignupStartParams) (s
 }
 
 func (s *CustomService) SignupComplete(ctx context.Context, param SignupCompleteParams) (*dto.User, error) {
+	sclaims, err := s.prepareClaims(ctx, &param.SessionClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	// check before the otp is spent, so a bad code can be retried
+	err = s.access.Check(ctx, access.Request{
+		Flow:    access.FlowSignUp,
+		IP:      param.SessionClaims.DeviceIPAddress,
+		Country: param.SessionClaims.IPAddressCountry,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	referrer, err := s.resolveReferrer(ctx, param.ReferralCode)
+	if err != nil {
+		return nil, err
+	}
+
 	resp, err := s.client.OTPs.Authenticate(ctx, &otp.AuthenticateParams{
 		MethodID:               param.ReferenceID,
 		Code:                   param.EmailOTPCode,
 		SessionDurationMinutes: param.SessionDurationMinutes,
+		SessionCustomClaims:    *sclaims,
 	})
 	if err != nil {
 		return nil, dto.HandleError(err)
 	}
 
-	tm, err := dto.DecodeFromXToX[map[string]any](dto.DefaultTrustedMetadata, true)
+	systemUserID, err := s.userSvc.NewSystemUserID(ctx, s.idGen)
 	if err != nil {
-		return nil, dto.HandleError(err)
+		return nil, err
 	}
 
-	// update user profile
-	rsp, err := s.client.Users.Update(ctx, &users.UpdateParams{
-		UserID:          resp.UserID,
-		Name:            nil,
-		TrustedMetadata: *tm,
-	})
+	metadata := dto.NewTrustedMetadata(systemUserID)
+	metadata.SchemaVersion = s.migrations.Latest()
+	if referrer != nil {
+		metadata.ReferredBy = &referrer.UserID
+	}
+
+	tm, err := metadata.ToMap()
 	if err != nil {
 		return nil, dto.HandleError(err)
 	}
 
+	userResponse, err := s.userSvc.SeedTrustedMetadata(ctx, resp.UserID, tm)
+	if err != nil {
+		return nil, err
+	}
+
 	// This sets the password for the user account
 	if _, err := s.client.Passwords.Sessions.Reset(ctx, &session.ResetParams{
 		Password:     param.Password,
@@ -133,6 +294,28 @@ func (s *CustomService) SignupComplete(ctx context.Context, param SignupComplete
 		return nil, dto.HandleError(err)
 	}
 
-	userResponse := dto.ConvertStytchUserToUser(rsp.User)
-	return &userResponse, nil
+	if referrer != nil {
+		s.hooks.Emit(ctx, hook.Event{
+			Type:   hook.EventReferralAccepted,
+			UserID: referrer.UserID,
+			Data:   map[string]any{"referred_user_id": userResponse.UserID},
+		})
+	}
+
+	return userResponse, nil
+}
+
+// resolveReferrer maps a referral code to the user who owns it. An empty
+// code resolves to no referrer.
+func (s *CustomService) resolveReferrer(ctx context.Context, referralCode string) (*dto.User, error) {
+	if referralCode == "" {
+		return nil, nil
+	}
+
+	referrer, err := s.userSvc.FindBySystemUserID(ctx, referralCode)
+	if errors.Is(err, user_svc.ErrUserNotFound) {
+		return nil, ErrInvalidReferralCode
+	}
+
+	return referrer, err
 }
@@ -2,14 +2,21 @@ package custom
 
 import (
 	"context"
+	"errors"
 	"log"
 	"testing"
+	"time"
 
 	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/hook"
+	session_svc "github.com/otyang/go-authsvc/session"
+	user_svc "github.com/otyang/go-authsvc/user"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stytchauth/stytch-go/v11/stytch/consumer/sessions"
 	"github.com/stytchauth/stytch-go/v11/stytch/consumer/stytchapi"
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/users"
+	"github.com/stytchauth/stytch-go/v11/stytch/stytcherror"
 )
 
 const (
@@ -99,3 +106,106 @@ func TestCustomService_SignupComplete(t *testing.T) {
 	// assert.True(t, ok)
 	// assert.Equal(t, "user_not_found", string(v.ErrorType))
 }
+
+func TestCustomService_checkCanSignIn(t *testing.T) {
+	s := &CustomService{}
+
+	assert.NoError(t, s.checkCanSignIn(dto.User{}))
+	assert.ErrorIs(t, s.checkCanSignIn(dto.User{IsSuspended: true}), session_svc.ErrAccountSuspended)
+	assert.ErrorIs(t, s.checkCanSignIn(dto.User{
+		TrustedMetadata: dto.TrustedMetadata{SystemMetadata: dto.SystemMetadata{PasswordResetRequired: true}},
+	}), ErrPasswordResetRequired)
+
+	due := "2026-11-01T00:00:00Z"
+	assert.ErrorIs(t, s.checkCanSignIn(dto.User{
+		TrustedMetadata: dto.TrustedMetadata{SystemMetadata: dto.SystemMetadata{DeletionDueAt: &due}},
+	}), session_svc.ErrDeletionScheduled)
+}
+
+func TestCustomService_clearPasswordReset(t *testing.T) {
+	s := NewCustomService((&fakeStytch{}).client(t))
+
+	assert.NoError(t, s.clearPasswordReset(context.TODO(), users.User{UserID: "user-1"}), "no reset, no write")
+	assert.NoError(t, s.clearPasswordReset(context.TODO(), users.User{
+		UserID: "user-1", TrustedMetadata: map[string]any{"password_reset_required": false},
+	}))
+
+	// the fake knows no users, so reaching Stytch shows the flag is cleared
+	assert.Error(t, s.clearPasswordReset(context.TODO(), users.User{
+		UserID: "user-1", TrustedMetadata: map[string]any{"password_reset_required": true},
+	}))
+}
+
+func TestNewCustomService_userService(t *testing.T) {
+	shared := user_svc.NewUserService(nil)
+
+	assert.Same(t, shared, NewCustomService(nil, WithUserService(shared)).userSvc)
+	assert.NotNil(t, NewCustomService(nil).userSvc)
+}
+
+func TestSignInRiskError(t *testing.T) {
+	var err error = &SignInRiskError{ChallengeID: "c1", Method: StepUpTOTP, err: session_svc.ErrStepUpRequired}
+
+	assert.ErrorIs(t, err, session_svc.ErrStepUpRequired)
+	assert.NotErrorIs(t, err, ErrSignInBlocked)
+
+	var riskErr *SignInRiskError
+	if assert.ErrorAs(t, err, &riskErr) {
+		assert.Equal(t, "c1", riskErr.ChallengeID)
+	}
+}
+
+func TestMemoryChallengeStore(t *testing.T) {
+	ctx := context.TODO()
+	store := NewMemoryChallengeStore()
+
+	assert.NoError(t, store.Save(ctx, StepUpChallenge{ID: "old", ExpiresAt: time.Now().Add(-time.Minute)}))
+	assert.NoError(t, store.Save(ctx, StepUpChallenge{ID: "c1", Attempts: 1, ExpiresAt: time.Now().Add(StepUpTTL)}))
+
+	c, err := store.Get(ctx, "c1")
+	assert.NoError(t, err)
+	if assert.NotNil(t, c) {
+		assert.Equal(t, 1, c.Attempts)
+	}
+
+	c, _ = store.Get(ctx, "old")
+	assert.Nil(t, c, "expired challenges are swept on Save")
+
+	assert.NoError(t, store.Delete(ctx, "c1"))
+	c, _ = store.Get(ctx, "c1")
+	assert.Nil(t, c)
+}
+
+func Test_rejected(t *testing.T) {
+	assert.True(t, rejected(stytcherror.Error{StatusCode: 401}))
+	assert.False(t, rejected(stytcherror.Error{StatusCode: 429}))
+	assert.False(t, rejected(stytcherror.Error{StatusCode: 503}))
+	assert.False(t, rejected(errors.New("dial tcp: timeout")))
+}
+
+func TestCustomService_checkPin(t *testing.T) {
+	var (
+		ctx    = context.TODO()
+		locked int
+		h      = hook.New()
+		s      = NewCustomService(nil, WithHooks(h))
+	)
+	h.On(hook.EventPinLocked, func(ctx context.Context, e hook.Event) {
+		assert.Equal(t, "user-1", e.UserID)
+		locked++
+	})
+
+	pinHash, err := dto.HashPin("1234")
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.checkPin(ctx, "user-1", pinHash, "1234"))
+
+	for i := 1; i < MaxPinAttempts; i++ {
+		assert.ErrorIs(t, s.checkPin(ctx, "user-1", pinHash, "0000"), ErrInvalidPin)
+	}
+	assert.ErrorIs(t, s.checkPin(ctx, "user-1", pinHash, "0000"), ErrPinLocked)
+	assert.ErrorIs(t, s.checkPin(ctx, "user-1", pinHash, "1234"), ErrPinLocked, "locked even for the right PIN")
+	assert.Equal(t, 1, locked, "the lock is reported once")
+
+	assert.NoError(t, s.checkPin(ctx, "user-2", pinHash, "1234"), "other users are unaffected")
+}
@@ -0,0 +1,88 @@
+package custom
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/hook"
+	"github.com/otyang/go-authsvc/risk"
+)
+
+const (
+	// MaxPinAttempts wrong PINs within PinLockDuration lock the PIN.
+	MaxPinAttempts = 5
+	// PinLockDuration is how long failures are counted, and so how long a
+	// locked PIN stays locked.
+	PinLockDuration = 15 * time.Minute
+)
+
+var (
+	ErrInvalidPin = errors.New("invalid transaction pin")
+	ErrPinLocked  = errors.New("transaction pin locked after too many attempts")
+	ErrPinNotSet  = errors.New("transaction pin not set")
+)
+
+// WithPinAttempts counts wrong transaction PINs in store instead of in
+// memory, as needed when several processes verify PINs.
+func WithPinAttempts(store risk.AttemptStore) Option {
+	return func(s *CustomService) { s.pinAttempts = store }
+}
+
+// VerifyPin checks the user's transaction PIN. After MaxPinAttempts wrong
+// PINs within PinLockDuration it returns ErrPinLocked, even for the right
+// PIN, until the failures age out, and emits hook.EventPinLocked once.
+func (s *CustomService) VerifyPin(ctx context.Context, userID string, pin string) error {
+	u, err := s.userSvc.Get(ctx, userID)
+	if err := dto.LenientMetadata(err); err != nil {
+		return err
+	}
+
+	pinHash := u.TrustedMetadata.PinHash
+	if pinHash == nil || *pinHash == "" {
+		return ErrPinNotSet
+	}
+
+	return s.checkPin(ctx, userID, *pinHash, pin)
+}
+
+func (s *CustomService) checkPin(ctx context.Context, userID, pinHash, pin string) error {
+	var (
+		key   = pinAttemptKey(userID)
+		now   = time.Now()
+		since = now.Add(-PinLockDuration)
+	)
+
+	failures, err := s.pinAttempts.Failures(ctx, key, since)
+	if err != nil {
+		return err
+	}
+	if failures >= MaxPinAttempts {
+		return ErrPinLocked
+	}
+
+	if s.VerifyTransactionPin(pinHash, pin) {
+		return s.pinAttempts.Reset(ctx, key)
+	}
+
+	if err := s.pinAttempts.RecordFailure(ctx, key, now); err != nil {
+		return err
+	}
+	if failures+1 < MaxPinAttempts {
+		return ErrInvalidPin
+	}
+
+	s.hooks.Emit(ctx, hook.Event{
+		Type:   hook.EventPinLocked,
+		UserID: userID,
+		Data:   map[string]any{"attempts": failures + 1, "locked_until": now.Add(PinLockDuration)},
+	})
+	return ErrPinLocked
+}
+
+// pinAttemptKey keeps PIN failures apart from sign-in failures in a shared
+// store.
+func pinAttemptKey(userID string) string {
+	return "pin:" + userID
+}
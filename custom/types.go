@@ -1,9 +1,16 @@
 package custom
 
 import (
+	"errors"
+
 	"github.com/otyang/go-authsvc/dto"
 )
 
+var (
+	ErrInvalidReferralCode   = errors.New("invalid referral code")
+	ErrPasswordResetRequired = errors.New("password reset required")
+)
+
 type (
 	ForgotPasswordParams struct {
 		Email                 string
@@ -20,6 +27,10 @@ type (
 	SignupStartParams struct {
 		Email                 string
 		CodeExpirationMinutes int32
+		// optional, validated early so the user can fix a typo before the OTP
+		ReferralCode string
+		// the visitor's IP and country, checked against the access rules
+		SessionClaims dto.SessionClaims
 	}
 
 	SignupCompleteParams struct {
@@ -27,6 +38,10 @@ type (
 		Password               string
 		EmailOTPCode           string
 		SessionDurationMinutes int32
+		// optional, the referring user is stored as referred_by
+		ReferralCode string
+		// checked against the access rules and stored on the new session
+		SessionClaims dto.SessionClaims
 	}
 
 	SigninParams struct {
@@ -36,6 +51,13 @@ type (
 		SessionClaims          dto.SessionClaims
 	}
 
+	CompleteStepUpParams struct {
+		// ChallengeID from the SignInRiskError
+		ChallengeID string
+		// Code from the authenticator app or the email
+		Code string
+	}
+
 	SigninResponse struct {
 		RequestID    string
 		SessionID    string
@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/hook"
+	session_svc "github.com/otyang/go-authsvc/session"
 
 	"github.com/stytchauth/stytch-go/v11/stytch/consumer/otp/email"
 
@@ -12,11 +14,13 @@ import (
 	"github.com/stytchauth/stytch-go/v11/stytch/consumer/passwords/existingpassword"
 	"github.com/stytchauth/stytch-go/v11/stytch/consumer/passwords/session"
 	"github.com/stytchauth/stytch-go/v11/stytch/consumer/totps"
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/users"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // Compares a plaintext pin with a stored pin hash using the bcrypt algorithm.
-// It returns true if the passwords match, false otherwise.
+// It returns true if the passwords match, false otherwise. It counts no
+// attempts; use VerifyPin to lock the PIN after repeated failures.
 func (s *CustomService) VerifyTransactionPin(pinHash string, pin string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(pinHash), []byte(pin)) == nil
 }
@@ -50,6 +54,10 @@ func (s *CustomService) ForgotPassword(ctx context.Context, param ForgotPassword
 }
 
 func (s *CustomService) ResetPassword(ctx context.Context, param ResetPasswordParams) error {
+	if err := session_svc.ForbidImpersonation(ctx); err != nil {
+		return err
+	}
+
 	resp, err := s.client.OTPs.Authenticate(ctx, &otp.AuthenticateParams{
 		MethodID:               param.MethodID,
 		Code:                   param.EmailOTPCode,
@@ -64,20 +72,48 @@ func (s *CustomService) ResetPassword(ctx context.Context, param ResetPasswordPa
 		Password:     param.Password,
 		SessionToken: resp.SessionToken,
 	})
+	if err != nil {
+		return dto.HandleError(err)
+	}
 
-	return dto.HandleError(err)
+	s.hooks.Emit(ctx, hook.Event{Type: hook.EventPasswordChanged, UserID: resp.UserID})
+
+	return s.clearPasswordReset(ctx, resp.User)
 }
 
 func (s *CustomService) UpdatePassword(ctx context.Context, email, existingPassword, newPassword string) error {
-	_, err := s.client.Passwords.ExistingPassword.Reset(ctx, &existingpassword.ResetParams{
+	if err := session_svc.ForbidImpersonation(ctx); err != nil {
+		return err
+	}
+
+	resp, err := s.client.Passwords.ExistingPassword.Reset(ctx, &existingpassword.ResetParams{
 		Email:            email,
 		ExistingPassword: existingPassword,
 		NewPassword:      newPassword,
 	})
-	return dto.HandleError(err)
+	if err != nil {
+		return dto.HandleError(err)
+	}
+
+	s.hooks.Emit(ctx, hook.Event{Type: hook.EventPasswordChanged, UserID: resp.UserID})
+
+	return s.clearPasswordReset(ctx, resp.User)
+}
+
+// clearPasswordReset lifts a forced reset, which a changed password
+// satisfies. Users without one are not written to.
+func (s *CustomService) clearPasswordReset(ctx context.Context, u users.User) error {
+	if v, _ := u.TrustedMetadata["password_reset_required"].(bool); !v {
+		return nil
+	}
+	return s.userSvc.SetPasswordResetRequired(ctx, u.UserID, false)
 }
 
 func (s *CustomService) ChangeEmailStartSendCode(ctx context.Context, sessionToken string, newEmail string) (string, error) {
+	if err := s.sessionSvc.ForbidImpersonatedToken(ctx, sessionToken); err != nil {
+		return "", err
+	}
+
 	r, err := s.client.OTPs.Email.Send(ctx, &email.SendParams{
 		Email:        newEmail,
 		SessionToken: sessionToken,
@@ -90,6 +126,10 @@ func (s *CustomService) ChangeEmailStartSendCode(ctx context.Context, sessionTok
 }
 
 func (s *CustomService) ChangeEmailCompleteVerifyCode(ctx context.Context, sentOtpMethodID, code string) error {
+	if err := session_svc.ForbidImpersonation(ctx); err != nil {
+		return err
+	}
+
 	_, err := s.client.OTPs.Authenticate(ctx, &otp.AuthenticateParams{
 		MethodID: sentOtpMethodID,
 		Code:     code,
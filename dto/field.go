@@ -0,0 +1,65 @@
+package dto
+
+// Field is one field of an update. Its zero value leaves the field
+// unchanged; Set and Clear build the other two.
+type Field[T any] struct {
+	value T
+	op    fieldOp
+}
+
+type fieldOp uint8
+
+const (
+	fieldUnchanged fieldOp = iota
+	fieldSet
+	fieldClear
+)
+
+// Set updates the field to v.
+func Set[T any](v T) Field[T] {
+	return Field[T]{value: v, op: fieldSet}
+}
+
+// Clear resets the field to its zero value, nil for optional fields.
+func Clear[T any]() Field[T] {
+	return Field[T]{op: fieldClear}
+}
+
+// SetIfNotNil is Set(*v), or an unchanged field when v is nil.
+func SetIfNotNil[T any](v *T) Field[T] {
+	if v == nil {
+		return Field[T]{}
+	}
+	return Set(*v)
+}
+
+func (f Field[T]) IsSet() bool       { return f.op == fieldSet }
+func (f Field[T]) IsClear() bool     { return f.op == fieldClear }
+func (f Field[T]) IsUnchanged() bool { return f.op == fieldUnchanged }
+
+// Value is the value given to Set, or the zero value.
+func (f Field[T]) Value() T {
+	return f.value
+}
+
+// Apply returns the field's new value given its current one.
+func (f Field[T]) Apply(cur T) T {
+	switch f.op {
+	case fieldSet:
+		return f.value
+	case fieldClear:
+		var zero T
+		return zero
+	default:
+		return cur
+	}
+}
+
+// patchValue lets ApplyPatch tell the three states apart.
+func (f Field[T]) patchValue() (v any, set bool, clear bool) {
+	return f.value, f.op == fieldSet, f.op == fieldClear
+}
+
+type patchField interface {
+	patchValue() (v any, set bool, clear bool)
+}
@@ -0,0 +1,93 @@
+package dto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestField_Apply(t *testing.T) {
+	assert.Equal(t, "cur", Field[string]{}.Apply("cur"))
+	assert.Equal(t, "new", Set("new").Apply("cur"))
+	assert.Equal(t, "", Clear[string]().Apply("cur"))
+
+	assert.True(t, SetIfNotNil[string](nil).IsUnchanged())
+	assert.True(t, SetIfNotNil(toPointer("x")).IsSet())
+	assert.True(t, Clear[bool]().IsClear())
+}
+
+func TestProfileUpdate_UpdateWith(t *testing.T) {
+	initial := DefaultTrustedMetadata
+	initial.UserPhoneNumber = toPointer("+2340000000")
+	initial.WebhookURL = toPointer("https://webhook.com/attend")
+	initial.Extra = map[string]any{"legacy": "kept"}
+
+	updated, err := (&ProfileUpdate{
+		UserPhoneNumber:   Clear[string](),
+		UserProfileImage:  Set("https://image.com/logo.jpg"),
+		NotificationEmail: Set(false),
+		PinHash:           Set("0000"),
+	}).UpdateWith(initial)
+
+	assert.NoError(t, err)
+	assert.Nil(t, updated.UserPhoneNumber)
+	assert.Equal(t, toPointer("https://image.com/logo.jpg"), updated.UserProfileImage)
+	assert.False(t, updated.NotificationEmail)
+	assert.Equal(t, initial.WebhookURL, updated.WebhookURL)
+	assert.Equal(t, initial.UserRole, updated.UserRole)
+	assert.Equal(t, initial.Extra, updated.Extra)
+	if assert.NotNil(t, updated.PinHash) {
+		assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(*updated.PinHash), []byte("0000")))
+	}
+}
+
+func TestProfileUpdate_NameWith(t *testing.T) {
+	cur := Name{FirstName: "Ada", MiddleName: "King", LastName: "Lovelace"}
+
+	testCases := []struct {
+		name     string
+		update   ProfileUpdate
+		expected Name
+		changed  bool
+	}{
+		{
+			name:     "unchanged",
+			update:   ProfileUpdate{UserRole: Set("admin")},
+			expected: cur,
+		},
+		{
+			name:     "set one part keeps the others",
+			update:   ProfileUpdate{FirstName: Set("Augusta")},
+			expected: Name{FirstName: "Augusta", MiddleName: "King", LastName: "Lovelace"},
+			changed:  true,
+		},
+		{
+			name:     "clear a part",
+			update:   ProfileUpdate{MiddleName: Clear[string]()},
+			expected: Name{FirstName: "Ada", LastName: "Lovelace"},
+			changed:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, changed := tc.update.NameWith(cur)
+
+			assert.Equal(t, tc.expected, got)
+			assert.Equal(t, tc.changed, changed)
+		})
+	}
+}
+
+func TestUpdateUserParams_ProfileUpdate(t *testing.T) {
+	p := (&UpdateUserParams{
+		Name:     Name{FirstName: "Ada"},
+		UserRole: toPointer("admin"),
+	}).ProfileUpdate()
+
+	assert.Equal(t, Set("Ada"), p.FirstName)
+	assert.True(t, p.LastName.IsUnchanged(), "empty name parts are left unchanged")
+	assert.Equal(t, Set("admin"), p.UserRole)
+	assert.True(t, p.WebhookURL.IsUnchanged())
+}
@@ -1,34 +1,132 @@
 package dto
 
 import (
-	gonanoid "github.com/matoous/go-nanoid"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
+// TrustedMetadata is the default metadata schema. Applications with their
+// own fields can define a struct embedding SystemMetadata instead and use
+// the generic APIs (UserOf, user.Typed).
 type TrustedMetadata struct {
-	SystemUserID      string  `mapstructure:"system_user_id"`
-	UserRole          string  `mapstructure:"user_role"`
-	UserPhoneNumber   *string `mapstructure:"user_phone_number"`
+	SystemMetadata `mapstructure:",squash"`
+
 	UserProfileImage  *string `mapstructure:"user_profile_image"`
 	NotificationEmail bool    `mapstructure:"notification_email"`
 	NotificationPush  bool    `mapstructure:"notification_push"`
 	NotificationSMS   bool    `mapstructure:"notification_sms"`
 	NotificationInApp bool    `mapstructure:"notification_in_app"`
-	PinHash           *string `mapstructure:"pin_hash"`
 	WebhookURL        *string `mapstructure:"webhook_url"`
+	// per category overrides of the Notification* switches; see ChannelsFor
+	NotificationPreferences map[string]ChannelPreferences `mapstructure:"notification_preferences"`
+
+	// Extra keeps keys this struct does not know, so they survive updates
+	Extra map[string]any `mapstructure:",remain"`
 }
 
+// DefaultTrustedMetadata holds the defaults applied to every new user. It
+// carries no SystemUserID; use NewTrustedMetadata to get one per user.
 var DefaultTrustedMetadata = TrustedMetadata{
-	SystemUserID:      gonanoid.MustGenerate("0123456789abcdefghijklmnopqrstuvwxyz", 10),
-	UserRole:          "customer",
-	UserPhoneNumber:   nil,
-	UserProfileImage:  nil,
+	SystemMetadata: SystemMetadata{
+		UserRole: "customer",
+	},
 	NotificationEmail: true,
 	NotificationPush:  true,
 	NotificationSMS:   true,
 	NotificationInApp: true,
-	PinHash:           nil,
-	WebhookURL:        nil,
+}
+
+// ToMap returns the metadata as stored on the provider, with Extra keys
+// flattened back to the top level.
+func (t TrustedMetadata) ToMap() (map[string]any, error) {
+	return MetadataToMap(t)
+}
+
+// DecodeTrustedMetadata decodes raw leniently into the default schema. See
+// DecodeMetadata.
+func DecodeTrustedMetadata(raw map[string]any) (TrustedMetadata, []MetadataProblem) {
+	return DecodeMetadata[TrustedMetadata](raw)
+}
+
+// MetadataProblem is one trusted metadata field that failed to decode.
+type MetadataProblem struct {
+	Field string
+	Value any
+	Err   error
+}
+
+var ErrInvalidMetadata = errors.New("invalid trusted metadata")
+
+// MetadataError reports every malformed trusted metadata field of a user.
+// It matches ErrInvalidMetadata with errors.Is.
+type MetadataError struct {
+	UserID   string
+	Problems []MetadataProblem
+}
+
+func (e *MetadataError) Error() string {
+	fields := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		fields = append(fields, p.Field)
+	}
+	return fmt.Sprintf("%s for user %s: %s", ErrInvalidMetadata, e.UserID, strings.Join(fields, ", "))
+}
+
+func (e *MetadataError) Is(target error) bool {
+	return target == ErrInvalidMetadata
+}
+
+// System reports whether a malformed field is one of SystemMetadata's, which
+// the library relies on, e.g. to refuse suspended users.
+func (e *MetadataError) System() bool {
+	for _, p := range e.Problems {
+		if systemKeys[p.Field] {
+			return true
+		}
+	}
+	return false
+}
+
+// LenientMetadata drops a *MetadataError whose malformed fields are all
+// application fields, for callers that can work with them zero. Other
+// errors are returned as they are.
+func LenientMetadata(err error) error {
+	var me *MetadataError
+	if errors.As(err, &me) && !me.System() {
+		return nil
+	}
+	return err
+}
+
+// IsSystemKey reports whether key is a trusted metadata key of
+// SystemMetadata, which only the library and admins may write.
+func IsSystemKey(key string) bool {
+	return systemKeys[key]
+}
+
+// systemKeys are the trusted metadata keys of SystemMetadata.
+var systemKeys = func() map[string]bool {
+	keys := map[string]bool{}
+
+	t := reflect.TypeOf(SystemMetadata{})
+	for i := 0; i < t.NumField(); i++ {
+		if key, _, _ := strings.Cut(t.Field(i).Tag.Get("mapstructure"), ","); key != "" {
+			keys[key] = true
+		}
+	}
+	return keys
+}()
+
+// NewTrustedMetadata returns DefaultTrustedMetadata stamped with the given
+// system user id.
+func NewTrustedMetadata(systemUserID string) TrustedMetadata {
+	tm := DefaultTrustedMetadata
+	tm.SystemUserID = systemUserID
+	return tm
 }
 
 type (
@@ -40,65 +138,104 @@ type (
 
 	UpdateUserParams struct {
 		// If name is empty it wouldnt be updated
-		Name              Name
-		UserRole          *string
-		UserPhoneNumber   *string
-		UserProfileImage  *string
-		NotificationEmail *bool
-		NotificationPush  *bool
-		NotificationSMS   *bool
-		NotificationInApp *bool
-		PinHash           *string
-		WebhookURL        *string
+		Name              Name    `mapstructure:"-"`
+		UserRole          *string `mapstructure:"user_role"`
+		UserPhoneNumber   *string `mapstructure:"user_phone_number"`
+		UserProfileImage  *string `mapstructure:"user_profile_image"`
+		NotificationEmail *bool   `mapstructure:"notification_email"`
+		NotificationPush  *bool   `mapstructure:"notification_push"`
+		NotificationSMS   *bool   `mapstructure:"notification_sms"`
+		NotificationInApp *bool   `mapstructure:"notification_in_app"`
+		PinHash           *string `mapstructure:"pin_hash"`
+		WebhookURL        *string `mapstructure:"webhook_url"`
 	}
-)
 
-func (u *UpdateUserParams) UpdateWith(p TrustedMetadata) (TrustedMetadata, error) {
-	if u.UserRole != nil {
-		p.UserRole = *u.UserRole
+	// ProfileUpdate changes a user's profile field by field: each Field is
+	// left unchanged, Set or Cleared.
+	ProfileUpdate struct {
+		FirstName         Field[string] `mapstructure:"-"`
+		MiddleName        Field[string] `mapstructure:"-"`
+		LastName          Field[string] `mapstructure:"-"`
+		UserRole          Field[string] `mapstructure:"user_role"`
+		UserPhoneNumber   Field[string] `mapstructure:"user_phone_number"`
+		UserProfileImage  Field[string] `mapstructure:"user_profile_image"`
+		NotificationEmail Field[bool]   `mapstructure:"notification_email"`
+		NotificationPush  Field[bool]   `mapstructure:"notification_push"`
+		NotificationSMS   Field[bool]   `mapstructure:"notification_sms"`
+		NotificationInApp Field[bool]   `mapstructure:"notification_in_app"`
+		// the plain pin; it is hashed before it is stored
+		PinHash    Field[string] `mapstructure:"pin_hash"`
+		WebhookURL Field[string] `mapstructure:"webhook_url"`
 	}
+)
 
-	if u.UserPhoneNumber != nil {
-		p.UserPhoneNumber = u.UserPhoneNumber
+// ProfileUpdate converts the params: nil fields and empty name parts are
+// left unchanged.
+func (u *UpdateUserParams) ProfileUpdate() ProfileUpdate {
+	nonEmpty := func(s string) Field[string] {
+		if s == "" {
+			return Field[string]{}
+		}
+		return Set(s)
 	}
 
-	if u.UserProfileImage != nil {
-		p.UserProfileImage = u.UserProfileImage
+	return ProfileUpdate{
+		FirstName:         nonEmpty(u.Name.FirstName),
+		MiddleName:        nonEmpty(u.Name.MiddleName),
+		LastName:          nonEmpty(u.Name.LastName),
+		UserRole:          SetIfNotNil(u.UserRole),
+		UserPhoneNumber:   SetIfNotNil(u.UserPhoneNumber),
+		UserProfileImage:  SetIfNotNil(u.UserProfileImage),
+		NotificationEmail: SetIfNotNil(u.NotificationEmail),
+		NotificationPush:  SetIfNotNil(u.NotificationPush),
+		NotificationSMS:   SetIfNotNil(u.NotificationSMS),
+		NotificationInApp: SetIfNotNil(u.NotificationInApp),
+		PinHash:           SetIfNotNil(u.PinHash),
+		WebhookURL:        SetIfNotNil(u.WebhookURL),
 	}
+}
 
-	if u.NotificationEmail != nil {
-		p.NotificationEmail = *u.NotificationEmail
-	}
+func (p *ProfileUpdate) UpdateWith(m TrustedMetadata) (TrustedMetadata, error) {
+	patch := *p
 
-	if u.NotificationPush != nil {
-		p.NotificationPush = *u.NotificationPush
+	if p.PinHash.IsSet() {
+		hashed, err := HashPin(p.PinHash.Value())
+		if err != nil {
+			return TrustedMetadata{}, err
+		}
+		patch.PinHash = Set(hashed)
 	}
 
-	if u.NotificationSMS != nil {
-		p.NotificationSMS = *u.NotificationSMS
-	}
+	return ApplyPatch(m, patch)
+}
 
-	if u.NotificationInApp != nil {
-		p.NotificationInApp = *u.NotificationInApp
-	}
+// NameWith returns the full name after the update, and whether it changed.
+func (p *ProfileUpdate) NameWith(cur Name) (Name, bool) {
+	changed := !p.FirstName.IsUnchanged() || !p.MiddleName.IsUnchanged() || !p.LastName.IsUnchanged()
+
+	return Name{
+		FirstName:  p.FirstName.Apply(cur.FirstName),
+		MiddleName: p.MiddleName.Apply(cur.MiddleName),
+		LastName:   p.LastName.Apply(cur.LastName),
+	}, changed
+}
+
+func (u *UpdateUserParams) UpdateWith(p TrustedMetadata) (TrustedMetadata, error) {
+	patch := *u
 
 	if u.PinHash != nil {
-		hashed, err := hashPin(*u.PinHash)
+		hashed, err := HashPin(*u.PinHash)
 		if err != nil {
 			return TrustedMetadata{}, err
 		}
-		p.PinHash = &hashed
-	}
-
-	if u.WebhookURL != nil {
-		p.WebhookURL = u.WebhookURL
+		patch.PinHash = &hashed
 	}
 
-	return p, nil
+	return ApplyPatch(p, patch)
 }
 
 // HashPin takes a plain text pin and returns a hashed version using bcrypt.
-func hashPin(pin string) (string, error) {
+func HashPin(pin string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
 	return string(bytes), err
 }
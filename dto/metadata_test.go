@@ -1,6 +1,7 @@
 package dto
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -9,7 +10,7 @@ import (
 func TestUpdateUserParams_UpdateWith(t *testing.T) {
 	var (
 		pin            = "0000"
-		hashedPin, err = hashPin(pin)
+		hashedPin, err = HashPin(pin)
 	)
 	assert.NoError(t, err)
 
@@ -35,15 +36,17 @@ func TestUpdateUserParams_UpdateWith(t *testing.T) {
 			},
 			initialMeta: DefaultTrustedMetadata,
 			expectedMeta: TrustedMetadata{
-				SystemUserID:      "",
-				UserRole:          "admin",
-				UserPhoneNumber:   toPointer("1234567890"),
+				SystemMetadata: SystemMetadata{
+					SystemUserID:    "",
+					UserRole:        "admin",
+					UserPhoneNumber: toPointer("1234567890"),
+					PinHash:         &hashedPin,
+				},
 				UserProfileImage:  toPointer("https://image.com/logo.jpg"),
 				NotificationEmail: true,
 				NotificationPush:  true,
 				NotificationSMS:   true,
 				NotificationInApp: true,
-				PinHash:           &hashedPin,
 				WebhookURL:        toPointer("https://webhook.com/attend"),
 			},
 		},
@@ -71,3 +74,90 @@ func TestUpdateUserParams_UpdateWith(t *testing.T) {
 func toPointer[T any](s T) *T {
 	return &s
 }
+
+func TestNewTrustedMetadata(t *testing.T) {
+	a := NewTrustedMetadata("abc123")
+	b := NewTrustedMetadata("xyz789")
+
+	assert.Equal(t, "abc123", a.SystemUserID)
+	assert.Equal(t, "xyz789", b.SystemUserID)
+	assert.Equal(t, DefaultTrustedMetadata.UserRole, a.UserRole)
+	assert.Empty(t, DefaultTrustedMetadata.SystemUserID)
+}
+
+func TestDecodeTrustedMetadata(t *testing.T) {
+	raw := map[string]any{
+		"system_user_id":     "abc123",
+		"user_role":          "admin",
+		"notification_email": "not-a-bool",
+		"pin_hash":           map[string]any{"nested": true},
+		"favourite_colour":   "teal",
+	}
+
+	got, problems := DecodeTrustedMetadata(raw)
+
+	assert.Equal(t, "abc123", got.SystemUserID)
+	assert.Equal(t, "admin", got.UserRole)
+	assert.False(t, got.NotificationEmail)
+	assert.Nil(t, got.PinHash)
+	assert.Equal(t, map[string]any{"favourite_colour": "teal"}, got.Extra)
+
+	assert.Len(t, problems, 2)
+	assert.Equal(t, "notification_email", problems[0].Field)
+	assert.Equal(t, "pin_hash", problems[1].Field)
+}
+
+func TestTrustedMetadata_ToMap(t *testing.T) {
+	tm := NewTrustedMetadata("abc123")
+	tm.Extra = map[string]any{"favourite_colour": "teal", "system_user_id": "shadowed"}
+
+	m, err := tm.ToMap()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "abc123", m["system_user_id"])
+	assert.Equal(t, "teal", m["favourite_colour"])
+	assert.NotContains(t, m, "Extra")
+
+	// a round trip keeps unknown keys
+	back, problems := DecodeTrustedMetadata(m)
+	assert.Empty(t, problems)
+	assert.Equal(t, "teal", back.Extra["favourite_colour"])
+}
+
+func TestTrustedMetadata_ChannelsFor(t *testing.T) {
+	tm := DefaultTrustedMetadata
+	tm.NotificationPreferences = map[string]ChannelPreferences{
+		CategoryMarketing: {Push: true},
+		CategorySecurity:  {SMS: true},
+	}
+
+	assert.Equal(t, ChannelPreferences{Push: true}, tm.ChannelsFor(CategoryMarketing))
+	assert.Equal(t, ChannelPreferences{Email: true, SMS: true, InApp: true}, tm.ChannelsFor(CategorySecurity))
+	assert.Equal(t, ChannelPreferences{Email: true, Push: true, SMS: true, InApp: true}, tm.ChannelsFor(CategoryTransactions))
+}
+
+func TestValidateChannelPreferences(t *testing.T) {
+	assert.NoError(t, ValidateChannelPreferences(CategoryMarketing, ChannelPreferences{}))
+	assert.NoError(t, ValidateChannelPreferences(CategorySecurity, ChannelPreferences{Email: true, InApp: true}))
+	assert.ErrorIs(t, ValidateChannelPreferences(CategorySecurity, ChannelPreferences{InApp: true}), ErrMandatoryChannel)
+}
+
+func TestNotificationPreferences_RoundTrip(t *testing.T) {
+	tm := DefaultTrustedMetadata
+	tm.NotificationPreferences = map[string]ChannelPreferences{CategoryMarketing: {Email: true}}
+
+	m, err := tm.ToMap()
+	assert.NoError(t, err)
+
+	// the provider stores json, so decode what it would send back
+	b, err := json.Marshal(m)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"marketing":{"email":true,"push":false,"sms":false,"in_app":false}`)
+
+	var raw map[string]any
+	assert.NoError(t, json.Unmarshal(b, &raw))
+
+	decoded, problems := DecodeTrustedMetadata(raw)
+	assert.Empty(t, problems)
+	assert.Equal(t, tm.NotificationPreferences, decoded.NotificationPreferences)
+}
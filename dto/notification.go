@@ -0,0 +1,75 @@
+package dto
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Notification categories. Applications may use their own as well.
+const (
+	CategorySecurity     = "security"
+	CategoryMarketing    = "marketing"
+	CategoryTransactions = "transactions"
+)
+
+var ErrMandatoryChannel = errors.New("notification channel cannot be turned off")
+
+// ChannelPreferences says which channels a user receives a category on.
+// The json tags keep the stored keys stable, since nested values reach the
+// provider without going through mapstructure.
+type ChannelPreferences struct {
+	Email bool `mapstructure:"email" json:"email"`
+	Push  bool `mapstructure:"push" json:"push"`
+	SMS   bool `mapstructure:"sms" json:"sms"`
+	InApp bool `mapstructure:"in_app" json:"in_app"`
+}
+
+// mandatoryChannels are delivered whatever the user chose.
+var mandatoryChannels = map[string]ChannelPreferences{
+	CategorySecurity: {Email: true, InApp: true},
+}
+
+// ChannelsFor returns the channels category is delivered on. Categories the
+// user never set follow the global Notification* switches, and mandatory
+// channels are always on.
+func (t TrustedMetadata) ChannelsFor(category string) ChannelPreferences {
+	p, ok := t.NotificationPreferences[category]
+	if !ok {
+		p = ChannelPreferences{
+			Email: t.NotificationEmail,
+			Push:  t.NotificationPush,
+			SMS:   t.NotificationSMS,
+			InApp: t.NotificationInApp,
+		}
+	}
+
+	m := mandatoryChannels[category]
+	p.Email = p.Email || m.Email
+	p.Push = p.Push || m.Push
+	p.SMS = p.SMS || m.SMS
+	p.InApp = p.InApp || m.InApp
+
+	return p
+}
+
+// ValidateChannelPreferences returns ErrMandatoryChannel if p turns off a
+// channel that category must always be delivered on.
+func ValidateChannelPreferences(category string, p ChannelPreferences) error {
+	m := mandatoryChannels[category]
+
+	for _, c := range []struct {
+		name string
+		off  bool
+	}{
+		{"email", m.Email && !p.Email},
+		{"push", m.Push && !p.Push},
+		{"sms", m.SMS && !p.SMS},
+		{"in_app", m.InApp && !p.InApp},
+	} {
+		if c.off {
+			return fmt.Errorf("%w: %s notices on %s", ErrMandatoryChannel, category, c.name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package dto
+
+import "time"
+
+type PushPlatform string
+
+const (
+	PushPlatformFCM  PushPlatform = "fcm"
+	PushPlatformAPNs PushPlatform = "apns"
+)
+
+func (p PushPlatform) Valid() bool {
+	return p == PushPlatformFCM || p == PushPlatformAPNs
+}
+
+// PushToken is a device's FCM or APNs token, registered by the session it
+// was signed in with. It lives as long as that session.
+type PushToken struct {
+	Token        string       `json:"token"`
+	Platform     PushPlatform `json:"platform"`
+	UserID       string       `json:"user_id"`
+	SessionID    string       `json:"session_id"`
+	RegisteredAt time.Time    `json:"registered_at"`
+}
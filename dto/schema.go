@@ -0,0 +1,185 @@
+package dto
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// SystemMetadata holds the trusted metadata fields the library itself reads
+// and writes. An application schema embeds it with the squash tag:
+//
+//	type AppMetadata struct {
+//		dto.SystemMetadata `mapstructure:",squash"`
+//		Plan               string         `mapstructure:"plan"`
+//		Extra              map[string]any `mapstructure:",remain"`
+//	}
+type SystemMetadata struct {
+	SystemUserID    string  `mapstructure:"system_user_id"`
+	UserRole        string  `mapstructure:"user_role"`
+	UserPhoneNumber *string `mapstructure:"user_phone_number"`
+	// the bcrypt hash of the transaction PIN
+	PinHash    *string `mapstructure:"pin_hash"`
+	ReferredBy *string `mapstructure:"referred_by"`
+	// set by admins; a suspended user cannot sign in or use a session
+	Suspended       bool    `mapstructure:"suspended"`
+	SuspendedReason *string `mapstructure:"suspended_reason"`
+	SuspendedAt     *string `mapstructure:"suspended_at"`
+	// when set, SignIn refuses until the password is reset
+	PasswordResetRequired bool `mapstructure:"password_reset_required"`
+	// RFC 3339 time a requested account deletion takes effect
+	DeletionDueAt *string `mapstructure:"deletion_due_at"`
+	// see package migrate
+	SchemaVersion int `mapstructure:"schema_version"`
+	// bumped by every update made through UserService
+	Revision int64 `mapstructure:"revision"`
+}
+
+// System implements Metadata; structs embedding SystemMetadata get it for free.
+func (s SystemMetadata) System() SystemMetadata {
+	return s
+}
+
+// Metadata is implemented by every trusted metadata schema.
+type Metadata interface {
+	System() SystemMetadata
+}
+
+var ErrInvalidPatch = errors.New("metadata patch must be a struct")
+
+// DecodeMetadata decodes raw leniently: a field that does not decode is left
+// at its zero value and reported, instead of failing the whole decode.
+// Unknown keys go to the schema's ",remain" field, if it has one.
+func DecodeMetadata[M Metadata](raw map[string]any) (M, []MetadataProblem) {
+	var (
+		clean    = make(map[string]any, len(raw))
+		problems []MetadataProblem
+	)
+
+	for k, v := range raw {
+		if _, err := DecodeFromXToX[M](map[string]any{k: v}, true); err != nil {
+			problems = append(problems, MetadataProblem{Field: k, Value: v, Err: err})
+			continue
+		}
+		clean[k] = v
+	}
+
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Field < problems[j].Field })
+
+	metadata, err := DecodeFromXToX[M](clean, true)
+	if err != nil {
+		// every key decoded alone, so this only happens on a library bug
+		var zero M
+		return zero, append(problems, MetadataProblem{Err: err})
+	}
+
+	return *metadata, problems
+}
+
+// MetadataToMap returns m as stored on the provider. Keys held in a
+// ",remain" field are flattened back to the top level without overriding
+// known keys.
+func MetadataToMap(m any) (map[string]any, error) {
+	out, err := DecodeFromXToX[map[string]any](m, true)
+	if err != nil {
+		return nil, err
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(m))
+	if v.Kind() != reflect.Struct {
+		return *out, nil
+	}
+
+	for _, name := range remainFields(v.Type()) {
+		extra, _ := (*out)[name].(map[string]any)
+		delete(*out, name)
+		for k, val := range extra {
+			if _, known := (*out)[k]; !known {
+				(*out)[k] = val
+			}
+		}
+	}
+
+	return *out, nil
+}
+
+// remainFields returns the map keys mapstructure encodes ",remain" fields
+// under, looking into squashed embedded structs.
+func remainFields(t reflect.Type) []string {
+	var names []string
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+
+		switch {
+		case opts == "remain":
+			if name == "" {
+				name = f.Name
+			}
+			names = append(names, name)
+		case opts == "squash" && f.Type.Kind() == reflect.Struct:
+			names = append(names, remainFields(f.Type)...)
+		}
+	}
+
+	return names
+}
+
+// ApplyPatch merges patch into current. patch is a struct whose fields are
+// tagged with the mapstructure key they update. Field values follow their
+// Set/Clear state; other nil fields are left unchanged, so pointers work
+// too. Untagged fields and fields tagged "-" are ignored.
+func ApplyPatch[M Metadata](current M, patch any) (M, error) {
+	v := reflect.Indirect(reflect.ValueOf(patch))
+	if v.Kind() != reflect.Struct {
+		return current, ErrInvalidPatch
+	}
+
+	data, err := MetadataToMap(current)
+	if err != nil {
+		return current, err
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		key, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if !f.IsExported() || key == "" || key == "-" {
+			continue
+		}
+
+		fv := v.Field(i)
+		if pf, ok := fv.Interface().(patchField); ok {
+			switch val, set, clear := pf.patchValue(); {
+			case set:
+				data[key] = val
+			case clear:
+				delete(data, key)
+			}
+			continue
+		}
+
+		switch fv.Kind() {
+		case reflect.Pointer:
+			if fv.IsNil() {
+				continue
+			}
+			data[key] = fv.Elem().Interface()
+		case reflect.Map, reflect.Slice, reflect.Interface:
+			if fv.IsNil() {
+				continue
+			}
+			data[key] = fv.Interface()
+		default:
+			data[key] = fv.Interface()
+		}
+	}
+
+	updated, err := DecodeFromXToX[M](data, true)
+	if err != nil {
+		return current, err
+	}
+
+	return *updated, nil
+}
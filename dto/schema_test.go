@@ -0,0 +1,117 @@
+package dto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/users"
+)
+
+type appMetadata struct {
+	SystemMetadata `mapstructure:",squash"`
+	Plan           string         `mapstructure:"plan"`
+	Seats          int            `mapstructure:"seats"`
+	Extra          map[string]any `mapstructure:",remain"`
+}
+
+type appPatch struct {
+	Plan  *string `mapstructure:"plan"`
+	Seats *int    `mapstructure:"seats"`
+	Note  *string
+}
+
+func TestConvertStytchUserOf(t *testing.T) {
+	user, err := ConvertStytchUserOf[appMetadata](users.User{
+		UserID: "user-1",
+		TrustedMetadata: map[string]any{
+			"system_user_id": "SYS1",
+			"suspended":      true,
+			"plan":           "pro",
+			"legacy":         "kept",
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "SYS1", user.SytstemUserID)
+	assert.Equal(t, "SYS1", user.ReferralCode)
+	assert.True(t, user.IsSuspended)
+	assert.Equal(t, "pro", user.TrustedMetadata.Plan)
+	assert.Equal(t, map[string]any{"legacy": "kept"}, user.TrustedMetadata.Extra)
+}
+
+func TestApplyPatch(t *testing.T) {
+	current := appMetadata{
+		SystemMetadata: SystemMetadata{SystemUserID: "SYS1", UserRole: "customer"},
+		Plan:           "free",
+		Seats:          3,
+		Extra:          map[string]any{"legacy": "kept"},
+	}
+
+	testCases := []struct {
+		name     string
+		patch    any
+		expected appMetadata
+		err      error
+	}{
+		{
+			name:     "nil fields are left unchanged",
+			patch:    appPatch{},
+			expected: current,
+		},
+		{
+			name:  "set fields are applied",
+			patch: &appPatch{Plan: toPointer("pro"), Note: toPointer("ignored")},
+			expected: appMetadata{
+				SystemMetadata: current.SystemMetadata,
+				Plan:           "pro",
+				Seats:          3,
+				Extra:          current.Extra,
+			},
+		},
+		{
+			name:     "non struct patch",
+			patch:    map[string]any{"plan": "pro"},
+			expected: current,
+			err:      ErrInvalidPatch,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			updated, err := ApplyPatch(current, tc.patch)
+
+			assert.ErrorIs(t, err, tc.err)
+			assert.Equal(t, tc.expected, updated)
+		})
+	}
+}
+
+func TestMetadataToMap_Squash(t *testing.T) {
+	m, err := MetadataToMap(appMetadata{
+		SystemMetadata: SystemMetadata{SystemUserID: "SYS1"},
+		Plan:           "pro",
+		Extra:          map[string]any{"legacy": "kept", "plan": "shadowed"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "SYS1", m["system_user_id"])
+	assert.Equal(t, "pro", m["plan"])
+	assert.Equal(t, "kept", m["legacy"])
+	assert.NotContains(t, m, "Extra")
+	assert.NotContains(t, m, "SystemMetadata")
+}
+
+func TestTrustedMetadata_Squash(t *testing.T) {
+	tm := NewTrustedMetadata("SYS1")
+
+	m, err := tm.ToMap()
+	assert.NoError(t, err)
+	assert.Equal(t, "SYS1", m["system_user_id"])
+	assert.Equal(t, "customer", m["user_role"])
+	assert.NotContains(t, m, "SystemMetadata")
+
+	decoded, problems := DecodeTrustedMetadata(map[string]any{"user_role": "admin", "suspended": true, "notification_sms": true})
+	assert.Empty(t, problems)
+	assert.Equal(t, SystemMetadata{UserRole: "admin", Suspended: true}, decoded.System())
+	assert.True(t, decoded.NotificationSMS)
+}
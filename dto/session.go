@@ -6,7 +6,17 @@ import (
 
 const DefaultSessionDurationMinutes int32 = 60 * 24
 
-type Session struct {
+// Device types a useragent.Parser sorts sessions into.
+const (
+	DeviceTypeDesktop = "desktop"
+	DeviceTypeMobile  = "mobile"
+	DeviceTypeTablet  = "tablet"
+	DeviceTypeBot     = "bot"
+	DeviceTypeApp     = "app"
+)
+
+// SessionOf is an authenticated session whose user has metadata schema M.
+type SessionOf[M Metadata] struct {
 	UserID           string
 	ID               string
 	Jwt              string
@@ -19,7 +29,68 @@ type Session struct {
 	DeviceType       string
 	IPAddressCity    string
 	IPAddressCountry string
-	User             User
+
+	IPAddressASN       uint
+	IPAddressASOrg     string
+	IPAddressLatitude  float64
+	IPAddressLongitude float64
+
+	Browser        string
+	BrowserVersion string
+	OS             string
+	OSVersion      string
+	// DeviceName reads like "Chrome on macOS", see SessionClaims.DeviceName
+	DeviceName string
+
+	// AuthFactors lists the factor types used in this session, e.g. "password", "totp"
+	AuthFactors []string
+	// ImpersonatedBy is the admin user id when this is an impersonation session
+	ImpersonatedBy      string
+	ImpersonationReason string
+	User                UserOf[M]
+}
+
+// Session is a session with the default TrustedMetadata schema.
+type Session = SessionOf[TrustedMetadata]
+
+// Untyped returns the session with the default schema, as the rbac, policy
+// and context helpers take it. Only the system fields of a custom schema
+// carry over.
+func (s *SessionOf[M]) Untyped() *Session {
+	if sn, ok := any(s).(*Session); ok {
+		return sn
+	}
+
+	return &Session{
+		UserID:           s.UserID,
+		ID:               s.ID,
+		Jwt:              s.Jwt,
+		Token:            s.Token,
+		StartedAt:        s.StartedAt,
+		LastAccessedAt:   s.LastAccessedAt,
+		ExpiresAt:        s.ExpiresAt,
+		DeviceIPAddress:  s.DeviceIPAddress,
+		DeviceUserAgent:  s.DeviceUserAgent,
+		DeviceType:       s.DeviceType,
+		IPAddressCity:    s.IPAddressCity,
+		IPAddressCountry: s.IPAddressCountry,
+
+		IPAddressASN:       s.IPAddressASN,
+		IPAddressASOrg:     s.IPAddressASOrg,
+		IPAddressLatitude:  s.IPAddressLatitude,
+		IPAddressLongitude: s.IPAddressLongitude,
+
+		Browser:        s.Browser,
+		BrowserVersion: s.BrowserVersion,
+		OS:             s.OS,
+		OSVersion:      s.OSVersion,
+		DeviceName:     s.DeviceName,
+
+		AuthFactors:         s.AuthFactors,
+		ImpersonatedBy:      s.ImpersonatedBy,
+		ImpersonationReason: s.ImpersonationReason,
+		User:                s.User.Untyped(),
+	}
 }
 
 type SessionListResponse struct {
@@ -33,6 +104,21 @@ type SessionListResponse struct {
 	DeviceType       string
 	IPAddressCity    string
 	IPAddressCountry string
+	ImpersonatedBy   string
+	// ImpersonationReason is set with ImpersonatedBy
+	ImpersonationReason string
+
+	IPAddressASN       uint
+	IPAddressASOrg     string
+	IPAddressLatitude  float64
+	IPAddressLongitude float64
+
+	Browser        string
+	BrowserVersion string
+	OS             string
+	OSVersion      string
+	// DeviceName reads like "Chrome on macOS", see SessionClaims.DeviceName
+	DeviceName string
 }
 
 type SessionClaims struct {
@@ -41,4 +127,77 @@ type SessionClaims struct {
 	DeviceType       string
 	IPAddressCity    string
 	IPAddressCountry string
+
+	// filled in by a ClaimsEnricher, such as geoip.DB, when left empty
+	IPAddressASN       uint
+	IPAddressASOrg     string
+	IPAddressLatitude  float64
+	IPAddressLongitude float64
+
+	// filled in from DeviceUserAgent by a useragent.Parser
+	Browser        string
+	BrowserVersion string
+	OS             string
+	OSVersion      string
+
+	// set only by SessionService.Impersonate
+	ImpersonatedBy         string
+	ImpersonationReason    string
+	ImpersonationExpiresAt string // RFC 3339
+}
+
+// DeviceName describes the device for people, e.g. "Chrome on macOS". It
+// is empty when neither the browser nor the OS is known.
+func (c SessionClaims) DeviceName() string {
+	switch {
+	case c.Browser != "" && c.OS != "":
+		return c.Browser + " on " + c.OS
+	case c.Browser != "":
+		return c.Browser
+	default:
+		return c.OS
+	}
+}
+
+// EventData flattens the device claims into hook event data, e.g. for the
+// session.signed_in event. SessionClaimsFromEventData reads them back.
+func (c SessionClaims) EventData() map[string]any {
+	return map[string]any{
+		"device_ip_address":    c.DeviceIPAddress,
+		"device_user_agent":    c.DeviceUserAgent,
+		"device_type":          c.DeviceType,
+		"device_name":          c.DeviceName(),
+		"ip_address_city":      c.IPAddressCity,
+		"ip_address_country":   c.IPAddressCountry,
+		"ip_address_asn":       c.IPAddressASN,
+		"ip_address_as_org":    c.IPAddressASOrg,
+		"ip_address_latitude":  c.IPAddressLatitude,
+		"ip_address_longitude": c.IPAddressLongitude,
+		"browser":              c.Browser,
+		"browser_version":      c.BrowserVersion,
+		"os":                   c.OS,
+		"os_version":           c.OSVersion,
+	}
+}
+
+func SessionClaimsFromEventData(data map[string]any) SessionClaims {
+	str := func(k string) string { v, _ := data[k].(string); return v }
+	num := func(k string) float64 { v, _ := data[k].(float64); return v }
+	asn, _ := data["ip_address_asn"].(uint)
+
+	return SessionClaims{
+		DeviceIPAddress:    str("device_ip_address"),
+		DeviceUserAgent:    str("device_user_agent"),
+		DeviceType:         str("device_type"),
+		IPAddressCity:      str("ip_address_city"),
+		IPAddressCountry:   str("ip_address_country"),
+		IPAddressASN:       asn,
+		IPAddressASOrg:     str("ip_address_as_org"),
+		IPAddressLatitude:  num("ip_address_latitude"),
+		IPAddressLongitude: num("ip_address_longitude"),
+		Browser:            str("browser"),
+		BrowserVersion:     str("browser_version"),
+		OS:                 str("os"),
+		OSVersion:          str("os_version"),
+	}
 }
@@ -0,0 +1,37 @@
+package dto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionClaims_EventData(t *testing.T) {
+	c := SessionClaims{
+		DeviceIPAddress:    "81.2.69.142",
+		DeviceUserAgent:    "Mozilla/5.0",
+		DeviceType:         DeviceTypeDesktop,
+		IPAddressCity:      "London",
+		IPAddressCountry:   "GB",
+		IPAddressASN:       20712,
+		IPAddressLatitude:  51.5142,
+		IPAddressLongitude: -0.0931,
+		Browser:            "Chrome",
+		OS:                 "macOS",
+		ImpersonatedBy:     "admin-1",
+	}
+
+	data := c.EventData()
+	assert.Equal(t, "Chrome on macOS", data["device_name"])
+	assert.NotContains(t, data, "ImpersonatedBy")
+
+	c.ImpersonatedBy = ""
+	assert.Equal(t, c, SessionClaimsFromEventData(data))
+}
+
+func TestSessionClaims_DeviceName(t *testing.T) {
+	assert.Equal(t, "Chrome on macOS", SessionClaims{Browser: "Chrome", OS: "macOS"}.DeviceName())
+	assert.Equal(t, "Chrome", SessionClaims{Browser: "Chrome"}.DeviceName())
+	assert.Equal(t, "macOS", SessionClaims{OS: "macOS"}.DeviceName())
+	assert.Equal(t, "", SessionClaims{}.DeviceName())
+}
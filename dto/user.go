@@ -23,7 +23,8 @@ type (
 		Locale                  string `json:"locale"`
 	}
 
-	User struct {
+	// UserOf is a user whose trusted metadata decodes into the schema M.
+	UserOf[M Metadata] struct {
 		UserID            string
 		SytstemUserID     string
 		FirstName         *string
@@ -38,46 +39,108 @@ type (
 		PasswordIsEnabled bool
 		TotpIsEnabled     bool
 		IsAccountActive   bool
+		IsSuspended       bool
 		ReferralCode      string
+		ReferredBy        *string
 		EmailAddresses    []Email
 		OAuthAccounts     []OAuthAccount
-		TrustedMetadata   TrustedMetadata
+		TrustedMetadata   M
 		CreatedAt         time.Time
 		UpdatedAt         time.Time
 	}
+
+	// User is a user with the default TrustedMetadata schema.
+	User = UserOf[TrustedMetadata]
 )
 
+// Untyped returns the user with the default schema. Only the system fields
+// of a custom schema carry over.
+func (u UserOf[M]) Untyped() User {
+	if user, ok := any(u).(User); ok {
+		return user
+	}
+
+	return User{
+		UserID:            u.UserID,
+		SytstemUserID:     u.SytstemUserID,
+		FirstName:         u.FirstName,
+		MiddleName:        u.MiddleName,
+		LastName:          u.LastName,
+		FullName:          u.FullName,
+		Email:             u.Email,
+		PhoneNumber:       u.PhoneNumber,
+		TotpId:            u.TotpId,
+		EmailIsVerified:   u.EmailIsVerified,
+		PhoneIsVerified:   u.PhoneIsVerified,
+		PasswordIsEnabled: u.PasswordIsEnabled,
+		TotpIsEnabled:     u.TotpIsEnabled,
+		IsAccountActive:   u.IsAccountActive,
+		IsSuspended:       u.IsSuspended,
+		ReferralCode:      u.ReferralCode,
+		ReferredBy:        u.ReferredBy,
+		EmailAddresses:    u.EmailAddresses,
+		OAuthAccounts:     u.OAuthAccounts,
+		TrustedMetadata:   TrustedMetadata{SystemMetadata: u.TrustedMetadata.System()},
+		CreatedAt:         u.CreatedAt,
+		UpdatedAt:         u.UpdatedAt,
+	}
+}
+
+// ConvertStytchUserToUser converts leniently, dropping trusted metadata
+// fields that do not decode. Use ConvertStytchUser to learn about them.
 func ConvertStytchUserToUser(user users.User) User {
+	u, _ := ConvertStytchUser(user)
+	return u
+}
+
+// ConvertStytchUser converts a Stytch user, returning a *MetadataError
+// alongside the leniently converted user when trusted metadata has fields
+// that do not decode.
+func ConvertStytchUser(user users.User) (User, error) {
+	return ConvertStytchUserOf[TrustedMetadata](user)
+}
+
+// ConvertStytchUserOf is ConvertStytchUser for an application metadata schema.
+func ConvertStytchUserOf[M Metadata](user users.User) (UserOf[M], error) {
 	var (
 		converter                                 = converter{stytch: &user}
-		metadata                                  = converter.getTrustedMetadata()
+		metadata, problems                        = getTrustedMetadata[M](&converter)
+		system                                    = metadata.System()
 		totpIsEnabled, totpIdOrHash               = converter.getTOTP()
 		email, emailIsVerified                    = converter.getPrimaryEmail()
 		nameFirst, nameMiddle, nameLast, nameFull = converter.getNames()
 	)
 
-	return User{
+	u := UserOf[M]{
 		UserID:            user.UserID,
-		SytstemUserID:     metadata.SystemUserID,
+		SytstemUserID:     system.SystemUserID,
 		FirstName:         nameFirst,
 		MiddleName:        nameMiddle,
 		LastName:          nameLast,
 		FullName:          nameFull,
 		Email:             email,
-		PhoneNumber:       metadata.UserPhoneNumber,
+		PhoneNumber:       system.UserPhoneNumber,
 		TotpId:            totpIdOrHash,
 		EmailIsVerified:   emailIsVerified,
-		PhoneIsVerified:   converter.getIsPhoneVerifiedFromMetadata(metadata.UserPhoneNumber),
+		PhoneIsVerified:   converter.getIsPhoneVerifiedFromMetadata(system.UserPhoneNumber),
 		PasswordIsEnabled: converter.getIsPasswordEnabled(),
 		TotpIsEnabled:     totpIsEnabled,
 		IsAccountActive:   converter.getIsAccountActive(),
-		ReferralCode:      metadata.SystemUserID,
+		IsSuspended:       system.Suspended,
+		ReferralCode:      system.SystemUserID,
+		ReferredBy:        system.ReferredBy,
 		EmailAddresses:    converter.getEmailAddresses(),
 		OAuthAccounts:     converter.getOAuth(),
-		TrustedMetadata:   converter.getTrustedMetadata(),
+		TrustedMetadata:   metadata,
 		CreatedAt:         converter.getCreatedAt(),
 		UpdatedAt:         converter.getUpdatedAt(),
 	}
+
+	if len(problems) > 0 {
+		return u, &MetadataError{UserID: user.UserID, Problems: problems}
+	}
+
+	return u, nil
 }
 
 type converter struct {
@@ -123,17 +186,15 @@ func (e *converter) getPrimaryEmail() (*string, bool) {
 	return &e.stytch.Emails[0].Email, e.stytch.Emails[0].Verified
 }
 
-func (e *converter) getTrustedMetadata() TrustedMetadata {
+// getTrustedMetadata is a function rather than a method because methods
+// cannot have type parameters.
+func getTrustedMetadata[M Metadata](e *converter) (M, []MetadataProblem) {
 	if len(e.stytch.TrustedMetadata) == 0 || e.stytch.TrustedMetadata == nil {
-		return TrustedMetadata{}
-	}
-
-	metadata, err := DecodeFromXToX[TrustedMetadata](e.stytch.TrustedMetadata, true)
-	if err != nil {
-		panic(err)
+		var zero M
+		return zero, nil
 	}
 
-	return *metadata
+	return DecodeMetadata[M](e.stytch.TrustedMetadata)
 }
 
 func (e *converter) getCreatedAt() time.Time {
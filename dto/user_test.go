@@ -10,20 +10,22 @@ import (
 
 var testMetadata, testMetadataMap = func() (TrustedMetadata, map[string]any) {
 	testTrustedMetadata := TrustedMetadata{
-		SystemUserID:      "12345TRE",
-		UserRole:          "customer",
-		UserPhoneNumber:   toPointer("+1234567890"),
+		SystemMetadata: SystemMetadata{
+			SystemUserID:    "12345TRE",
+			UserRole:        "customer",
+			UserPhoneNumber: toPointer("+1234567890"),
+			PinHash:         nil,
+		},
 		UserProfileImage:  nil,
 		NotificationEmail: false,
 		NotificationPush:  false,
 		NotificationSMS:   false,
 		NotificationInApp: false,
-		PinHash:           nil,
 		WebhookURL:        nil,
 	}
 
-	m, _ := DecodeFromXToX[map[string]any](testTrustedMetadata, false)
-	return testTrustedMetadata, *m
+	m, _ := testTrustedMetadata.ToMap()
+	return testTrustedMetadata, m
 }()
 
 var testUser = users.User{
@@ -102,3 +104,31 @@ func TestConvertStytchUserToUser(t *testing.T) {
 	want.UpdatedAt = got.UpdatedAt
 	assert.Equal(t, got, want)
 }
+
+func TestConvertStytchUser_MalformedMetadata(t *testing.T) {
+	malformed := testUser
+	malformed.TrustedMetadata = map[string]any{
+		"system_user_id": "12345TRE",
+		"user_role":      []any{"admin", "customer"},
+	}
+
+	assert.NotPanics(t, func() { ConvertStytchUserToUser(malformed) })
+
+	got, err := ConvertStytchUser(malformed)
+
+	var me *MetadataError
+	assert.ErrorIs(t, err, ErrInvalidMetadata)
+	assert.ErrorAs(t, err, &me)
+	assert.Equal(t, "user_role", me.Problems[0].Field)
+	assert.Equal(t, "12345TRE", got.SytstemUserID)
+	assert.True(t, me.System())
+
+	malformed.TrustedMetadata = map[string]any{"system_user_id": "12345TRE", "notification_sms": "often"}
+	_, err = ConvertStytchUser(malformed)
+	if assert.ErrorAs(t, err, &me) {
+		assert.False(t, me.System(), "an application field")
+	}
+	assert.NoError(t, LenientMetadata(err))
+	assert.ErrorIs(t, LenientMetadata(&MetadataError{Problems: []MetadataProblem{{Field: "suspended"}}}), ErrInvalidMetadata)
+	assert.NoError(t, LenientMetadata(nil))
+}
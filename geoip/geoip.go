@@ -0,0 +1,231 @@
+// Package geoip looks up IP addresses in local MaxMind-format (MMDB)
+// databases, such as GeoLite2 City and ASN, and fills in session claims
+// from them.
+package geoip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+var ErrNoDatabase = errors.New("geoip: no database path given")
+
+// Location is what the databases know about an address. Fields a database
+// does not carry are left empty.
+type Location struct {
+	City      string
+	Country   string // ISO 3166-1 alpha-2
+	ASN       uint
+	ASOrg     string
+	Latitude  float64
+	Longitude float64
+}
+
+// record covers the GeoIP2/GeoLite2 City, Country and ASN layouts, so one
+// struct reads both separate and combined databases.
+type record struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// DB looks addresses up in one or more MMDB files, e.g. a City and an ASN
+// database. The files can be swapped on disk and picked up with Reload or
+// Watch without a restart.
+type DB struct {
+	paths []string
+
+	mu      sync.RWMutex
+	readers []*maxminddb.Reader
+	modTime []time.Time
+}
+
+// Open opens the databases at paths. Earlier databases win when two know
+// the same field.
+func Open(paths ...string) (*DB, error) {
+	if len(paths) == 0 {
+		return nil, ErrNoDatabase
+	}
+
+	db := &DB{paths: paths}
+	if err := db.Reload(); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Reload reopens every database. On error the databases already loaded
+// stay in use.
+func (db *DB) Reload() error {
+	readers := make([]*maxminddb.Reader, 0, len(db.paths))
+	modTime := make([]time.Time, 0, len(db.paths))
+
+	for _, path := range db.paths {
+		r, fi, err := open(path)
+		if err != nil {
+			closeAll(readers)
+			return err
+		}
+
+		readers = append(readers, r)
+		modTime = append(modTime, fi.ModTime())
+	}
+
+	db.mu.Lock()
+	old := db.readers
+	db.readers, db.modTime = readers, modTime
+	db.mu.Unlock()
+
+	// no lookup can still hold the old readers once the lock was taken
+	closeAll(old)
+	return nil
+}
+
+// Watch checks the files every interval and reloads when one of them
+// changed, until ctx is done. Failed reloads are passed to onError, which
+// may be nil; the previous databases stay in use.
+func (db *DB) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !db.changed() {
+				continue
+			}
+			if err := db.Reload(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+func (db *DB) changed() bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for i, path := range db.paths {
+		fi, err := os.Stat(path)
+		if err == nil && !fi.ModTime().Equal(db.modTime[i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	closeAll(db.readers)
+	db.readers = nil
+	return nil
+}
+
+// Lookup returns what the databases know about ip. An address none of
+// them knows gives an empty Location and no error.
+func (db *DB) Lookup(ip net.IP) (Location, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var loc Location
+	for _, r := range db.readers {
+		var rec record
+		if err := r.Lookup(ip, &rec); err != nil {
+			return Location{}, err
+		}
+
+		if loc.City == "" {
+			loc.City = rec.City.Names["en"]
+		}
+		if loc.Country == "" {
+			loc.Country = rec.Country.ISOCode
+		}
+		if loc.ASN == 0 {
+			loc.ASN, loc.ASOrg = rec.ASN, rec.ASOrg
+		}
+		if rec.Location.Latitude != nil && rec.Location.Longitude != nil && loc.Latitude == 0 && loc.Longitude == 0 {
+			loc.Latitude, loc.Longitude = *rec.Location.Latitude, *rec.Location.Longitude
+		}
+	}
+
+	return loc, nil
+}
+
+// EnrichClaims fills the location claims of c from c.DeviceIPAddress. Claims
+// the caller set are kept, and addresses that cannot be parsed or looked up
+// leave c unchanged. DB satisfies session.ClaimsEnricher.
+func (db *DB) EnrichClaims(ctx context.Context, c *dto.SessionClaims) {
+	ip := net.ParseIP(c.DeviceIPAddress)
+	if ip == nil {
+		return
+	}
+
+	loc, err := db.Lookup(ip)
+	if err != nil {
+		return
+	}
+
+	if c.IPAddressCity == "" {
+		c.IPAddressCity = loc.City
+	}
+	if c.IPAddressCountry == "" {
+		c.IPAddressCountry = loc.Country
+	}
+	if c.IPAddressASN == 0 {
+		c.IPAddressASN, c.IPAddressASOrg = loc.ASN, loc.ASOrg
+	}
+	if c.IPAddressLatitude == 0 && c.IPAddressLongitude == 0 {
+		c.IPAddressLatitude, c.IPAddressLongitude = loc.Latitude, loc.Longitude
+	}
+}
+
+// open reads the whole file rather than mapping it, so a database being
+// rewritten in place cannot corrupt lookups in flight.
+func open(path string) (*maxminddb.Reader, os.FileInfo, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, err := maxminddb.FromBytes(b)
+	if err != nil {
+		return nil, nil, fmt.Errorf("geoip: %s: %w", path, err)
+	}
+
+	return r, fi, nil
+}
+
+func closeAll(readers []*maxminddb.Reader) {
+	for _, r := range readers {
+		_ = r.Close()
+	}
+}
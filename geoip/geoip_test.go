@@ -0,0 +1,107 @@
+package geoip
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testdata/test.mmdb holds 81.2.69.0/24 (London, GB, AS20712 with
+// coordinates) and 2c0f:f5c0::/32 (country NG only).
+const testDB = "testdata/test.mmdb"
+
+func TestDB_Lookup(t *testing.T) {
+	db, err := Open(testDB)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	testCases := []struct {
+		ip   string
+		want Location
+	}{
+		{"81.2.69.142", Location{City: "London", Country: "GB", ASN: 20712, ASOrg: "Andrews & Arnold Ltd", Latitude: 51.5142, Longitude: -0.0931}},
+		{"2c0f:f5c0::1", Location{Country: "NG"}},
+		{"10.0.0.1", Location{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ip, func(t *testing.T) {
+			got, err := db.Lookup(net.ParseIP(tc.ip))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDB_EnrichClaims(t *testing.T) {
+	db, err := Open(testDB)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	c := dto.SessionClaims{DeviceIPAddress: "81.2.69.142", IPAddressCity: "Camden"}
+	db.EnrichClaims(context.TODO(), &c)
+
+	assert.Equal(t, "Camden", c.IPAddressCity, "caller's claims are kept")
+	assert.Equal(t, "GB", c.IPAddressCountry)
+	assert.Equal(t, uint(20712), c.IPAddressASN)
+	assert.Equal(t, 51.5142, c.IPAddressLatitude)
+
+	c = dto.SessionClaims{DeviceIPAddress: "not an ip"}
+	db.EnrichClaims(context.TODO(), &c)
+	assert.Equal(t, dto.SessionClaims{DeviceIPAddress: "not an ip"}, c)
+}
+
+func TestDB_Reload(t *testing.T) {
+	_, err := Open()
+	assert.ErrorIs(t, err, ErrNoDatabase)
+
+	src, err := os.ReadFile(testDB)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	path := filepath.Join(t.TempDir(), "geo.mmdb")
+	assert.NoError(t, os.WriteFile(path, []byte("not a database"), 0o644))
+
+	_, err = Open(path)
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(path, src, 0o644))
+	db, err := Open(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	// a broken file leaves the loaded database in use
+	assert.NoError(t, os.WriteFile(path, []byte("not a database"), 0o644))
+	assert.Error(t, db.Reload())
+
+	loc, err := db.Lookup(net.ParseIP("81.2.69.142"))
+	assert.NoError(t, err)
+	assert.Equal(t, "GB", loc.Country)
+
+	// Watch picks up a fixed file
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reloadErrs := make(chan error, 10)
+	go db.Watch(ctx, 10*time.Millisecond, func(err error) { reloadErrs <- err })
+
+	assert.NoError(t, os.WriteFile(path, src, 0o644))
+	assert.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)))
+
+	assert.Eventually(t, func() bool { return !db.changed() }, time.Second, 10*time.Millisecond)
+	assert.Empty(t, reloadErrs)
+}
@@ -0,0 +1,96 @@
+package hook
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	// EventReferralAccepted fires once a referred user completes signup.
+	// UserID is the referrer, Data["referred_user_id"] the new user.
+	EventReferralAccepted EventType = "referral.accepted"
+
+	// EventUserDeleted fires after a user is erased, so apps can purge
+	// their own records for UserID.
+	EventUserDeleted           EventType = "user.deleted"
+	EventUserDeletionScheduled EventType = "user.deletion_scheduled"
+	EventUserDeletionCancelled EventType = "user.deletion_cancelled"
+
+	// EventSignedIn fires after a successful SignIn. Data carries the
+	// session_id and the session's device claims, see
+	// dto.SessionClaims.EventData.
+	EventSignedIn EventType = "session.signed_in"
+	// EventNewDeviceSignIn fires when a sign-in comes from a device and
+	// location the user was not seen on before; see package signinalert.
+	EventNewDeviceSignIn EventType = "session.new_device"
+	// EventSessionDisowned fires when a user says a session "wasn't me"
+	// and it is revoked.
+	EventSessionDisowned EventType = "session.disowned"
+	// EventRiskDetected fires when risk.Monitor finds a session suspicious.
+	// Data carries the session_id, score, action and findings.
+	EventRiskDetected EventType = "session.risk_detected"
+	// EventPasswordChanged fires after ResetPassword or UpdatePassword.
+	EventPasswordChanged EventType = "user.password_changed"
+	// EventPinLocked fires when CustomService.VerifyPin locks a transaction
+	// PIN after too many wrong attempts. Data carries the attempts and
+	// locked_until.
+	EventPinLocked EventType = "user.pin_locked"
+)
+
+type Event struct {
+	Type       EventType
+	UserID     string
+	OccurredAt time.Time
+	Data       map[string]any
+}
+
+// Handler reacts to an event. Handlers run synchronously on the caller's
+// goroutine, so anything slow should be handed off.
+type Handler func(ctx context.Context, e Event)
+
+// Hooks fans events out to the handlers registered for their type. A nil
+// *Hooks is valid and drops every event.
+type Hooks struct {
+	mu       sync.RWMutex
+	handlers map[EventType][]Handler
+}
+
+func New() *Hooks {
+	return &Hooks{handlers: map[EventType][]Handler{}}
+}
+
+// On registers fn for events of type t.
+func (h *Hooks) On(t EventType, fn Handler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.handlers[t] = append(h.handlers[t], fn)
+}
+
+// OnAny registers fn for every event type.
+func (h *Hooks) OnAny(fn Handler) {
+	h.On(anyEvent, fn)
+}
+
+const anyEvent EventType = "*"
+
+func (h *Hooks) Emit(ctx context.Context, e Event) {
+	if h == nil {
+		return
+	}
+
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now()
+	}
+
+	h.mu.RLock()
+	handlers := append(append([]Handler{}, h.handlers[e.Type]...), h.handlers[anyEvent]...)
+	h.mu.RUnlock()
+
+	for _, fn := range handlers {
+		fn(ctx, e)
+	}
+}
@@ -0,0 +1,34 @@
+package hook
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHooks_Emit(t *testing.T) {
+	var (
+		h        = New()
+		got      []Event
+		anyCount int
+	)
+
+	h.On(EventReferralAccepted, func(_ context.Context, e Event) { got = append(got, e) })
+	h.OnAny(func(context.Context, Event) { anyCount++ })
+
+	h.Emit(context.TODO(), Event{Type: EventReferralAccepted, UserID: "referrer"})
+	h.Emit(context.TODO(), Event{Type: "other"})
+
+	assert.Len(t, got, 1)
+	assert.Equal(t, "referrer", got[0].UserID)
+	assert.False(t, got[0].OccurredAt.IsZero())
+	assert.Equal(t, 2, anyCount)
+}
+
+func TestHooks_NilIsNoop(t *testing.T) {
+	var h *Hooks
+	assert.NotPanics(t, func() {
+		h.Emit(context.TODO(), Event{Type: EventReferralAccepted})
+	})
+}
@@ -0,0 +1,159 @@
+package idgen
+
+import (
+	"errors"
+	"strings"
+
+	gonanoid "github.com/matoous/go-nanoid"
+)
+
+const (
+	DefaultAlphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+	DefaultLength   = 10
+)
+
+var ErrInvalidAlphabet = errors.New("idgen: alphabet must have at least two unique characters")
+
+// Generator produces a new identifier each time it is called.
+type Generator interface {
+	Generate() (string, error)
+}
+
+// GeneratorFunc adapts an ordinary function to the Generator interface.
+type GeneratorFunc func() (string, error)
+
+func (f GeneratorFunc) Generate() (string, error) {
+	return f()
+}
+
+// NanoID generates random ids from an alphabet, optionally prefixed and
+// suffixed with a Luhn mod N check character.
+type NanoID struct {
+	alphabet   string
+	length     int
+	prefix     string
+	checkDigit bool
+}
+
+type Option func(*NanoID)
+
+func WithAlphabet(alphabet string) Option {
+	return func(n *NanoID) { n.alphabet = alphabet }
+}
+
+func WithLength(length int) Option {
+	return func(n *NanoID) { n.length = length }
+}
+
+func WithPrefix(prefix string) Option {
+	return func(n *NanoID) { n.prefix = prefix }
+}
+
+// WithCheckDigit appends a check character so mistyped ids can be detected
+// with Validate before hitting the provider.
+func WithCheckDigit() Option {
+	return func(n *NanoID) { n.checkDigit = true }
+}
+
+func NewNanoID(opts ...Option) *NanoID {
+	n := &NanoID{
+		alphabet: DefaultAlphabet,
+		length:   DefaultLength,
+	}
+
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	return n
+}
+
+// Default mirrors the format system user ids have always had.
+var Default Generator = NewNanoID()
+
+func (n *NanoID) Generate() (string, error) {
+	if !validAlphabet(n.alphabet) {
+		return "", ErrInvalidAlphabet
+	}
+
+	id, err := gonanoid.Generate(n.alphabet, n.length)
+	if err != nil {
+		return "", err
+	}
+
+	if n.checkDigit {
+		id += string(n.alphabet[luhnModN(n.alphabet, id)])
+	}
+
+	return n.prefix + id, nil
+}
+
+// Validate reports whether id has the shape this generator produces,
+// including a correct check character when enabled.
+func (n *NanoID) Validate(id string) bool {
+	if !strings.HasPrefix(id, n.prefix) {
+		return false
+	}
+	id = strings.TrimPrefix(id, n.prefix)
+
+	want := n.length
+	if n.checkDigit {
+		want++
+	}
+	if len(id) != want {
+		return false
+	}
+
+	for i := range id {
+		if strings.IndexByte(n.alphabet, id[i]) < 0 {
+			return false
+		}
+	}
+
+	if !n.checkDigit {
+		return true
+	}
+
+	body, check := id[:len(id)-1], id[len(id)-1]
+	return n.alphabet[luhnModN(n.alphabet, body)] == check
+}
+
+// luhnModN returns the index in alphabet of the check character for s.
+// Ref: https://en.wikipedia.org/wiki/Luhn_mod_N_algorithm
+func luhnModN(alphabet, s string) int {
+	var (
+		base   = len(alphabet)
+		factor = 2
+		sum    = 0
+	)
+
+	for i := len(s) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(alphabet, s[i])
+		addend = addend/base + addend%base
+		sum += addend
+
+		if factor == 2 {
+			factor = 1
+		} else {
+			factor = 2
+		}
+	}
+
+	return (base - sum%base) % base
+}
+
+func validAlphabet(alphabet string) bool {
+	if len(alphabet) < 2 {
+		return false
+	}
+
+	seen := make(map[byte]bool, len(alphabet))
+	for i := range alphabet {
+		if seen[alphabet[i]] {
+			return false
+		}
+		seen[alphabet[i]] = true
+	}
+
+	return true
+}
@@ -0,0 +1,72 @@
+package idgen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNanoID_Generate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		gen     *NanoID
+		wantLen int
+		prefix  string
+	}{
+		{name: "default", gen: NewNanoID(), wantLen: DefaultLength},
+		{name: "prefix", gen: NewNanoID(WithPrefix("usr_")), wantLen: DefaultLength + 4, prefix: "usr_"},
+		{name: "length", gen: NewNanoID(WithLength(16)), wantLen: 16},
+		{name: "check digit", gen: NewNanoID(WithCheckDigit()), wantLen: DefaultLength + 1},
+		{
+			name:    "custom alphabet",
+			gen:     NewNanoID(WithAlphabet("ABCDEFGH"), WithLength(6), WithPrefix("R-"), WithCheckDigit()),
+			wantLen: 9,
+			prefix:  "R-",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := tc.gen.Generate()
+
+			assert.NoError(t, err)
+			assert.Len(t, id, tc.wantLen)
+			assert.True(t, strings.HasPrefix(id, tc.prefix))
+			assert.True(t, tc.gen.Validate(id))
+		})
+	}
+}
+
+func TestNanoID_GenerateIsUnique(t *testing.T) {
+	gen := NewNanoID()
+	seen := map[string]bool{}
+
+	for i := 0; i < 1000; i++ {
+		id, err := gen.Generate()
+		assert.NoError(t, err)
+		assert.False(t, seen[id], "duplicate id %s", id)
+		seen[id] = true
+	}
+}
+
+func TestNanoID_Validate(t *testing.T) {
+	gen := NewNanoID(WithCheckDigit())
+
+	id, err := gen.Generate()
+	assert.NoError(t, err)
+
+	// flip the first character to another alphabet member
+	c := strings.IndexByte(DefaultAlphabet, id[0])
+	typo := string(DefaultAlphabet[(c+1)%len(DefaultAlphabet)]) + id[1:]
+
+	assert.True(t, gen.Validate(id))
+	assert.False(t, gen.Validate(typo))
+	assert.False(t, gen.Validate(id[:len(id)-1]))
+	assert.False(t, gen.Validate(strings.ToUpper(id)+"!"))
+}
+
+func TestNanoID_InvalidAlphabet(t *testing.T) {
+	_, err := NewNanoID(WithAlphabet("aa")).Generate()
+	assert.ErrorIs(t, err, ErrInvalidAlphabet)
+}
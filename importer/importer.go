@@ -0,0 +1,369 @@
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/idgen"
+	"github.com/otyang/go-authsvc/migrate"
+	"github.com/otyang/go-authsvc/user"
+
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/passwords"
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/stytchapi"
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/users"
+)
+
+var (
+	ErrEmailRequired       = errors.New("email required")
+	ErrHashRequired        = errors.New("password_hash required")
+	ErrUnsupportedHashType = errors.New("unsupported hash_type")
+	ErrHashParamsRequired  = errors.New("hash parameters required")
+)
+
+// Importer creates users from legacy password hashes through Stytch's
+// password migrate endpoint.
+type Importer struct {
+	client         *stytchapi.API
+	userSvc        *user.UserService
+	idGen          idgen.Generator
+	migrations     *migrate.Registry
+	dryRun         bool
+	checkpointPath string
+	report         io.Writer
+}
+
+type Option func(*Importer)
+
+// WithDryRun validates every row without creating users.
+func WithDryRun() Option {
+	return func(im *Importer) { im.dryRun = true }
+}
+
+// WithCheckpoint records progress in path after every row, so an
+// interrupted run can be restarted: rows imported before are skipped and
+// rows that failed are tried again.
+func WithCheckpoint(path string) Option {
+	return func(im *Importer) { im.checkpointPath = path }
+}
+
+// WithReport writes a CSV line (line,email,error) for every failed row.
+func WithReport(w io.Writer) Option {
+	return func(im *Importer) { im.report = w }
+}
+
+// WithUserService shares a configured UserService, so imported users'
+// metadata is seeded with its locks, migrations and audit log.
+func WithUserService(svc *user.UserService) Option {
+	return func(im *Importer) { im.userSvc = svc }
+}
+
+// WithMigrations stamps imported users with the registry's latest schema
+// version, as signup does, so they are not migrated from version 0.
+func WithMigrations(r *migrate.Registry) Option {
+	return func(im *Importer) { im.migrations = r }
+}
+
+func WithIDGenerator(gen idgen.Generator) Option {
+	return func(im *Importer) { im.idGen = gen }
+}
+
+func New(client *stytchapi.API, opts ...Option) *Importer {
+	im := &Importer{
+		client: client,
+		idGen:  idgen.Default,
+	}
+
+	for _, opt := range opts {
+		opt(im)
+	}
+
+	if im.userSvc == nil {
+		im.userSvc = user.NewUserService(client)
+	}
+
+	return im
+}
+
+type Summary struct {
+	Imported int
+	// Skipped rows were done by an earlier run, per the checkpoint.
+	Skipped int
+	Failed  int
+}
+
+// Run imports every record from src. Row failures are counted and
+// reported rather than stopping the run; the returned error is for
+// failures that make carrying on pointless.
+func (im *Importer) Run(ctx context.Context, src Reader) (Summary, error) {
+	var (
+		sum    Summary
+		report *csv.Writer
+	)
+
+	cp, err := im.readCheckpoint()
+	if err != nil {
+		return sum, err
+	}
+
+	if im.report != nil {
+		report = csv.NewWriter(im.report)
+		_ = report.Write([]string{"line", "email", "error"})
+		defer report.Flush()
+	}
+
+	taken := map[string]bool{}
+	if !im.dryRun {
+		it := im.userSvc.Iterate(user.SearchParams{})
+		for it.Next(ctx) {
+			taken[it.User().SytstemUserID] = true
+		}
+		if err := it.Err(); err != nil {
+			return sum, err
+		}
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return sum, err
+		}
+
+		rec, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			return sum, nil
+		}
+
+		// without a line the reader cannot go on, e.g. an unreadable header
+		if err != nil && rec.Line == 0 {
+			return sum, err
+		}
+
+		if rec.Line <= cp.Line && !cp.failed(rec.Line) {
+			sum.Skipped++
+			continue
+		}
+
+		if err == nil {
+			err = im.importRecord(ctx, rec, taken)
+		}
+
+		if err != nil {
+			sum.Failed++
+			if report != nil {
+				_ = report.Write([]string{strconv.Itoa(rec.Line), rec.Email, err.Error()})
+			}
+		} else {
+			sum.Imported++
+		}
+
+		cp.record(rec.Line, err == nil)
+		if err := im.writeCheckpoint(cp); err != nil {
+			return sum, err
+		}
+	}
+}
+
+func (im *Importer) importRecord(ctx context.Context, rec Record, taken map[string]bool) error {
+	params, err := migrateParams(rec)
+	if err != nil {
+		return err
+	}
+
+	systemUserID, err := user.UniqueSystemUserID(im.idGen, taken)
+	if err != nil {
+		return err
+	}
+
+	tm, err := recordMetadata(rec, systemUserID, im.migrations.Latest())
+	if err != nil {
+		return err
+	}
+
+	if im.dryRun {
+		return nil
+	}
+
+	resp, err := im.client.Passwords.Migrate(ctx, params)
+	if err != nil {
+		return dto.HandleError(err)
+	}
+
+	// seeded rather than migrated, so an existing user keeps their metadata
+	_, err = im.userSvc.SeedTrustedMetadata(ctx, resp.UserID, tm)
+	return err
+}
+
+// recordMetadata is the trusted metadata of a new user from rec. System
+// keys in rec.Metadata, such as user_role or suspended, are dropped: a
+// source file does not get to make admins.
+func recordMetadata(rec Record, systemUserID string, schemaVersion int) (map[string]any, error) {
+	metadata := dto.NewTrustedMetadata(systemUserID)
+	metadata.SchemaVersion = schemaVersion
+	if rec.PhoneNumber != "" {
+		metadata.UserPhoneNumber = &rec.PhoneNumber
+	}
+
+	tm, err := metadata.ToMap()
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range rec.Metadata {
+		if !dto.IsSystemKey(k) {
+			tm[k] = v
+		}
+	}
+
+	return tm, nil
+}
+
+// migrateParams validates rec and maps it onto the migrate request.
+func migrateParams(rec Record) (*passwords.MigrateParams, error) {
+	if rec.Email == "" {
+		return nil, ErrEmailRequired
+	}
+	if rec.PasswordHash == "" {
+		return nil, ErrHashRequired
+	}
+
+	p := &passwords.MigrateParams{
+		Email: rec.Email,
+		Hash:  rec.PasswordHash,
+	}
+
+	if rec.FirstName != "" || rec.MiddleName != "" || rec.LastName != "" {
+		p.Name = &users.Name{FirstName: rec.FirstName, MiddleName: rec.MiddleName, LastName: rec.LastName}
+	}
+
+	switch strings.ToLower(rec.HashType) {
+	case "bcrypt", "":
+		if !strings.HasPrefix(rec.PasswordHash, "$2") {
+			return nil, fmt.Errorf("%w: not a bcrypt hash", ErrUnsupportedHashType)
+		}
+		p.HashType = passwords.MigrateRequestHashTypeBcrypt
+
+	case "scrypt":
+		if rec.Salt == "" || rec.N == 0 || rec.R == 0 || rec.P == 0 || rec.KeyLength == 0 {
+			return nil, fmt.Errorf("%w: scrypt needs salt, n, r, p and key_length", ErrHashParamsRequired)
+		}
+		p.HashType = passwords.MigrateRequestHashTypeScrypt
+		p.ScryptConfig = &passwords.ScryptConfig{
+			Salt:       rec.Salt,
+			NParameter: rec.N,
+			RParameter: rec.R,
+			PParameter: rec.P,
+			KeyLength:  rec.KeyLength,
+		}
+
+	case "argon2i", "argon2id":
+		if rec.Salt == "" || rec.Iterations == 0 || rec.Memory == 0 || rec.Threads == 0 || rec.KeyLength == 0 {
+			return nil, fmt.Errorf("%w: argon2 needs salt, iterations, memory, threads and key_length", ErrHashParamsRequired)
+		}
+		p.HashType = passwords.MigrateRequestHashTypeArgon2i
+		if strings.EqualFold(rec.HashType, "argon2id") {
+			p.HashType = passwords.MigrateRequestHashTypeArgon2id
+		}
+		p.Argon2Config = &passwords.Argon2Config{
+			Salt:            rec.Salt,
+			IterationAmount: rec.Iterations,
+			Memory:          rec.Memory,
+			Threads:         rec.Threads,
+			KeyLength:       rec.KeyLength,
+		}
+
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedHashType, rec.HashType)
+	}
+
+	return p, nil
+}
+
+// checkpoint is the last line a run got to, and the lines before it that
+// failed, which a restarted run tries again.
+type checkpoint struct {
+	Line   int   `json:"line"`
+	Failed []int `json:"failed,omitempty"`
+}
+
+func (cp *checkpoint) failed(line int) bool {
+	for _, l := range cp.Failed {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
+
+func (cp *checkpoint) record(line int, ok bool) {
+	failed := cp.Failed[:0]
+	for _, l := range cp.Failed {
+		if l != line {
+			failed = append(failed, l)
+		}
+	}
+	if !ok {
+		failed = append(failed, line)
+	}
+	cp.Failed = failed
+
+	if line > cp.Line {
+		cp.Line = line
+	}
+}
+
+func (im *Importer) readCheckpoint() (checkpoint, error) {
+	var cp checkpoint
+	if im.checkpointPath == "" {
+		return cp, nil
+	}
+
+	b, err := os.ReadFile(im.checkpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return cp, err
+	}
+
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return cp, fmt.Errorf("checkpoint %s: %w", im.checkpointPath, err)
+	}
+
+	return cp, nil
+}
+
+// writeCheckpoint replaces the checkpoint atomically, so a crash mid write
+// never leaves it unreadable. Dry runs leave it alone.
+func (im *Importer) writeCheckpoint(cp checkpoint) error {
+	if im.checkpointPath == "" || im.dryRun {
+		return nil
+	}
+
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(im.checkpointPath), ".checkpoint-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), im.checkpointPath)
+}
@@ -0,0 +1,180 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/otyang/go-authsvc/idgen"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/passwords"
+)
+
+const testCSV = `email,first_name,last_name,phone_number,password_hash,hash_type,salt,n,r,p,key_length,meta.user_role,meta.legacy_id
+a@example.com,Ada,Obi,+2348000000001,$2a$10$abcdefghijklmnopqrstuv,bcrypt,,,,,,admin,101
+b@example.com,Bayo,,,c2NyeXB0,scrypt,salty,16384,8,1,32,,102
+,Nobody,,,$2a$10$x,bcrypt,,,,,,,103
+c@example.com,Chi,,,hash,md5,,,,,,,104
+`
+
+func TestCSVReader(t *testing.T) {
+	r := NewCSVReader(strings.NewReader(testCSV))
+
+	rec, err := r.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rec.Line)
+	assert.Equal(t, "a@example.com", rec.Email)
+	assert.Equal(t, "+2348000000001", rec.PhoneNumber)
+	assert.Equal(t, map[string]any{"user_role": "admin", "legacy_id": float64(101)}, rec.Metadata)
+
+	rec, err = r.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(16384), rec.N)
+	assert.Equal(t, int32(32), rec.KeyLength)
+}
+
+func TestJSONLReader(t *testing.T) {
+	src := `{"email":"a@example.com","password_hash":"$2a$10$x","metadata":{"user_role":"admin"}}
+
+not json
+{"email":"b@example.com","password_hash":"$2a$10$y"}`
+
+	var (
+		r     = NewJSONLReader(strings.NewReader(src))
+		lines []int
+		errs  int
+	)
+
+	for {
+		rec, err := r.Next()
+		if err != nil && rec.Line == 0 {
+			break
+		}
+		if err != nil {
+			errs++
+		}
+		lines = append(lines, rec.Line)
+	}
+
+	assert.Equal(t, []int{1, 3, 4}, lines)
+	assert.Equal(t, 1, errs)
+}
+
+func TestMigrateParams(t *testing.T) {
+	testCases := []struct {
+		name    string
+		rec     Record
+		wantErr error
+		want    passwords.MigrateRequestHashType
+	}{
+		{name: "bcrypt", rec: Record{Email: "a@x.io", PasswordHash: "$2b$10$abc"}, want: passwords.MigrateRequestHashTypeBcrypt},
+		{name: "not bcrypt", rec: Record{Email: "a@x.io", PasswordHash: "abc", HashType: "bcrypt"}, wantErr: ErrUnsupportedHashType},
+		{name: "no email", rec: Record{PasswordHash: "$2b$10$abc"}, wantErr: ErrEmailRequired},
+		{name: "no hash", rec: Record{Email: "a@x.io"}, wantErr: ErrHashRequired},
+		{name: "scrypt missing params", rec: Record{Email: "a@x.io", PasswordHash: "h", HashType: "scrypt"}, wantErr: ErrHashParamsRequired},
+		{
+			name: "argon2id",
+			rec:  Record{Email: "a@x.io", PasswordHash: "h", HashType: "ARGON2ID", Salt: "s", Iterations: 3, Memory: 65536, Threads: 4, KeyLength: 32},
+			want: passwords.MigrateRequestHashTypeArgon2id,
+		},
+		{name: "unsupported", rec: Record{Email: "a@x.io", PasswordHash: "h", HashType: "md5"}, wantErr: ErrUnsupportedHashType},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := migrateParams(tc.rec)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got.HashType)
+		})
+	}
+}
+
+func TestImporter_DryRun(t *testing.T) {
+	var report bytes.Buffer
+
+	im := New(nil, WithDryRun(), WithReport(&report), WithIDGenerator(idgen.NewNanoID()))
+
+	sum, err := im.Run(context.TODO(), NewCSVReader(strings.NewReader(testCSV)))
+
+	assert.NoError(t, err)
+	assert.Equal(t, Summary{Imported: 2, Failed: 2}, sum)
+	assert.Contains(t, report.String(), "3,,email required")
+	assert.Contains(t, report.String(), `4,c@example.com,"unsupported hash_type`)
+}
+
+func TestImporter_Checkpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "import.checkpoint")
+
+	im := New(nil, WithCheckpoint(path))
+	assert.NoError(t, im.writeCheckpoint(checkpoint{Line: 2}))
+
+	cp, err := im.readCheckpoint()
+	assert.NoError(t, err)
+	assert.Equal(t, checkpoint{Line: 2}, cp)
+
+	// resuming in dry run skips the rows already done and keeps the file
+	im = New(nil, WithCheckpoint(path), WithDryRun())
+	sum, err := im.Run(context.TODO(), NewCSVReader(strings.NewReader(testCSV)))
+
+	assert.NoError(t, err)
+	assert.Equal(t, Summary{Skipped: 2, Failed: 2}, sum)
+
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"line":2}`, string(b))
+
+	// failed rows are tried again
+	assert.NoError(t, New(nil, WithCheckpoint(path)).writeCheckpoint(checkpoint{Line: 4, Failed: []int{3}}))
+	sum, err = im.Run(context.TODO(), NewCSVReader(strings.NewReader(testCSV)))
+
+	assert.NoError(t, err)
+	assert.Equal(t, Summary{Skipped: 3, Failed: 1}, sum)
+}
+
+func TestCheckpoint_record(t *testing.T) {
+	var cp checkpoint
+
+	cp.record(1, true)
+	cp.record(2, false)
+	cp.record(3, true)
+	assert.Equal(t, checkpoint{Line: 3, Failed: []int{2}}, cp)
+
+	cp.record(2, true)
+	assert.Equal(t, 3, cp.Line)
+	assert.Empty(t, cp.Failed)
+}
+
+func TestImporter_empty(t *testing.T) {
+	im := New(nil, WithDryRun())
+
+	for _, src := range []Reader{NewCSVReader(strings.NewReader("")), NewJSONLReader(strings.NewReader(""))} {
+		sum, err := im.Run(context.TODO(), src)
+		assert.NoError(t, err)
+		assert.Equal(t, Summary{}, sum)
+	}
+}
+
+func TestRecordMetadata(t *testing.T) {
+	phone := "+2348000000001"
+
+	tm, err := recordMetadata(Record{
+		PhoneNumber: phone,
+		Metadata:    map[string]any{"user_role": "admin", "suspended": true, "system_user_id": "X", "legacy_id": 101.0},
+	}, "SYS1", 3)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "customer", tm["user_role"], "system keys are not imported")
+	assert.Equal(t, false, tm["suspended"])
+	assert.Equal(t, "SYS1", tm["system_user_id"])
+	assert.Equal(t, 3, tm["schema_version"], "stamped with the latest version, as signup does")
+	assert.Equal(t, &phone, tm["user_phone_number"])
+	assert.Equal(t, 101.0, tm["legacy_id"])
+}
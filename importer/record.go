@@ -0,0 +1,178 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Record is one legacy user. Metadata keys are written to trusted metadata
+// over the defaults, except SystemMetadata's keys, which are ignored; a
+// user that already exists keeps the values they have.
+type Record struct {
+	// Line is the 1-based data row in the source, used for checkpoints and
+	// the error report.
+	Line int `json:"-"`
+
+	Email        string `json:"email"`
+	FirstName    string `json:"first_name"`
+	MiddleName   string `json:"middle_name"`
+	LastName     string `json:"last_name"`
+	PhoneNumber  string `json:"phone_number"`
+	PasswordHash string `json:"password_hash"`
+	// HashType is bcrypt, scrypt, argon2i or argon2id.
+	HashType string `json:"hash_type"`
+
+	// scrypt and argon2 parameters
+	Salt       string `json:"salt"`
+	N          int32  `json:"n"`
+	R          int32  `json:"r"`
+	P          int32  `json:"p"`
+	Iterations int32  `json:"iterations"`
+	Memory     int32  `json:"memory"`
+	Threads    int32  `json:"threads"`
+	KeyLength  int32  `json:"key_length"`
+
+	Metadata map[string]any `json:"metadata"`
+}
+
+// Reader yields records until it returns io.EOF.
+type Reader interface {
+	Next() (Record, error)
+}
+
+type jsonlReader struct {
+	r    *bufio.Reader
+	line int
+}
+
+// NewJSONLReader reads one JSON object per line, with Record's field names
+// and a "metadata" object. Blank lines are skipped but still counted.
+func NewJSONLReader(r io.Reader) Reader {
+	return &jsonlReader{r: bufio.NewReader(r)}
+}
+
+func (j *jsonlReader) Next() (Record, error) {
+	for {
+		b, err := j.r.ReadBytes('\n')
+		if len(b) == 0 && err != nil {
+			return Record{}, err
+		}
+		j.line++
+
+		b = bytes.TrimSpace(b)
+		if len(b) == 0 {
+			continue
+		}
+
+		// each line decodes on its own, so one bad row does not end the file
+		rec := Record{}
+		if err := json.Unmarshal(b, &rec); err != nil {
+			return Record{Line: j.line}, fmt.Errorf("line %d: %w", j.line, err)
+		}
+
+		rec.Line = j.line
+		return rec, nil
+	}
+}
+
+type csvReader struct {
+	r      *csv.Reader
+	header []string
+	line   int
+}
+
+// NewCSVReader reads CSV with a header row naming Record's fields, e.g.
+// email,password_hash,hash_type. Columns named "meta.<key>" fill Metadata.
+func NewCSVReader(r io.Reader) Reader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	return &csvReader{r: cr}
+}
+
+func (c *csvReader) Next() (Record, error) {
+	if c.header == nil {
+		header, err := c.r.Read()
+		if errors.Is(err, io.EOF) {
+			// an empty file is an empty import
+			return Record{}, io.EOF
+		}
+		if err != nil {
+			return Record{}, fmt.Errorf("reading header: %w", err)
+		}
+		for i := range header {
+			header[i] = strings.TrimSpace(strings.ToLower(header[i]))
+		}
+		c.header = header
+	}
+
+	row, err := c.r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return Record{}, io.EOF
+		}
+		c.line++
+		return Record{Line: c.line}, fmt.Errorf("line %d: %w", c.line, err)
+	}
+	c.line++
+
+	rec := Record{Line: c.line}
+
+	for i, col := range c.header {
+		if i >= len(row) {
+			break
+		}
+		if err := rec.set(col, strings.TrimSpace(row[i])); err != nil {
+			return rec, fmt.Errorf("line %d: %w", c.line, err)
+		}
+	}
+
+	return rec, nil
+}
+
+func (r *Record) set(col, v string) error {
+	if key, ok := strings.CutPrefix(col, "meta."); ok {
+		if v == "" {
+			return nil
+		}
+		if r.Metadata == nil {
+			r.Metadata = map[string]any{}
+		}
+		var parsed any
+		if err := json.Unmarshal([]byte(v), &parsed); err != nil {
+			parsed = v
+		}
+		r.Metadata[key] = parsed
+		return nil
+	}
+
+	strs := map[string]*string{
+		"email": &r.Email, "first_name": &r.FirstName, "middle_name": &r.MiddleName,
+		"last_name": &r.LastName, "phone_number": &r.PhoneNumber,
+		"password_hash": &r.PasswordHash, "hash_type": &r.HashType, "salt": &r.Salt,
+	}
+	if p, ok := strs[col]; ok {
+		*p = v
+		return nil
+	}
+
+	ints := map[string]*int32{
+		"n": &r.N, "r": &r.R, "p": &r.P, "iterations": &r.Iterations,
+		"memory": &r.Memory, "threads": &r.Threads, "key_length": &r.KeyLength,
+	}
+	if p, ok := ints[col]; ok && v != "" {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return fmt.Errorf("%s: %w", col, err)
+		}
+		*p = int32(n)
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package inbox
+
+import (
+	"context"
+	"sync"
+
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/hook"
+	"github.com/otyang/go-authsvc/notify"
+)
+
+// subscriberBuffer is how many updates a slow subscriber may fall behind
+// before further ones are dropped for it.
+const subscriberBuffer = 16
+
+// Inbox wraps a Store and tells subscribers, such as open SSE streams,
+// about changes to a user's messages.
+type Inbox struct {
+	store Store
+
+	mu   sync.Mutex
+	subs map[string]map[chan Update]struct{}
+}
+
+// Update is sent to subscribers. Message is set for a new message and nil
+// when messages were marked read.
+type Update struct {
+	Message *Message
+}
+
+func New(store Store) *Inbox {
+	return &Inbox{
+		store: store,
+		subs:  map[string]map[chan Update]struct{}{},
+	}
+}
+
+func (i *Inbox) Add(ctx context.Context, m Message) (*Message, error) {
+	if err := i.store.Add(ctx, &m); err != nil {
+		return nil, err
+	}
+
+	i.publish(m.UserID, Update{Message: &m})
+	return &m, nil
+}
+
+func (i *Inbox) List(ctx context.Context, userID string, p ListParams) (*Page, error) {
+	return i.store.List(ctx, userID, p)
+}
+
+func (i *Inbox) UnreadCount(ctx context.Context, userID string) (int, error) {
+	return i.store.UnreadCount(ctx, userID)
+}
+
+func (i *Inbox) MarkRead(ctx context.Context, userID string, ids ...string) error {
+	if err := i.store.MarkRead(ctx, userID, ids...); err != nil {
+		return err
+	}
+
+	i.publish(userID, Update{})
+	return nil
+}
+
+func (i *Inbox) MarkAllRead(ctx context.Context, userID string) error {
+	if err := i.store.MarkAllRead(ctx, userID); err != nil {
+		return err
+	}
+
+	i.publish(userID, Update{})
+	return nil
+}
+
+// Subscribe returns a channel of updates for userID and a func that ends
+// the subscription and closes the channel.
+func (i *Inbox) Subscribe(userID string) (<-chan Update, func()) {
+	ch := make(chan Update, subscriberBuffer)
+
+	i.mu.Lock()
+	if i.subs[userID] == nil {
+		i.subs[userID] = map[chan Update]struct{}{}
+	}
+	i.subs[userID][ch] = struct{}{}
+	i.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			i.mu.Lock()
+			delete(i.subs[userID], ch)
+			if len(i.subs[userID]) == 0 {
+				delete(i.subs, userID)
+			}
+			i.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (i *Inbox) publish(userID string, u Update) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for ch := range i.subs[userID] {
+		select {
+		case ch <- u:
+		default:
+		}
+	}
+}
+
+// Sender adapts the inbox to a notify.Sender for the in-app channel.
+func (i *Inbox) Sender() notify.Sender {
+	return notify.SenderFunc(func(ctx context.Context, user dto.User, n notify.Notification) error {
+		_, err := i.Add(ctx, Message{
+			UserID:   user.UserID,
+			Category: n.Category,
+			Type:     n.Type,
+			Title:    n.Title,
+			Body:     n.Body,
+			Data:     n.Data,
+		})
+		return err
+	})
+}
+
+var attachedTitles = map[hook.EventType]string{
+	hook.EventSignedIn:        "New sign-in to your account",
+	hook.EventPasswordChanged: "Your password was changed",
+	hook.EventPinLocked:       "Your transaction PIN was locked",
+}
+
+// Attach writes a security message to the inbox for each sign-in, password
+// change and PIN lock reported on h. Passing types limits it to those, e.g.
+// to leave sign-ins to signinalert, which writes its own in-app message.
+func (i *Inbox) Attach(h *hook.Hooks, types ...hook.EventType) {
+	if len(types) == 0 {
+		for t := range attachedTitles {
+			types = append(types, t)
+		}
+	}
+
+	for _, t := range types {
+		title, ok := attachedTitles[t]
+		if !ok {
+			continue
+		}
+		h.On(t, func(ctx context.Context, e hook.Event) {
+			_, _ = i.Add(ctx, Message{
+				UserID:    e.UserID,
+				Category:  dto.CategorySecurity,
+				Type:      string(e.Type),
+				Title:     title,
+				Data:      e.Data,
+				CreatedAt: e.OccurredAt,
+			})
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package inbox
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/hook"
+	"github.com/otyang/go-authsvc/session"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+// testStore checks the behaviour every Store must share.
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 5; i++ {
+		err := s.Add(ctx, &Message{
+			UserID:    "user-1",
+			Title:     "message",
+			CreatedAt: base.Add(time.Duration(i) * time.Minute),
+			Data:      map[string]any{"n": float64(i)},
+		})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, s.Add(ctx, &Message{UserID: "user-2", Title: "other"}))
+
+	first, err := s.List(ctx, "user-1", ListParams{Limit: 3})
+	assert.NoError(t, err)
+	assert.Len(t, first.Messages, 3)
+	assert.NotEmpty(t, first.NextCursor)
+	assert.Equal(t, float64(4), first.Messages[0].Data["n"], "newest first")
+
+	second, err := s.List(ctx, "user-1", ListParams{Limit: 3, Cursor: first.NextCursor})
+	assert.NoError(t, err)
+	assert.Len(t, second.Messages, 2)
+	assert.Empty(t, second.NextCursor)
+	assert.Equal(t, float64(1), second.Messages[0].Data["n"])
+
+	_, err = s.List(ctx, "user-1", ListParams{Cursor: "not a cursor"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	n, err := s.UnreadCount(ctx, "user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	other, err := s.List(ctx, "user-2", ListParams{})
+	assert.NoError(t, err)
+	assert.Len(t, other.Messages, 1)
+
+	// another user's id is ignored
+	assert.NoError(t, s.MarkRead(ctx, "user-1", first.Messages[0].ID, other.Messages[0].ID))
+
+	n, err = s.UnreadCount(ctx, "user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	n, err = s.UnreadCount(ctx, "user-2")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	unread, err := s.List(ctx, "user-1", ListParams{UnreadOnly: true})
+	assert.NoError(t, err)
+	assert.Len(t, unread.Messages, 4)
+
+	assert.NoError(t, s.MarkAllRead(ctx, "user-1"))
+
+	n, err = s.UnreadCount(ctx, "user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	all, err := s.List(ctx, "user-1", ListParams{})
+	assert.NoError(t, err)
+	for _, m := range all.Messages {
+		assert.NotNil(t, m.ReadAt)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestSQLStore(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+	// each connection to :memory: is a database of its own
+	db.SetMaxOpenConns(1)
+
+	s := NewSQLStore(db, WithTable("inbox_test"))
+	assert.NoError(t, s.CreateTable(context.Background()))
+	assert.NoError(t, s.CreateTable(context.Background()), "creating the table is idempotent")
+
+	testStore(t, s)
+}
+
+func TestSQLStore_query(t *testing.T) {
+	s := NewSQLStore(nil, WithDollarPlaceholders())
+	assert.Equal(t, "a = $1 AND b IN ($2, $3)", s.query("a = ? AND b IN (?, ?)"))
+	assert.Equal(t, "a = ?", NewSQLStore(nil).query("a = ?"))
+}
+
+func TestInbox_Attach(t *testing.T) {
+	h := hook.New()
+	in := New(NewMemoryStore())
+	in.Attach(h)
+
+	h.Emit(context.Background(), hook.Event{Type: hook.EventPasswordChanged, UserID: "user-1"})
+	h.Emit(context.Background(), hook.Event{Type: hook.EventUserDeleted, UserID: "user-1"})
+
+	page, err := in.List(context.Background(), "user-1", ListParams{})
+	assert.NoError(t, err)
+	if assert.Len(t, page.Messages, 1) {
+		assert.Equal(t, dto.CategorySecurity, page.Messages[0].Category)
+		assert.Equal(t, string(hook.EventPasswordChanged), page.Messages[0].Type)
+	}
+}
+
+func TestInbox_Attach_types(t *testing.T) {
+	h := hook.New()
+	in := New(NewMemoryStore())
+	in.Attach(h, hook.EventPasswordChanged, hook.EventPinLocked)
+
+	h.Emit(context.Background(), hook.Event{Type: hook.EventSignedIn, UserID: "user-1"})
+	h.Emit(context.Background(), hook.Event{Type: hook.EventPinLocked, UserID: "user-1"})
+
+	page, err := in.List(context.Background(), "user-1", ListParams{})
+	assert.NoError(t, err)
+	if assert.Len(t, page.Messages, 1) {
+		assert.Equal(t, string(hook.EventPinLocked), page.Messages[0].Type)
+	}
+}
+
+func TestInbox_Handler(t *testing.T) {
+	in := New(NewMemoryStore())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if uid := r.URL.Query().Get("user"); uid != "" {
+			r = r.WithContext(session.NewContext(r.Context(), &dto.Session{UserID: uid}))
+		}
+		in.Handler().ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?user=user-1", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	lines := bufio.NewScanner(resp.Body)
+	next := func() string {
+		var ev []string
+		for lines.Scan() {
+			if lines.Text() == "" {
+				return strings.Join(ev, "\n")
+			}
+			ev = append(ev, lines.Text())
+		}
+		return strings.Join(ev, "\n")
+	}
+
+	assert.Equal(t, "event: unread\ndata: 0", next())
+
+	_, err = in.Add(ctx, Message{UserID: "user-1", Title: "hello"})
+	assert.NoError(t, err)
+
+	assert.Contains(t, next(), `"title":"hello"`)
+	assert.Equal(t, "event: unread\ndata: 1", next())
+}
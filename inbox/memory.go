@@ -0,0 +1,127 @@
+package inbox
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	gonanoid "github.com/matoous/go-nanoid"
+)
+
+// MemoryStore keeps messages in process memory, for tests and single
+// instance deployments.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	byUser map[string][]Message // newest first
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{byUser: map[string][]Message{}}
+}
+
+func (s *MemoryStore) Add(ctx context.Context, m *Message) error {
+	if err := prepare(m); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msgs := append(s.byUser[m.UserID], *m)
+	sort.SliceStable(msgs, func(i, j int) bool {
+		c := cursorOf(msgs[i])
+		return c.before(msgs[j])
+	})
+	s.byUser[m.UserID] = msgs
+
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, userID string, p ListParams) (*Page, error) {
+	after, err := parseCursor(p.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var (
+		limit = pageSize(p.Limit)
+		page  = &Page{}
+	)
+
+	for _, m := range s.byUser[userID] {
+		if !after.before(m) || (p.UnreadOnly && m.ReadAt != nil) {
+			continue
+		}
+
+		if len(page.Messages) == limit {
+			page.NextCursor = cursorOf(page.Messages[limit-1]).String()
+			break
+		}
+		page.Messages = append(page.Messages, m)
+	}
+
+	return page, nil
+}
+
+func (s *MemoryStore) UnreadCount(ctx context.Context, userID string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n := 0
+	for _, m := range s.byUser[userID] {
+		if m.ReadAt == nil {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (s *MemoryStore) MarkRead(ctx context.Context, userID string, ids ...string) error {
+	want := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+
+	s.markRead(userID, func(m Message) bool { return want[m.ID] })
+	return nil
+}
+
+func (s *MemoryStore) MarkAllRead(ctx context.Context, userID string) error {
+	s.markRead(userID, func(Message) bool { return true })
+	return nil
+}
+
+func (s *MemoryStore) markRead(userID string, match func(Message) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	for i, m := range s.byUser[userID] {
+		if m.ReadAt == nil && match(m) {
+			s.byUser[userID][i].ReadAt = &now
+		}
+	}
+}
+
+// prepare fills in the fields a store assigns.
+func prepare(m *Message) error {
+	if m.ID == "" {
+		id, err := gonanoid.Nanoid()
+		if err != nil {
+			return err
+		}
+		m.ID = id
+	}
+
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	m.CreatedAt = m.CreatedAt.UTC().Truncate(time.Microsecond)
+
+	return nil
+}
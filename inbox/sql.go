@@ -0,0 +1,226 @@
+package inbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultTable = "inbox_messages"
+
+// SQLStore keeps messages in a database/sql table, created by CreateTable.
+// Times are stored as unix microseconds so the schema works unchanged on
+// SQLite, PostgreSQL and MySQL.
+type SQLStore struct {
+	db     *sql.DB
+	table  string
+	dollar bool
+}
+
+type SQLOption func(*SQLStore)
+
+// WithTable sets the table name. The default is DefaultTable.
+func WithTable(name string) SQLOption {
+	return func(s *SQLStore) { s.table = name }
+}
+
+// WithDollarPlaceholders writes $1, $2... instead of ?, as PostgreSQL drivers expect.
+func WithDollarPlaceholders() SQLOption {
+	return func(s *SQLStore) { s.dollar = true }
+}
+
+func NewSQLStore(db *sql.DB, opts ...SQLOption) *SQLStore {
+	s := &SQLStore{
+		db:    db,
+		table: DefaultTable,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// CreateTable creates the table and its index if they do not exist. MySQL
+// has no CREATE INDEX IF NOT EXISTS; create the index by hand there.
+func (s *SQLStore) CreateTable(ctx context.Context) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS ` + s.table + ` (
+			id VARCHAR(64) PRIMARY KEY,
+			user_id VARCHAR(64) NOT NULL,
+			category VARCHAR(64) NOT NULL,
+			type VARCHAR(64) NOT NULL,
+			title TEXT NOT NULL,
+			body TEXT NOT NULL,
+			data TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			read_at BIGINT
+		)`,
+		`CREATE INDEX IF NOT EXISTS ` + s.table + `_user_created ON ` + s.table + ` (user_id, created_at, id)`,
+	}
+
+	for _, stmt := range stmts {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLStore) Add(ctx context.Context, m *Message) error {
+	if err := prepare(m); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(m.Data)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, s.query(`INSERT INTO `+s.table+`
+		(id, user_id, category, type, title, body, data, created_at, read_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		m.ID, m.UserID, m.Category, m.Type, m.Title, m.Body, string(data), m.CreatedAt.UnixMicro(), unixMicro(m.ReadAt),
+	)
+
+	return err
+}
+
+func (s *SQLStore) List(ctx context.Context, userID string, p ListParams) (*Page, error) {
+	after, err := parseCursor(p.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		limit = pageSize(p.Limit)
+		q     = `SELECT id, user_id, category, type, title, body, data, created_at, read_at FROM ` + s.table + ` WHERE user_id = ?`
+		args  = []any{userID}
+	)
+
+	if p.UnreadOnly {
+		q += ` AND read_at IS NULL`
+	}
+	if after != nil {
+		q += ` AND (created_at < ? OR (created_at = ? AND id < ?))`
+		args = append(args, after.createdAt, after.createdAt, after.id)
+	}
+	q += ` ORDER BY created_at DESC, id DESC LIMIT ?`
+	args = append(args, limit+1)
+
+	rows, err := s.db.QueryContext(ctx, s.query(q), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &Page{}
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Messages = append(page.Messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Messages) > limit {
+		page.Messages = page.Messages[:limit]
+		page.NextCursor = cursorOf(page.Messages[limit-1]).String()
+	}
+
+	return page, nil
+}
+
+func (s *SQLStore) UnreadCount(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx,
+		s.query(`SELECT COUNT(*) FROM `+s.table+` WHERE user_id = ? AND read_at IS NULL`),
+		userID,
+	).Scan(&n)
+
+	return n, err
+}
+
+func (s *SQLStore) MarkRead(ctx context.Context, userID string, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	args := []any{time.Now().UnixMicro(), userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	_, err := s.db.ExecContext(ctx, s.query(`UPDATE `+s.table+` SET read_at = ?
+		WHERE user_id = ? AND read_at IS NULL AND id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)`),
+		args...,
+	)
+
+	return err
+}
+
+func (s *SQLStore) MarkAllRead(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx,
+		s.query(`UPDATE `+s.table+` SET read_at = ? WHERE user_id = ? AND read_at IS NULL`),
+		time.Now().UnixMicro(), userID,
+	)
+
+	return err
+}
+
+var placeholder = regexp.MustCompile(`\?`)
+
+// query rewrites ? placeholders for drivers that want $n.
+func (s *SQLStore) query(q string) string {
+	if !s.dollar {
+		return q
+	}
+
+	n := 0
+	return placeholder.ReplaceAllStringFunc(q, func(string) string {
+		n++
+		return "$" + strconv.Itoa(n)
+	})
+}
+
+func scanMessage(rows *sql.Rows) (Message, error) {
+	var (
+		m         Message
+		data      string
+		createdAt int64
+		readAt    sql.NullInt64
+	)
+
+	if err := rows.Scan(&m.ID, &m.UserID, &m.Category, &m.Type, &m.Title, &m.Body, &data, &createdAt, &readAt); err != nil {
+		return Message{}, err
+	}
+
+	if err := json.Unmarshal([]byte(data), &m.Data); err != nil {
+		return Message{}, fmt.Errorf("inbox message %s: %w", m.ID, err)
+	}
+
+	m.CreatedAt = time.UnixMicro(createdAt).UTC()
+	if readAt.Valid {
+		t := time.UnixMicro(readAt.Int64).UTC()
+		m.ReadAt = &t
+	}
+
+	return m, nil
+}
+
+func unixMicro(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UnixMicro()
+}
@@ -0,0 +1,92 @@
+package inbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/otyang/go-authsvc/session"
+)
+
+// keepAlive is how often an idle stream gets a comment line, so proxies do
+// not close it.
+const keepAlive = 30 * time.Second
+
+// Handler streams the signed-in user's inbox as server-sent events. It
+// expects the session in the request context (see session.Middleware) and
+// answers 401 without one.
+//
+// The stream starts with an "unread" event carrying the unread count. Each
+// new message is sent as a "message" event with the message as JSON, and
+// every change is followed by a fresh "unread" event.
+func (i *Inbox) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sn, ok := session.FromContext(r.Context())
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		updates, cancel := i.Subscribe(sn.UserID)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+
+		sendUnread := func() error {
+			n, err := i.UnreadCount(r.Context(), sn.UserID)
+			if err != nil {
+				return err
+			}
+			return writeEvent(w, "unread", n)
+		}
+
+		if err := sendUnread(); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			case u := <-updates:
+				if u.Message != nil {
+					if err := writeEvent(w, "message", u.Message); err != nil {
+						return
+					}
+				}
+				if err := sendUnread(); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	})
+}
+
+func writeEvent(w http.ResponseWriter, event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
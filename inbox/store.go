@@ -0,0 +1,115 @@
+// Package inbox stores in-app notifications per user and streams new ones
+// to connected clients over server-sent events.
+package inbox
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid inbox cursor")
+
+type Message struct {
+	ID       string `json:"id"`
+	UserID   string `json:"user_id"`
+	Category string `json:"category,omitempty"`
+	// Type names the event that produced the message, e.g. "session.signed_in"
+	Type      string         `json:"type,omitempty"`
+	Title     string         `json:"title"`
+	Body      string         `json:"body,omitempty"`
+	Data      map[string]any `json:"data,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	ReadAt    *time.Time     `json:"read_at,omitempty"`
+}
+
+type ListParams struct {
+	// Cursor is a previous page's NextCursor; empty starts at the newest message
+	Cursor     string
+	Limit      int
+	UnreadOnly bool
+}
+
+type Page struct {
+	Messages []Message
+	// NextCursor is empty on the last page.
+	NextCursor string
+}
+
+// Store keeps messages per user. Pages list the newest messages first.
+type Store interface {
+	// Add stores m, filling in its ID and CreatedAt when empty.
+	Add(ctx context.Context, m *Message) error
+	List(ctx context.Context, userID string, p ListParams) (*Page, error)
+	UnreadCount(ctx context.Context, userID string) (int, error)
+	// MarkRead marks the given messages of userID as read; ids of other
+	// users' messages are ignored.
+	MarkRead(ctx context.Context, userID string, ids ...string) error
+	MarkAllRead(ctx context.Context, userID string) error
+}
+
+func pageSize(limit int) int {
+	if limit <= 0 {
+		return defaultPageSize
+	}
+	if limit > maxPageSize {
+		return maxPageSize
+	}
+	return limit
+}
+
+// cursor is the position of the last message on a page. Timestamps are
+// kept to the microsecond so every store can hold them exactly.
+type cursor struct {
+	createdAt int64 // unix microseconds
+	id        string
+}
+
+func (c cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.createdAt, 10) + ":" + c.id))
+}
+
+func parseCursor(s string) (*cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	ts, id, ok := strings.Cut(string(b), ":")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	n, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor{createdAt: n, id: id}, nil
+}
+
+// before reports whether m comes after c in newest-first order.
+func (c *cursor) before(m Message) bool {
+	if c == nil {
+		return true
+	}
+
+	t := m.CreatedAt.UnixMicro()
+	return t < c.createdAt || (t == c.createdAt && m.ID < c.id)
+}
+
+func cursorOf(m Message) cursor {
+	return cursor{createdAt: m.CreatedAt.UnixMicro(), id: m.ID}
+}
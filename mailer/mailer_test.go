@@ -0,0 +1,236 @@
+package mailer
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/notify"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessage_Bytes(t *testing.T) {
+	raw, err := Message{
+		From:    "Auth <auth@example.com>",
+		To:      []string{"ada@example.com"},
+		Subject: "Nouvelle connexion à votre compte",
+		Text:    "plain body",
+		HTML:    "<p>html body</p>",
+	}.Bytes()
+	assert.NoError(t, err)
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	assert.NoError(t, err)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Nouvelle connexion à votre compte", subject)
+	assert.Contains(t, msg.Header.Get("Message-ID"), "@example.com>")
+
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+
+	var bodies []string
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		b, _ := io.ReadAll(p)
+		bodies = append(bodies, p.Header.Get("Content-Type")+" "+string(b))
+	}
+	assert.Equal(t, []string{
+		"text/plain; charset=utf-8 plain body",
+		"text/html; charset=utf-8 <p>html body</p>",
+	}, bodies)
+
+	_, err = Message{From: "a@example.com"}.Bytes()
+	assert.ErrorIs(t, err, ErrNoRecipients)
+	_, err = Message{To: []string{"a@example.com"}}.Bytes()
+	assert.ErrorIs(t, err, ErrNoSender)
+}
+
+func TestTemplates_Render(t *testing.T) {
+	tmpl, err := NewTemplates()
+	assert.NoError(t, err)
+
+	data := NoticeData{
+		User: dto.User{FullName: "Ada <Lovelace>"},
+		Data: map[string]any{"device": "Chrome on macOS", "revoke_url": "https://example.com/revoke?t=1&u=2"},
+	}
+
+	testCases := []struct {
+		name    string
+		locale  string
+		subject string
+	}{
+		{name: "default locale", locale: "", subject: "New sign-in to your account"},
+		{name: "exact locale", locale: "fr", subject: "Nouvelle connexion à votre compte"},
+		{name: "region falls back to language", locale: "fr_CA", subject: "Nouvelle connexion à votre compte"},
+		{name: "unknown locale falls back to default", locale: "pt-BR", subject: "New sign-in to your account"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg, err := tmpl.Render(TemplateNewSignIn, tc.locale, data)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.subject, msg.Subject)
+			assert.Contains(t, msg.Text, "Ada <Lovelace>", "text is not html escaped")
+			assert.Contains(t, msg.HTML, "Ada &lt;Lovelace&gt;")
+			assert.Contains(t, msg.HTML, `href="https://example.com/revoke?t=1&amp;u=2"`)
+		})
+	}
+
+	_, err = tmpl.Render("missing", "en", data)
+	assert.ErrorIs(t, err, ErrTemplateNotFound)
+}
+
+func TestTemplates_Override(t *testing.T) {
+	tmpl, err := NewTemplates(WithDefaultLocale("fr"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, tmpl.Override(TemplatePasswordChanged, "en", `{{define "subject"}}Password updated{{end}}`))
+	assert.NoError(t, tmpl.OverrideFS(fstest.MapFS{
+		"de/password_changed.tmpl": {Data: []byte(`{{define "subject"}}Passwort geändert{{end}}`)},
+	}))
+
+	for locale, subject := range map[string]string{
+		"en": "Password updated",
+		"de": "Passwort geändert",
+		"es": "Votre mot de passe a été modifié",
+	} {
+		msg, err := tmpl.Render(TemplatePasswordChanged, locale, NoticeData{})
+		assert.NoError(t, err)
+		assert.Equal(t, subject, msg.Subject, locale)
+	}
+
+	// other templates keep their built-in version
+	msg, err := tmpl.Render(TemplateAccountUnlock, "en", NoticeData{})
+	assert.NoError(t, err)
+	assert.Equal(t, "Unlock your account", msg.Subject)
+
+	assert.Error(t, tmpl.Override("broken", "en", `{{define "subject"}`))
+}
+
+func TestOutbox(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	ob, err := NewOutbox(dir)
+	assert.NoError(t, err)
+
+	msg := Message{From: "auth@example.com", To: []string{"ada@example.com"}, Subject: "hi", Text: "hello"}
+	assert.NoError(t, ob.Send(context.TODO(), msg))
+	assert.Equal(t, []Message{msg}, ob.Sent())
+
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		assert.True(t, strings.HasSuffix(files[0].Name(), ".eml"))
+	}
+}
+
+func TestSMTP_Send(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	received := make(chan []string, 1)
+	go fakeSMTPServer(ln, received)
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+
+	s := NewSMTP(SMTPConfig{Host: host, Port: portNum, From: "Auth <auth@example.com>"})
+	err = s.Send(context.TODO(), Message{To: []string{"ada@example.com"}, Subject: "hi", Text: "hello"})
+	assert.NoError(t, err)
+
+	cmds := <-received
+	assert.Contains(t, cmds, "MAIL FROM:<auth@example.com>")
+	assert.Contains(t, cmds, "RCPT TO:<ada@example.com>")
+}
+
+// fakeSMTPServer accepts one connection, speaks just enough SMTP and sends
+// the commands it saw on received.
+func fakeSMTPServer(ln net.Listener, received chan<- []string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var (
+		tp   = textproto.NewConn(conn)
+		cmds []string
+	)
+	_ = tp.PrintfLine("220 localhost ready")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			break
+		}
+		cmds = append(cmds, line)
+
+		switch {
+		case strings.HasPrefix(line, "EHLO"):
+			_ = tp.PrintfLine("250 localhost")
+		case line == "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			_, _ = tp.ReadDotBytes()
+			_ = tp.PrintfLine("250 queued")
+		case line == "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			received <- cmds
+			return
+		default:
+			_ = tp.PrintfLine("250 OK")
+		}
+	}
+
+	received <- cmds
+}
+
+func TestSender(t *testing.T) {
+	var (
+		ob, _   = NewOutbox("")
+		tmpl, _ = NewTemplates()
+		s       = Sender(ob, tmpl, "auth@example.com")
+		email   = "ada@example.com"
+		user    = dto.User{FullName: "Ada", Email: &email}
+	)
+
+	assert.ErrorIs(t, s.Send(context.TODO(), dto.User{}, notify.Notification{}), notify.ErrNoAddress)
+
+	assert.NoError(t, s.Send(context.TODO(), user, notify.Notification{
+		Type: TemplateNewSignIn,
+		Data: map[string]any{"locale": "fr"},
+	}))
+	assert.NoError(t, s.Send(context.TODO(), user, notify.Notification{
+		Type:  "custom_event",
+		Title: "Payout sent",
+		Body:  "Your payout is on its way.",
+	}))
+
+	sent := ob.Sent()
+	if assert.Len(t, sent, 2) {
+		assert.Equal(t, "Nouvelle connexion à votre compte", sent[0].Subject)
+		assert.Equal(t, []string{email}, sent[0].To)
+		assert.Equal(t, "auth@example.com", sent[0].From)
+		assert.Equal(t, "Payout sent", sent[1].Subject)
+		assert.Equal(t, "Your payout is on its way.", sent[1].Text)
+	}
+}
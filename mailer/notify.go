@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/notify"
+)
+
+// NoticeData is what templates rendered for a notification see.
+type NoticeData struct {
+	User  dto.User
+	Title string
+	Body  string
+	Data  map[string]any
+}
+
+// Sender adapts m to a notify.Sender for the email channel. The template is
+// picked by the notification's Type, falling back to TemplateNotification;
+// the locale comes from Data["locale"] if set.
+func Sender(m Mailer, t *Templates, from string) notify.Sender {
+	return notify.SenderFunc(func(ctx context.Context, user dto.User, n notify.Notification) error {
+		if user.Email == nil || *user.Email == "" {
+			return notify.ErrNoAddress
+		}
+
+		locale, _ := n.Data["locale"].(string)
+		data := NoticeData{User: user, Title: n.Title, Body: n.Body, Data: n.Data}
+
+		msg, err := t.Render(n.Type, locale, data)
+		if errors.Is(err, ErrTemplateNotFound) {
+			msg, err = t.Render(TemplateNotification, locale, data)
+		}
+		if err != nil {
+			return err
+		}
+
+		msg.From = from
+		msg.To = []string{*user.Email}
+
+		return m.Send(ctx, msg)
+	})
+}
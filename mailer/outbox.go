@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Outbox keeps sent messages in memory and, when given a directory, also
+// writes each one there as an .eml file that mail clients can open.
+type Outbox struct {
+	dir string
+
+	mu   sync.Mutex
+	sent []Message
+}
+
+// NewOutbox creates dir if needed. An empty dir keeps messages in memory only.
+func NewOutbox(dir string) (*Outbox, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Outbox{dir: dir}, nil
+}
+
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.dir != "" {
+		name := fmt.Sprintf("%s-%04d.eml", time.Now().UTC().Format("20060102T150405Z"), len(o.sent))
+		if err := os.WriteFile(filepath.Join(o.dir, name), body, 0o644); err != nil {
+			return err
+		}
+	}
+
+	o.sent = append(o.sent, msg)
+	return nil
+}
+
+// Sent returns the messages sent so far, oldest first.
+func (o *Outbox) Sent() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Message(nil), o.sent...)
+}
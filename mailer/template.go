@@ -0,0 +1,227 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+)
+
+// Template names shipped with the package. Notification is the generic one,
+// rendering a notice's Title and Body.
+const (
+	TemplateNotification    = "notification"
+	TemplateNewSignIn       = "new_sign_in"
+	TemplatePasswordChanged = "password_changed"
+	TemplateAccountUnlock   = "account_unlock"
+	TemplateReferralInvite  = "referral_invite"
+)
+
+const DefaultLocale = "en"
+
+var ErrTemplateNotFound = errors.New("email template not found")
+
+//go:embed templates
+var builtin embed.FS
+
+// Templates holds the email templates by name and locale. A template is one
+// file defining up to three blocks: "subject" and "text", rendered as plain
+// text, and "html", rendered with html/template escaping.
+//
+// Files are laid out as <locale>/<name>.tmpl. Overrides replace single
+// templates and leave the others at their built-in version.
+type Templates struct {
+	defaultLocale string
+
+	mu  sync.RWMutex
+	set map[templateKey]*parsed
+}
+
+type templateKey struct {
+	name   string
+	locale string
+}
+
+type parsed struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+type TemplateOption func(*Templates)
+
+// WithDefaultLocale sets the locale used when a template has no version for
+// the requested one. The default is "en".
+func WithDefaultLocale(locale string) TemplateOption {
+	return func(t *Templates) { t.defaultLocale = normalizeLocale(locale) }
+}
+
+// NewTemplates returns the built-in templates.
+func NewTemplates(opts ...TemplateOption) (*Templates, error) {
+	t := &Templates{
+		defaultLocale: DefaultLocale,
+		set:           map[templateKey]*parsed{},
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	sub, err := fs.Sub(builtin, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.OverrideFS(sub); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Override replaces, or adds, the template name for locale.
+func (t *Templates) Override(name, locale, src string) error {
+	p, err := parse(name, src)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.set[templateKey{name: name, locale: normalizeLocale(locale)}] = p
+
+	return nil
+}
+
+// OverrideFS overrides every <locale>/<name>.tmpl file found in fsys.
+func (t *Templates) OverrideFS(fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "*/*.tmpl")
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		src, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+
+		var (
+			locale = path.Dir(file)
+			name   = strings.TrimSuffix(path.Base(file), ".tmpl")
+		)
+
+		if err := t.Override(name, locale, string(src)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Render executes the template name in the closest available locale:
+// "pt-BR" falls back to "pt", then to the default locale. The returned
+// message has no sender or recipients yet.
+func (t *Templates) Render(name, locale string, data any) (Message, error) {
+	p, ok := t.lookup(name, locale)
+	if !ok {
+		return Message{}, fmt.Errorf("%w: %s (%s)", ErrTemplateNotFound, name, locale)
+	}
+
+	subject, err := executeText(p.text, "subject", data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	text, err := executeText(p.text, "text", data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	html, err := executeHTML(p.html, "html", data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		Subject: strings.Join(strings.Fields(subject), " "),
+		Text:    strings.TrimSpace(text),
+		HTML:    strings.TrimSpace(html),
+	}, nil
+}
+
+func (t *Templates) lookup(name, locale string) (*parsed, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for _, l := range candidateLocales(normalizeLocale(locale), t.defaultLocale) {
+		if p, ok := t.set[templateKey{name: name, locale: l}]; ok {
+			return p, true
+		}
+	}
+
+	return nil, false
+}
+
+func parse(name, src string) (*parsed, error) {
+	text, err := texttemplate.New(name).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("parse email template %s: %w", name, err)
+	}
+
+	html, err := htmltemplate.New(name).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("parse email template %s: %w", name, err)
+	}
+
+	return &parsed{text: text, html: html}, nil
+}
+
+// executeText renders one block, or nothing if the template does not
+// define it.
+func executeText(t *texttemplate.Template, block string, data any) (string, error) {
+	if t.Lookup(block) == nil {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	err := t.ExecuteTemplate(&buf, block, data)
+	return buf.String(), err
+}
+
+// executeHTML is executeText with html/template escaping.
+func executeHTML(t *htmltemplate.Template, block string, data any) (string, error) {
+	if t.Lookup(block) == nil {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	err := t.ExecuteTemplate(&buf, block, data)
+	return buf.String(), err
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
+
+// candidateLocales lists where to look for a template, most specific first.
+func candidateLocales(locale, fallback string) []string {
+	var out []string
+
+	for l := locale; l != ""; {
+		out = append(out, l)
+
+		i := strings.LastIndex(l, "-")
+		if i < 0 {
+			break
+		}
+		l = l[:i]
+	}
+
+	return append(out, fallback)
+}
@@ -0,0 +1,115 @@
+// Package migrate upgrades stored trusted metadata to the current schema
+// version. Each registered step moves metadata from one version to the
+// next; the version is kept in the metadata itself under VersionKey.
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// VersionKey is the trusted metadata key holding the schema version.
+// Metadata without it is at version 0.
+const VersionKey = "schema_version"
+
+var (
+	ErrVersionGap     = errors.New("migration does not start at the latest version")
+	ErrInvalidVersion = errors.New("invalid schema version")
+)
+
+// Func upgrades raw trusted metadata by one version, editing tm in place.
+// tm is a copy of the top level map; nested values are shared, so replace
+// rather than edit them.
+type Func func(tm map[string]any) error
+
+// Registry holds the ordered migration steps. The zero value and a nil
+// *Registry have no steps and migrate nothing.
+type Registry struct {
+	steps []Func
+}
+
+// NewRegistry returns a registry whose steps migrate from version 0, 1, ...
+// in the order given.
+func NewRegistry(steps ...Func) *Registry {
+	return &Registry{steps: steps}
+}
+
+// Register adds the step migrating from version from to from+1. from must
+// be the current Latest, so steps are registered in order.
+func (r *Registry) Register(from int, fn Func) error {
+	if from != r.Latest() {
+		return fmt.Errorf("%w: got %d, latest is %d", ErrVersionGap, from, r.Latest())
+	}
+
+	r.steps = append(r.steps, fn)
+	return nil
+}
+
+// Latest is the version metadata has once every step has run.
+func (r *Registry) Latest() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.steps)
+}
+
+// NeedsMigration reports whether tm is older than Latest.
+func (r *Registry) NeedsMigration(tm map[string]any) bool {
+	v, err := Version(tm)
+	return err == nil && v < r.Latest()
+}
+
+// Migrate returns tm upgraded to Latest, and whether anything changed. tm
+// itself is never modified. Metadata at a newer version than Latest, written
+// by a newer deployment, is returned as it is.
+func (r *Registry) Migrate(tm map[string]any) (map[string]any, bool, error) {
+	from, err := Version(tm)
+	if err != nil {
+		return tm, false, err
+	}
+
+	if from >= r.Latest() {
+		return tm, false, nil
+	}
+
+	out := make(map[string]any, len(tm)+1)
+	for k, v := range tm {
+		out[k] = v
+	}
+
+	for v := from; v < r.Latest(); v++ {
+		if err := r.steps[v](out); err != nil {
+			return tm, false, fmt.Errorf("migrate trusted metadata from version %d to %d: %w", v, v+1, err)
+		}
+	}
+	out[VersionKey] = r.Latest()
+
+	return out, true, nil
+}
+
+// Version reads the schema version of tm. Stored metadata comes back from
+// JSON, so numbers may be float64 or strings.
+func Version(tm map[string]any) (int, error) {
+	switch v := tm[VersionKey].(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v != float64(int(v)) {
+			return 0, fmt.Errorf("%w: %v", ErrInvalidVersion, v)
+		}
+		return int(v), nil
+	case string:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidVersion, v)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("%w: %v", ErrInvalidVersion, v)
+	}
+}
@@ -0,0 +1,111 @@
+package migrate
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testRegistry() *Registry {
+	return NewRegistry(
+		// v0 -> v1: rename notify to notification_email
+		func(tm map[string]any) error {
+			tm["notification_email"] = tm["notify"]
+			delete(tm, "notify")
+			return nil
+		},
+		// v1 -> v2: default the role
+		func(tm map[string]any) error {
+			if tm["user_role"] == nil {
+				tm["user_role"] = "customer"
+			}
+			return nil
+		},
+	)
+}
+
+func TestRegistry_Migrate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    map[string]any
+		expected map[string]any
+		changed  bool
+	}{
+		{
+			name:     "unversioned metadata runs every step",
+			input:    map[string]any{"notify": true},
+			expected: map[string]any{"notification_email": true, "user_role": "customer", VersionKey: 2},
+			changed:  true,
+		},
+		{
+			name:     "json numbers are read as versions",
+			input:    map[string]any{VersionKey: float64(1), "user_role": "admin"},
+			expected: map[string]any{VersionKey: 2, "user_role": "admin"},
+			changed:  true,
+		},
+		{
+			name:     "current metadata is untouched",
+			input:    map[string]any{VersionKey: float64(2)},
+			expected: map[string]any{VersionKey: float64(2)},
+		},
+		{
+			name:     "newer metadata is untouched",
+			input:    map[string]any{VersionKey: float64(5)},
+			expected: map[string]any{VersionKey: float64(5)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			original := make(map[string]any, len(tc.input))
+			for k, v := range tc.input {
+				original[k] = v
+			}
+
+			got, changed, err := testRegistry().Migrate(tc.input)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.changed, changed)
+			assert.Equal(t, tc.expected, got)
+			assert.Equal(t, original, tc.input, "input must not be modified")
+		})
+	}
+}
+
+func TestRegistry_MigrateError(t *testing.T) {
+	boom := errors.New("boom")
+	r := NewRegistry(func(tm map[string]any) error { return boom })
+
+	input := map[string]any{"a": 1}
+	got, changed, err := r.Migrate(input)
+
+	assert.ErrorIs(t, err, boom)
+	assert.False(t, changed)
+	assert.Equal(t, input, got)
+
+	_, _, err = r.Migrate(map[string]any{VersionKey: "x"})
+	assert.ErrorIs(t, err, ErrInvalidVersion)
+}
+
+func TestRegistry_Register(t *testing.T) {
+	r := NewRegistry()
+	noop := func(map[string]any) error { return nil }
+
+	assert.NoError(t, r.Register(0, noop))
+	assert.ErrorIs(t, r.Register(0, noop), ErrVersionGap)
+	assert.NoError(t, r.Register(1, noop))
+	assert.Equal(t, 2, r.Latest())
+}
+
+func TestNilRegistry(t *testing.T) {
+	var r *Registry
+	input := map[string]any{"a": 1}
+
+	got, changed, err := r.Migrate(input)
+
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, input, got)
+	assert.False(t, r.NeedsMigration(input))
+}
@@ -0,0 +1,194 @@
+// Package notify routes notifications to a user over the channels they
+// enabled for the notification's category.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/otyang/go-authsvc/dto"
+)
+
+type Channel string
+
+const (
+	ChannelEmail Channel = "email"
+	ChannelPush  Channel = "push"
+	ChannelSMS   Channel = "sms"
+	ChannelInApp Channel = "in_app"
+)
+
+// ErrNoAddress is returned by a Sender when the user has nowhere to receive
+// on its channel, e.g. no phone number for SMS. The router skips it.
+var ErrNoAddress = errors.New("user has no address on this channel")
+
+// Notification is one message for one user.
+type Notification struct {
+	UserID string
+	// Category picks the user's channel preferences, e.g. dto.CategorySecurity
+	Category string
+	// Type names the event, e.g. "new_sign_in"; senders may use it to pick a template
+	Type  string
+	Title string
+	Body  string
+	Data  map[string]any
+}
+
+// Sender delivers a notification over one channel.
+type Sender interface {
+	Send(ctx context.Context, user dto.User, n Notification) error
+}
+
+type SenderFunc func(ctx context.Context, user dto.User, n Notification) error
+
+func (f SenderFunc) Send(ctx context.Context, user dto.User, n Notification) error {
+	return f(ctx, user, n)
+}
+
+// UserGetter loads the recipient; *user.UserService implements it.
+type UserGetter interface {
+	Get(ctx context.Context, userID string) (*dto.User, error)
+}
+
+type UserGetterFunc func(ctx context.Context, userID string) (*dto.User, error)
+
+func (f UserGetterFunc) Get(ctx context.Context, userID string) (*dto.User, error) {
+	return f(ctx, userID)
+}
+
+// Router delivers notifications through the registered senders. It is safe
+// for concurrent use.
+type Router struct {
+	users UserGetter
+
+	mu      sync.RWMutex
+	senders map[Channel]Sender
+}
+
+type Option func(*Router)
+
+// WithSender registers s for ch.
+func WithSender(ch Channel, s Sender) Option {
+	return func(r *Router) { r.senders[ch] = s }
+}
+
+func NewRouter(users UserGetter, opts ...Option) *Router {
+	r := &Router{
+		users:   users,
+		senders: map[Channel]Sender{},
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Register adds, or replaces, the sender for ch.
+func (r *Router) Register(ch Channel, s Sender) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.senders[ch] = s
+}
+
+// Notify loads n.UserID and delivers n to them. See Deliver.
+func (r *Router) Notify(ctx context.Context, n Notification) error {
+	user, err := r.users.Get(ctx, n.UserID)
+	if err != nil {
+		return err
+	}
+
+	return r.Deliver(ctx, *user, n)
+}
+
+// Deliver sends n on every channel the user enabled for n.Category that has
+// a sender. A channel failing does not stop the others; the failures are
+// returned together.
+func (r *Router) Deliver(ctx context.Context, user dto.User, n Notification) error {
+	if n.UserID == "" {
+		n.UserID = user.UserID
+	}
+
+	var errs []error
+
+	for _, ch := range Channels(user.TrustedMetadata.ChannelsFor(n.Category)) {
+		r.mu.RLock()
+		s, ok := r.senders[ch]
+		r.mu.RUnlock()
+		if !ok {
+			continue
+		}
+
+		if err := s.Send(ctx, user, n); err != nil && !errors.Is(err, ErrNoAddress) {
+			errs = append(errs, fmt.Errorf("notify %s: %w", ch, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Channels lists the channels p turns on.
+func Channels(p dto.ChannelPreferences) []Channel {
+	var chs []Channel
+
+	if p.Email {
+		chs = append(chs, ChannelEmail)
+	}
+	if p.Push {
+		chs = append(chs, ChannelPush)
+	}
+	if p.SMS {
+		chs = append(chs, ChannelSMS)
+	}
+	if p.InApp {
+		chs = append(chs, ChannelInApp)
+	}
+
+	return chs
+}
+
+// SMS adapts a plain text sender, such as an SMS gateway client, to the
+// user's phone number.
+func SMS(send func(ctx context.Context, phoneNumber string, text string) error) Sender {
+	return SenderFunc(func(ctx context.Context, user dto.User, n Notification) error {
+		if user.PhoneNumber == nil || *user.PhoneNumber == "" {
+			return ErrNoAddress
+		}
+
+		text := n.Body
+		if n.Title != "" {
+			text = n.Title + ": " + n.Body
+		}
+
+		return send(ctx, *user.PhoneNumber, text)
+	})
+}
+
+// Push adapts a push gateway client, such as FCM or APNs, to the user's
+// registered devices. tokens is normally SessionService.PushTokens.
+func Push(
+	tokens func(ctx context.Context, userID string) ([]dto.PushToken, error),
+	send func(ctx context.Context, token dto.PushToken, n Notification) error,
+) Sender {
+	return SenderFunc(func(ctx context.Context, user dto.User, n Notification) error {
+		list, err := tokens(ctx, user.UserID)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			return ErrNoAddress
+		}
+
+		var errs []error
+		for _, t := range list {
+			if err := send(ctx, t, n); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		return errors.Join(errs...)
+	})
+}
@@ -0,0 +1,138 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	sent []Channel
+}
+
+func (r *recorder) sender(ch Channel, err error) Sender {
+	return SenderFunc(func(ctx context.Context, user dto.User, n Notification) error {
+		r.sent = append(r.sent, ch)
+		return err
+	})
+}
+
+func TestRouter_Deliver(t *testing.T) {
+	allOff := dto.TrustedMetadata{
+		NotificationPreferences: map[string]dto.ChannelPreferences{
+			dto.CategorySecurity:  {},
+			dto.CategoryMarketing: {},
+		},
+	}
+	globalOn := dto.DefaultTrustedMetadata
+
+	testCases := []struct {
+		name     string
+		metadata dto.TrustedMetadata
+		category string
+		expected []Channel
+	}{
+		{
+			name:     "security is delivered even when turned off",
+			metadata: allOff,
+			category: dto.CategorySecurity,
+			expected: []Channel{ChannelEmail, ChannelInApp},
+		},
+		{
+			name:     "marketing respects the user's choice",
+			metadata: allOff,
+			category: dto.CategoryMarketing,
+		},
+		{
+			name:     "unset categories follow the global switches",
+			metadata: globalOn,
+			category: dto.CategoryTransactions,
+			expected: []Channel{ChannelEmail, ChannelPush, ChannelSMS, ChannelInApp},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := &recorder{}
+			r := NewRouter(nil,
+				WithSender(ChannelEmail, rec.sender(ChannelEmail, nil)),
+				WithSender(ChannelPush, rec.sender(ChannelPush, nil)),
+				WithSender(ChannelSMS, rec.sender(ChannelSMS, nil)),
+				WithSender(ChannelInApp, rec.sender(ChannelInApp, nil)),
+			)
+
+			err := r.Deliver(context.TODO(), dto.User{TrustedMetadata: tc.metadata}, Notification{Category: tc.category})
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, rec.sent)
+		})
+	}
+}
+
+func TestRouter_DeliverErrors(t *testing.T) {
+	var (
+		rec  = &recorder{}
+		boom = errors.New("boom")
+		r    = NewRouter(nil,
+			WithSender(ChannelEmail, rec.sender(ChannelEmail, boom)),
+			WithSender(ChannelSMS, rec.sender(ChannelSMS, ErrNoAddress)),
+		)
+	)
+	r.Register(ChannelInApp, rec.sender(ChannelInApp, nil))
+
+	err := r.Deliver(context.TODO(), dto.User{TrustedMetadata: dto.DefaultTrustedMetadata}, Notification{Category: dto.CategorySecurity})
+
+	assert.ErrorIs(t, err, boom)
+	assert.NotErrorIs(t, err, ErrNoAddress)
+	assert.Equal(t, []Channel{ChannelEmail, ChannelSMS, ChannelInApp}, rec.sent, "a failing channel does not stop the others")
+}
+
+func TestSMS(t *testing.T) {
+	var got []string
+	s := SMS(func(ctx context.Context, phone, text string) error {
+		got = append(got, phone, text)
+		return nil
+	})
+
+	err := s.Send(context.TODO(), dto.User{}, Notification{Body: "hi"})
+	assert.ErrorIs(t, err, ErrNoAddress)
+
+	phone := "+2348000000000"
+	err = s.Send(context.TODO(), dto.User{PhoneNumber: &phone}, Notification{Title: "New sign-in", Body: "hi"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{phone, "New sign-in: hi"}, got)
+}
+
+func TestPush(t *testing.T) {
+	var (
+		boom    = errors.New("boom")
+		devices = map[string][]dto.PushToken{
+			"u1": {{Token: "t1"}, {Token: "t2"}},
+		}
+		got []string
+	)
+
+	s := Push(
+		func(ctx context.Context, userID string) ([]dto.PushToken, error) {
+			return devices[userID], nil
+		},
+		func(ctx context.Context, token dto.PushToken, n Notification) error {
+			got = append(got, token.Token)
+			if token.Token == "t1" {
+				return boom
+			}
+			return nil
+		},
+	)
+
+	err := s.Send(context.TODO(), dto.User{UserID: "u2"}, Notification{})
+	assert.ErrorIs(t, err, ErrNoAddress)
+
+	err = s.Send(context.TODO(), dto.User{UserID: "u1"}, Notification{})
+	assert.ErrorIs(t, err, boom)
+	assert.Equal(t, []string{"t1", "t2"}, got, "a failing device does not stop the others")
+}
@@ -0,0 +1,251 @@
+package policy
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+)
+
+func (n literal) eval(map[string]any) (any, error) { return n.value, nil }
+
+// variable resolves a dotted path through nested maps. Missing keys
+// evaluate to nil rather than failing, so rules can test for absence.
+func (n variable) eval(env map[string]any) (any, error) {
+	var cur any = env
+
+	for _, key := range n.path {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, nil
+		}
+		cur = m[key]
+	}
+
+	return cur, nil
+}
+
+func (n listNode) eval(env map[string]any) (any, error) {
+	items := make([]any, 0, len(n.items))
+	for _, item := range n.items {
+		v, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+func (n unary) eval(env map[string]any) (any, error) {
+	v, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("! expects a bool, got %T", v)
+	}
+	return !b, nil
+}
+
+func (n binary) eval(env map[string]any) (any, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// short circuit the boolean operators
+	if n.op == "&&" || n.op == "||" {
+		lb, ok := left.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s expects bools, got %T", n.op, left)
+		}
+		if (n.op == "&&" && !lb) || (n.op == "||" && lb) {
+			return lb, nil
+		}
+
+		right, err := n.right.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		rb, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s expects bools, got %T", n.op, right)
+		}
+		return rb, nil
+	}
+
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		return contains(right, left)
+	}
+
+	// like SQL NULL, an absent value is neither less nor greater than anything
+	if left == nil || right == nil {
+		return false, nil
+	}
+
+	c, err := compare(left, right)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func (n call) eval(env map[string]any) (any, error) {
+	args := make([]any, 0, len(n.args))
+	for _, arg := range n.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+
+	return functions[n.name](env, args)
+}
+
+func equal(a, b any) bool {
+	if ta, ok := a.(time.Time); ok {
+		tb, ok := b.(time.Time)
+		return ok && ta.Equal(tb)
+	}
+	// maps and lists are not comparable with ==, which would panic
+	return reflect.DeepEqual(a, b)
+}
+
+func contains(list, item any) (bool, error) {
+	switch l := list.(type) {
+	case []any:
+		for _, v := range l {
+			if equal(v, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case string:
+		s, ok := item.(string)
+		return ok && strings.Contains(l, s), nil
+	case nil:
+		return false, nil
+	}
+	return false, fmt.Errorf("in expects a list or string, got %T", list)
+}
+
+func compare(a, b any) (int, error) {
+	switch x := a.(type) {
+	case float64:
+		if y, ok := b.(float64); ok {
+			return cmp(x < y, x > y), nil
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), nil
+		}
+	case time.Duration:
+		if y, ok := b.(time.Duration); ok {
+			return cmp(x < y, x > y), nil
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return cmp(x.Before(y), x.After(y)), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %T with %T", a, b)
+}
+
+func cmp(less, greater bool) int {
+	if less {
+		return -1
+	}
+	if greater {
+		return 1
+	}
+	return 0
+}
+
+type function func(env map[string]any, args []any) (any, error)
+
+// functions callable from rule expressions
+var functions = map[string]function{
+	// cidr(ip, "10.0.0.0/8", ...) reports whether ip falls in any range
+	"cidr": func(_ map[string]any, args []any) (any, error) {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("cidr expects an ip and at least one range")
+		}
+
+		s, _ := args[0].(string)
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return false, nil
+		}
+
+		for _, arg := range args[1:] {
+			r, _ := arg.(string)
+			_, network, err := net.ParseCIDR(r)
+			if err != nil {
+				return nil, fmt.Errorf("cidr: %w", err)
+			}
+			if network.Contains(ip) {
+				return true, nil
+			}
+		}
+		return false, nil
+	},
+
+	// since(t) is the duration between t and now
+	"since": func(env map[string]any, args []any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("since expects one time")
+		}
+		t, ok := args[0].(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("since expects a time, got %T", args[0])
+		}
+		now, _ := env["now"].(time.Time)
+		return now.Sub(t), nil
+	},
+
+	// hour(t) is t's hour of day, 0-23, in t's location
+	"hour": func(_ map[string]any, args []any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("hour expects one time")
+		}
+		t, ok := args[0].(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("hour expects a time, got %T", args[0])
+		}
+		return float64(t.Hour()), nil
+	},
+
+	// lower(s) lower cases s, for case-insensitive comparison
+	"lower": func(_ map[string]any, args []any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("lower expects one string")
+		}
+		s, _ := args[0].(string)
+		return strings.ToLower(s), nil
+	},
+}
@@ -0,0 +1,40 @@
+package policy
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/otyang/go-authsvc/session"
+)
+
+// Middleware denies requests with 403 unless the engine allows action. The
+// session stored by session.NewContext is used when present, and the
+// request's method, path and remote_ip are exposed as request.*.
+func (e *Engine) Middleware(action string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sn, _ := session.FromContext(r.Context())
+
+			remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				remoteIP = r.RemoteAddr
+			}
+
+			d := e.Evaluate(Input{
+				Action:  action,
+				Session: sn,
+				Request: map[string]any{
+					"method":    r.Method,
+					"path":      r.URL.Path,
+					"remote_ip": remoteIP,
+				},
+			})
+			if !d.Allowed {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
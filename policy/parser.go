@@ -0,0 +1,231 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// node is a parsed expression, evaluated against an environment.
+type node interface {
+	eval(env map[string]any) (any, error)
+}
+
+type (
+	literal  struct{ value any }
+	variable struct{ path []string }
+	listNode struct{ items []node }
+	unary    struct {
+		op      string
+		operand node
+	}
+	binary struct {
+		op          string
+		left, right node
+	}
+	call struct {
+		name string
+		args []node
+	}
+)
+
+// The grammar, loosest binding first:
+//
+//	or      = and { "||" and }
+//	and     = not { "&&" not }
+//	not     = "!" not | compare
+//	compare = primary [ ("==" | "!=" | "<" | "<=" | ">" | ">=" | "in") primary ]
+//	primary = literal | list | call | path | "(" or ")"
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parse(src string) (node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+
+	return n, nil
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, fmt.Errorf("expected %s at %d", what, t.pos)
+	}
+	return t, nil
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	for err == nil && p.peek().kind == tokOp && p.peek().text == "||" {
+		p.next()
+		var right node
+		if right, err = p.and(); err == nil {
+			left = binary{op: "||", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.not()
+	for err == nil && p.peek().kind == tokOp && p.peek().text == "&&" {
+		p.next()
+		var right node
+		if right, err = p.not(); err == nil {
+			left = binary{op: "&&", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) not() (node, error) {
+	if t := p.peek(); t.kind == tokOp && t.text == "!" {
+		p.next()
+		operand, err := p.not()
+		return unary{op: "!", operand: operand}, err
+	}
+	return p.compare()
+}
+
+func (p *parser) compare() (node, error) {
+	left, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	if !(t.kind == tokOp && compareOps[t.text]) && !(t.kind == tokIdent && t.text == "in") {
+		return left, nil
+	}
+	p.next()
+
+	right, err := p.primary()
+	return binary{op: t.text, left: left, right: right}, err
+}
+
+var compareOps = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokString:
+		return literal{t.text}, nil
+
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q at %d", t.text, t.pos)
+		}
+		return literal{f}, nil
+
+	case tokDuration:
+		d, err := time.ParseDuration(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("bad duration %q at %d", t.text, t.pos)
+		}
+		return literal{d}, nil
+
+	case tokLParen:
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.expect(tokRParen, "')'")
+		return n, err
+
+	case tokLBracket:
+		var items []node
+		for p.peek().kind != tokRBracket {
+			item, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+		_, err := p.expect(tokRBracket, "']'")
+		return listNode{items}, err
+
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		case "null":
+			return literal{nil}, nil
+		}
+
+		if p.peek().kind == tokLParen {
+			return p.call(t)
+		}
+
+		path := []string{t.text}
+		for p.peek().kind == tokDot {
+			p.next()
+			field, err := p.expect(tokIdent, "field name")
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, field.text)
+		}
+		return variable{path}, nil
+	}
+
+	if t.kind == tokEOF {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+func (p *parser) call(name token) (node, error) {
+	if _, ok := functions[name.text]; !ok {
+		return nil, fmt.Errorf("unknown function %q at %d", name.text, name.pos)
+	}
+	p.next() // (
+
+	var args []node
+	for p.peek().kind != tokRParen {
+		arg, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.next()
+	}
+
+	_, err := p.expect(tokRParen, "')'")
+	return call{name: name.text, args: args}, err
+}
@@ -0,0 +1,246 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+)
+
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+var ErrDenied = errors.New("denied by policy")
+
+// Rule applies Effect when its When expression is true, e.g.
+//
+//	user.role == "admin" && !cidr(session.ip, "10.0.0.0/8")
+//	since(session.started_at) < 10m && "totp" in session.auth_factors
+//
+// Expressions see session.*, user.*, request.*, action and now; see Input.
+type Rule struct {
+	Name string
+	// Actions limits the rule to these actions; empty applies to all.
+	Actions []string
+	Effect  Effect
+	When    string
+	// Reason is reported when the rule decides the outcome. Name is used
+	// when it is empty.
+	Reason string
+
+	expr node
+}
+
+// Input is everything a rule can look at.
+type Input struct {
+	Action  string
+	Session *dto.Session
+	User    *dto.User
+	// Request carries caller supplied attributes, e.g. amount or path.
+	Request map[string]any
+	// Now defaults to time.Now.
+	Now time.Time
+}
+
+type Decision struct {
+	Allowed bool
+	Reasons []string
+}
+
+func (d Decision) Err() error {
+	if d.Allowed {
+		return nil
+	}
+	return fmt.Errorf("%w: %v", ErrDenied, d.Reasons)
+}
+
+// Engine evaluates rules with deny overrides: any matching deny rule denies,
+// otherwise any matching allow rule allows, otherwise the default applies.
+// A rule that fails to evaluate counts as a matching deny.
+type Engine struct {
+	rules []Rule
+	def   Effect
+}
+
+// New compiles the rules, returning an error on the first that does not
+// parse.
+func New(def Effect, rules ...Rule) (*Engine, error) {
+	compiled := make([]Rule, 0, len(rules))
+
+	for _, r := range rules {
+		if r.Effect != Allow && r.Effect != Deny {
+			return nil, fmt.Errorf("rule %q: effect must be allow or deny", r.Name)
+		}
+
+		expr, err := parse(r.When)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+
+		r.expr = expr
+		compiled = append(compiled, r)
+	}
+
+	return &Engine{rules: compiled, def: def}, nil
+}
+
+func (e *Engine) Evaluate(in Input) Decision {
+	var (
+		env     = in.env()
+		denies  []string
+		allowed []string
+	)
+
+	for _, r := range e.rules {
+		if !r.appliesTo(in.Action) {
+			continue
+		}
+
+		v, err := r.expr.eval(env)
+		if err != nil {
+			denies = append(denies, fmt.Sprintf("%s: %s", r.Name, err))
+			continue
+		}
+
+		if matched, _ := v.(bool); !matched {
+			continue
+		}
+
+		if r.Effect == Deny {
+			denies = append(denies, r.reason())
+		} else {
+			allowed = append(allowed, r.reason())
+		}
+	}
+
+	switch {
+	case len(denies) > 0:
+		return Decision{Allowed: false, Reasons: denies}
+	case len(allowed) > 0:
+		return Decision{Allowed: true, Reasons: allowed}
+	case e.def == Allow:
+		return Decision{Allowed: true, Reasons: []string{"allowed by default"}}
+	default:
+		return Decision{Allowed: false, Reasons: []string{"no rule allowed this request"}}
+	}
+}
+
+func (r Rule) appliesTo(action string) bool {
+	if len(r.Actions) == 0 {
+		return true
+	}
+	for _, a := range r.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) reason() string {
+	if r.Reason != "" {
+		return r.Reason
+	}
+	return r.Name
+}
+
+func (in Input) env() map[string]any {
+	now := in.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	user := in.User
+	if user == nil && in.Session != nil {
+		user = &in.Session.User
+	}
+
+	request := map[string]any{}
+	for k, v := range in.Request {
+		request[k] = normalize(v)
+	}
+
+	return map[string]any{
+		"action":  in.Action,
+		"now":     now,
+		"session": sessionEnv(in.Session),
+		"user":    userEnv(user),
+		"request": request,
+	}
+}
+
+// sessionEnv and userEnv return an untyped nil when absent, so that
+// expressions like session == null hold.
+func sessionEnv(s *dto.Session) any {
+	if s == nil {
+		return nil
+	}
+
+	factors := make([]any, 0, len(s.AuthFactors))
+	for _, f := range s.AuthFactors {
+		factors = append(factors, f)
+	}
+
+	return map[string]any{
+		"id":           s.ID,
+		"ip":           s.DeviceIPAddress,
+		"user_agent":   s.DeviceUserAgent,
+		"device_type":  s.DeviceType,
+		"city":         s.IPAddressCity,
+		"country":      s.IPAddressCountry,
+		"started_at":   s.StartedAt,
+		"expires_at":   s.ExpiresAt,
+		"auth_factors": factors,
+	}
+}
+
+func userEnv(u *dto.User) any {
+	if u == nil {
+		return nil
+	}
+
+	return map[string]any{
+		"id":             u.UserID,
+		"system_user_id": u.SytstemUserID,
+		"role":           u.TrustedMetadata.UserRole,
+		"email":          deref(u.Email),
+		"email_verified": u.EmailIsVerified,
+		"phone_verified": u.PhoneIsVerified,
+		"totp_enabled":   u.TotpIsEnabled,
+		"active":         u.IsAccountActive,
+		"created_at":     u.CreatedAt,
+	}
+}
+
+// normalize maps Go values onto the handful of types expressions use.
+func normalize(v any) any {
+	switch x := v.(type) {
+	case int:
+		return float64(x)
+	case int32:
+		return float64(x)
+	case int64:
+		return float64(x)
+	case float32:
+		return float64(x)
+	case []string:
+		out := make([]any, 0, len(x))
+		for _, s := range x {
+			out = append(out, s)
+		}
+		return out
+	}
+	return v
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,224 @@
+package policy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/session"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testNow = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testSession(role, ip string, age time.Duration, factors ...string) *dto.Session {
+	return &dto.Session{
+		ID:               "session-1",
+		DeviceIPAddress:  ip,
+		IPAddressCountry: "NG",
+		StartedAt:        testNow.Add(-age),
+		AuthFactors:      factors,
+		User:             dto.User{UserID: "user-1", TrustedMetadata: dto.TrustedMetadata{SystemMetadata: dto.SystemMetadata{UserRole: role}}},
+	}
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	engine, err := New(Allow,
+		Rule{
+			Name:   "admin-office-only",
+			Effect: Deny,
+			When:   `user.role == "admin" && !cidr(session.ip, "10.0.0.0/8", "192.168.1.0/24")`,
+			Reason: "admins must sign in from the office",
+		},
+		Rule{
+			Name:    "payout-step-up",
+			Actions: []string{"payout"},
+			Effect:  Deny,
+			When:    `!(since(session.started_at) < 10m && "totp" in session.auth_factors)`,
+			Reason:  "payouts need a fresh session with totp",
+		},
+		Rule{
+			Name:    "payout-limit",
+			Actions: []string{"payout"},
+			Effect:  Deny,
+			When:    `request.amount > 5000 && session.country in ["NG", "GH"]`,
+		},
+	)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name        string
+		input       Input
+		wantAllowed bool
+		wantReasons []string
+	}{
+		{
+			name:        "admin in office",
+			input:       Input{Action: "view", Session: testSession("admin", "10.1.2.3", time.Hour)},
+			wantAllowed: true,
+			wantReasons: []string{"allowed by default"},
+		},
+		{
+			name:        "admin outside office",
+			input:       Input{Action: "view", Session: testSession("admin", "8.8.8.8", time.Hour)},
+			wantReasons: []string{"admins must sign in from the office"},
+		},
+		{
+			name:        "payout on fresh totp session",
+			input:       Input{Action: "payout", Session: testSession("customer", "8.8.8.8", 5*time.Minute, "password", "totp")},
+			wantAllowed: true,
+			wantReasons: []string{"allowed by default"},
+		},
+		{
+			name:        "payout on old session",
+			input:       Input{Action: "payout", Session: testSession("customer", "8.8.8.8", time.Hour, "password", "totp")},
+			wantReasons: []string{"payouts need a fresh session with totp"},
+		},
+		{
+			name: "payout over limit",
+			input: Input{
+				Action:  "payout",
+				Session: testSession("customer", "8.8.8.8", time.Minute, "totp"),
+				Request: map[string]any{"amount": 9000},
+			},
+			wantReasons: []string{"payout-limit"},
+		},
+		{
+			name:        "no session fails closed",
+			input:       Input{Action: "payout"},
+			wantReasons: []string{"payout-step-up: since expects a time, got <nil>"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.input.Now = testNow
+			got := engine.Evaluate(tc.input)
+
+			assert.Equal(t, tc.wantAllowed, got.Allowed)
+			assert.Equal(t, tc.wantReasons, got.Reasons)
+			if !tc.wantAllowed {
+				assert.ErrorIs(t, got.Err(), ErrDenied)
+			}
+		})
+	}
+}
+
+func TestEngine_DefaultDeny(t *testing.T) {
+	engine, err := New(Deny, Rule{Name: "staff", Effect: Allow, When: `user.role in ["admin", "support"]`})
+	assert.NoError(t, err)
+
+	assert.True(t, engine.Evaluate(Input{Session: testSession("support", "", 0)}).Allowed)
+	assert.False(t, engine.Evaluate(Input{Session: testSession("customer", "", 0)}).Allowed)
+}
+
+func TestNew_InvalidRule(t *testing.T) {
+	testCases := []struct {
+		name string
+		rule Rule
+	}{
+		{name: "unterminated string", rule: Rule{Effect: Deny, When: `user.role == "admin`}},
+		{name: "unknown function", rule: Rule{Effect: Deny, When: `geo(session.ip)`}},
+		{name: "dangling operator", rule: Rule{Effect: Deny, When: `user.role ==`}},
+		{name: "trailing tokens", rule: Rule{Effect: Deny, When: `true false`}},
+		{name: "bad effect", rule: Rule{Effect: "maybe", When: `true`}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(Allow, tc.rule)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestExpressions(t *testing.T) {
+	env := Input{
+		Now:     testNow,
+		Session: testSession("admin", "192.168.1.9", 90*time.Second, "otp"),
+		Request: map[string]any{"tags": []string{"a", "b"}},
+	}.env()
+
+	testCases := []struct {
+		expr string
+		want any
+	}{
+		{`1 + 1`, nil},
+		{`user.role == "admin" || false`, true},
+		{`!(user.role != 'admin')`, true},
+		{`since(session.started_at) >= 1m30s`, true},
+		{`hour(now) == 12`, true},
+		{`"b" in request.tags`, true},
+		{`"c" in request.tags`, false},
+		{`request.missing == null`, true},
+		{`lower("NG") == "ng"`, true},
+		{`session.started_at < now`, true},
+		{`session == session`, true},
+		{`request.tags == request.tags`, true},
+		{`request.tags == ["a", "b"]`, true},
+		{`session == null`, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			n, err := parse(tc.expr)
+			if tc.want == nil {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			got, err := n.eval(env)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestExpressions_NoSession(t *testing.T) {
+	env := Input{Request: map[string]any{"meta": map[string]any{"plan": "pro"}}}.env()
+
+	testCases := []struct {
+		expr string
+		want bool
+	}{
+		{`session == null`, true},
+		{`user == null`, true},
+		{`session.id == null`, true},
+		{`request.meta == request.meta`, true},
+		{`request.meta.plan == "pro"`, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			n, err := parse(tc.expr)
+			assert.NoError(t, err)
+
+			got, err := n.eval(env)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestEngine_Middleware(t *testing.T) {
+	engine, err := New(Deny, Rule{Name: "get-only", Effect: Allow, When: `request.method == "GET" && session.id != null`})
+	assert.NoError(t, err)
+
+	handler := engine.Middleware("read")(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for method, want := range map[string]int{http.MethodGet: http.StatusNoContent, http.MethodPost: http.StatusForbidden} {
+		req := httptest.NewRequest(method, "/", nil)
+		req = req.WithContext(session.NewContext(context.TODO(), testSession("customer", "", 0)))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, want, rec.Code, method)
+	}
+}
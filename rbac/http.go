@@ -0,0 +1,29 @@
+package rbac
+
+import (
+	"net/http"
+
+	"github.com/otyang/go-authsvc/session"
+)
+
+// RequirePermission returns middleware that lets a request through only if
+// the session placed in its context by session.NewContext holds every perm.
+// It answers 401 without a session and 403 when a permission is missing.
+func (r *Registry) RequirePermission(perms ...Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			s, ok := session.FromContext(req.Context())
+			if !ok {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			if err := r.Require(s, perms...); err != nil {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
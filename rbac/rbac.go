@@ -0,0 +1,180 @@
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/otyang/go-authsvc/dto"
+)
+
+type Permission string
+
+// PermRoleAdmin is required to change any user's role.
+const PermRoleAdmin Permission = "roles:admin"
+
+const (
+	RoleCustomer = "customer"
+	RoleAdmin    = "admin"
+)
+
+var (
+	ErrUnknownRole = errors.New("unknown role")
+	ErrForbidden   = errors.New("permission denied")
+	ErrRoleCycle   = errors.New("role inheritance cycle")
+)
+
+type Role struct {
+	Name        string
+	Permissions []Permission
+	// Inherits lists roles whose permissions this role also holds.
+	Inherits []string
+}
+
+// Registry holds the known roles. It is safe for concurrent use.
+type Registry struct {
+	mu    sync.RWMutex
+	roles map[string]Role
+}
+
+func NewRegistry() *Registry {
+	return &Registry{roles: map[string]Role{}}
+}
+
+// DefaultRegistry knows the "customer" role every user starts with and an
+// "admin" role that may manage roles.
+func DefaultRegistry() *Registry {
+	r := NewRegistry()
+	_ = r.Register(Role{Name: RoleCustomer})
+	_ = r.Register(Role{Name: RoleAdmin, Permissions: []Permission{PermRoleAdmin}, Inherits: []string{RoleCustomer}})
+	return r
+}
+
+// Register adds or replaces a role. Every inherited role must already be
+// registered, and the result must not introduce a cycle.
+func (r *Registry) Register(role Role) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, parent := range role.Inherits {
+		if _, ok := r.roles[parent]; !ok && parent != role.Name {
+			return fmt.Errorf("%w: %s inherits %s", ErrUnknownRole, role.Name, parent)
+		}
+	}
+
+	prev, existed := r.roles[role.Name]
+	r.roles[role.Name] = role
+
+	if r.hasCycle(role.Name, map[string]bool{}) {
+		if existed {
+			r.roles[role.Name] = prev
+		} else {
+			delete(r.roles, role.Name)
+		}
+		return fmt.Errorf("%w: %s", ErrRoleCycle, role.Name)
+	}
+
+	return nil
+}
+
+// Validate returns ErrUnknownRole if name is not registered.
+func (r *Registry) Validate(name string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.roles[name]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownRole, name)
+	}
+	return nil
+}
+
+// Permissions returns every permission held by role, inherited ones included.
+func (r *Registry) Permissions(role string) []Permission {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var (
+		perms []Permission
+		seen  = map[Permission]bool{}
+	)
+
+	r.walk(role, map[string]bool{}, func(p Permission) {
+		if !seen[p] {
+			seen[p] = true
+			perms = append(perms, p)
+		}
+	})
+
+	return perms
+}
+
+// HasPermission reports whether role holds perm directly or by inheritance.
+func (r *Registry) HasPermission(role string, perm Permission) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	found := false
+	r.walk(role, map[string]bool{}, func(p Permission) {
+		found = found || p == perm
+	})
+
+	return found
+}
+
+// Can reports whether the session's user holds perm.
+func (r *Registry) Can(s *dto.Session, perm Permission) bool {
+	if s == nil {
+		return false
+	}
+	return r.HasPermission(s.User.TrustedMetadata.UserRole, perm)
+}
+
+// Require is Can returning ErrForbidden on refusal.
+func (r *Registry) Require(s *dto.Session, perms ...Permission) error {
+	for _, p := range perms {
+		if !r.Can(s, p) {
+			return fmt.Errorf("%w: %s", ErrForbidden, p)
+		}
+	}
+	return nil
+}
+
+func (r *Registry) walk(name string, visited map[string]bool, fn func(Permission)) {
+	role, ok := r.roles[name]
+	if !ok || visited[name] {
+		return
+	}
+	visited[name] = true
+
+	for _, p := range role.Permissions {
+		fn(p)
+	}
+
+	for _, parent := range role.Inherits {
+		r.walk(parent, visited, fn)
+	}
+}
+
+func (r *Registry) hasCycle(name string, stack map[string]bool) bool {
+	if stack[name] {
+		return true
+	}
+	stack[name] = true
+	defer delete(stack, name)
+
+	for _, parent := range r.roles[name].Inherits {
+		if r.hasCycle(parent, stack) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Default is the registry used by the package level helpers.
+var Default = DefaultRegistry()
+
+// Can reports whether the session's user holds perm in the Default registry.
+func Can(s *dto.Session, perm Permission) bool {
+	return Default.Can(s, perm)
+}
@@ -0,0 +1,107 @@
+package rbac
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/session"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testRegistry(t *testing.T) *Registry {
+	r := DefaultRegistry()
+	assert.NoError(t, r.Register(Role{Name: "support", Permissions: []Permission{"users:read"}, Inherits: []string{RoleCustomer}}))
+	assert.NoError(t, r.Register(Role{Name: "superadmin", Permissions: []Permission{"payouts:approve"}, Inherits: []string{RoleAdmin, "support"}}))
+	return r
+}
+
+func sessionWithRole(role string) *dto.Session {
+	return &dto.Session{User: dto.User{TrustedMetadata: dto.TrustedMetadata{SystemMetadata: dto.SystemMetadata{UserRole: role}}}}
+}
+
+func TestRegistry_HasPermission(t *testing.T) {
+	r := testRegistry(t)
+
+	testCases := []struct {
+		role string
+		perm Permission
+		want bool
+	}{
+		{role: RoleCustomer, perm: PermRoleAdmin, want: false},
+		{role: RoleAdmin, perm: PermRoleAdmin, want: true},
+		{role: "support", perm: "users:read", want: true},
+		{role: "support", perm: PermRoleAdmin, want: false},
+		{role: "superadmin", perm: "users:read", want: true},
+		{role: "superadmin", perm: PermRoleAdmin, want: true},
+		{role: "unknown", perm: "users:read", want: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.role+"/"+string(tc.perm), func(t *testing.T) {
+			assert.Equal(t, tc.want, r.HasPermission(tc.role, tc.perm))
+			assert.Equal(t, tc.want, r.Can(sessionWithRole(tc.role), tc.perm))
+		})
+	}
+
+	assert.ElementsMatch(t, []Permission{"payouts:approve", PermRoleAdmin, "users:read"}, r.Permissions("superadmin"))
+}
+
+func TestRegistry_Register(t *testing.T) {
+	r := testRegistry(t)
+
+	err := r.Register(Role{Name: "ghost", Inherits: []string{"missing"}})
+	assert.ErrorIs(t, err, ErrUnknownRole)
+
+	// customer -> superadmin would close a loop through admin
+	err = r.Register(Role{Name: RoleCustomer, Inherits: []string{"superadmin"}})
+	assert.ErrorIs(t, err, ErrRoleCycle)
+	assert.False(t, r.HasPermission(RoleCustomer, PermRoleAdmin))
+
+	assert.NoError(t, r.Validate("support"))
+	assert.ErrorIs(t, r.Validate("ghost"), ErrUnknownRole)
+}
+
+func TestRegistry_Require(t *testing.T) {
+	r := testRegistry(t)
+
+	assert.NoError(t, r.Require(sessionWithRole(RoleAdmin), PermRoleAdmin))
+	assert.ErrorIs(t, r.Require(sessionWithRole(RoleCustomer), PermRoleAdmin), ErrForbidden)
+	assert.ErrorIs(t, r.Require(nil, PermRoleAdmin), ErrForbidden)
+}
+
+func TestRegistry_RequirePermission(t *testing.T) {
+	var (
+		r       = testRegistry(t)
+		handler = r.RequirePermission("users:read")(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	)
+
+	testCases := []struct {
+		name    string
+		session *dto.Session
+		want    int
+	}{
+		{name: "no session", session: nil, want: http.StatusUnauthorized},
+		{name: "missing permission", session: sessionWithRole(RoleCustomer), want: http.StatusForbidden},
+		{name: "allowed", session: sessionWithRole("support"), want: http.StatusNoContent},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.session != nil {
+				req = req.WithContext(session.NewContext(context.TODO(), tc.session))
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Package rbacgrpc enforces rbac permissions on gRPC servers. It expects an
+// earlier interceptor to have stored the caller's session with
+// session.NewContext.
+package rbacgrpc
+
+import (
+	"context"
+
+	"github.com/otyang/go-authsvc/rbac"
+	"github.com/otyang/go-authsvc/session"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MethodPermissions maps a full method name, e.g. "/pkg.Service/Method", to
+// the permissions it requires. Methods not listed are let through.
+type MethodPermissions map[string][]rbac.Permission
+
+func UnaryServerInterceptor(reg *rbac.Registry, perms MethodPermissions) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := authorize(ctx, reg, perms[info.FullMethod]); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func StreamServerInterceptor(reg *rbac.Registry, perms MethodPermissions) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authorize(ss.Context(), reg, perms[info.FullMethod]); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func authorize(ctx context.Context, reg *rbac.Registry, perms []rbac.Permission) error {
+	if len(perms) == 0 {
+		return nil
+	}
+
+	s, ok := session.FromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "no session")
+	}
+
+	if err := reg.Require(s, perms...); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package risk
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AttemptStore counts failed sign-ins by key, normally the email address.
+type AttemptStore interface {
+	RecordFailure(ctx context.Context, key string, at time.Time) error
+	// Failures counts the failures recorded for key since the given time.
+	Failures(ctx context.Context, key string, since time.Time) (int, error)
+	// Reset forgets key's failures, as after a successful sign-in.
+	Reset(ctx context.Context, key string) error
+}
+
+// AttemptKey normalises an email address into an AttemptStore key.
+func AttemptKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// maxRememberedFailures bounds the failures MemoryAttemptStore keeps per key.
+const maxRememberedFailures = 100
+
+// DefaultAttemptRetention is how long MemoryAttemptStore keeps a failure.
+const DefaultAttemptRetention = 24 * time.Hour
+
+// MemoryAttemptStore keeps failures in memory, for tests and single process
+// setups. Failures older than its retention are swept as new ones come in.
+type MemoryAttemptStore struct {
+	mu        sync.Mutex
+	failures  map[string][]time.Time
+	retention time.Duration
+	swept     time.Time
+}
+
+// NewMemoryAttemptStore keeps failures for retention, which must cover the
+// Window of FailedAttempts; 0 means DefaultAttemptRetention.
+func NewMemoryAttemptStore(retention time.Duration) *MemoryAttemptStore {
+	if retention <= 0 {
+		retention = DefaultAttemptRetention
+	}
+	return &MemoryAttemptStore{failures: map[string][]time.Time{}, retention: retention}
+}
+
+func (m *MemoryAttemptStore) RecordFailure(ctx context.Context, key string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(at)
+
+	f := append(m.failures[key], at)
+	if len(f) > maxRememberedFailures {
+		f = f[len(f)-maxRememberedFailures:]
+	}
+	m.failures[key] = f
+
+	return nil
+}
+
+// sweep drops failures past retention, at most once per tenth of it, and
+// keys left with none.
+func (m *MemoryAttemptStore) sweep(now time.Time) {
+	if now.Sub(m.swept) < m.retention/10 {
+		return
+	}
+	m.swept = now
+
+	cutoff := now.Add(-m.retention)
+	for key, f := range m.failures {
+		i := 0
+		for i < len(f) && f[i].Before(cutoff) {
+			i++
+		}
+
+		if i == len(f) {
+			delete(m.failures, key)
+		} else if i > 0 {
+			m.failures[key] = append([]time.Time(nil), f[i:]...)
+		}
+	}
+}
+
+func (m *MemoryAttemptStore) Failures(ctx context.Context, key string, since time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for _, at := range m.failures[key] {
+		if !at.Before(since) {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (m *MemoryAttemptStore) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.failures, key)
+	return nil
+}
@@ -0,0 +1,289 @@
+package risk
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ImpossibleTravel flags a session started too far, too soon, from where
+// another session of the user started.
+type ImpossibleTravel struct {
+	// MaxSpeedKmh is the fastest believable travel; 0 means 900, an airliner
+	MaxSpeedKmh float64
+	// MinDistanceKm ignores hops GeoIP cannot resolve reliably; 0 means 100
+	MinDistanceKm float64
+	// Sessions without coordinates are compared by country. CountryWindow
+	// is how soon a different country counts; 0 means one hour.
+	CountryWindow time.Duration
+	// Score of a finding; 0 means 80, or half that for a country change
+	Score int
+}
+
+func (t ImpossibleTravel) Detect(ctx context.Context, in Input) ([]Finding, error) {
+	var (
+		maxSpeed = orFloat(t.MaxSpeedKmh, 900)
+		minDist  = orFloat(t.MinDistanceKm, 100)
+		window   = t.CountryWindow
+		score    = orInt(t.Score, 80)
+	)
+	if window == 0 {
+		window = time.Hour
+	}
+
+	var worst *Finding
+
+	for _, o := range in.Others {
+		elapsed := in.At.Sub(o.StartedAt)
+		if elapsed < 0 {
+			elapsed = -elapsed
+		}
+
+		var f *Finding
+		switch {
+		case hasCoords(in.Claims.IPAddressLatitude, in.Claims.IPAddressLongitude) && hasCoords(o.IPAddressLatitude, o.IPAddressLongitude):
+			km := distanceKm(o.IPAddressLatitude, o.IPAddressLongitude, in.Claims.IPAddressLatitude, in.Claims.IPAddressLongitude)
+			if km < minDist {
+				continue
+			}
+			speed := km / math.Max(elapsed.Hours(), 1.0/3600)
+			if speed <= maxSpeed {
+				continue
+			}
+			f = &Finding{
+				Detector: "impossible_travel",
+				Score:    score,
+				Reason: fmt.Sprintf("%s to %s: %.0f km in %s (%.0f km/h)",
+					place(o.IPAddressCity, o.IPAddressCountry), place(in.Claims.IPAddressCity, in.Claims.IPAddressCountry),
+					km, elapsed.Round(time.Minute), speed),
+			}
+		case o.IPAddressCountry != "" && in.Claims.IPAddressCountry != "" && o.IPAddressCountry != in.Claims.IPAddressCountry && elapsed < window:
+			f = &Finding{
+				Detector: "impossible_travel",
+				Score:    score / 2,
+				Reason:   fmt.Sprintf("%s to %s in %s", o.IPAddressCountry, in.Claims.IPAddressCountry, elapsed.Round(time.Minute)),
+			}
+		default:
+			continue
+		}
+
+		if worst == nil || f.Score > worst.Score {
+			worst = f
+		}
+	}
+
+	if worst == nil {
+		return nil, nil
+	}
+	return []Finding{*worst}, nil
+}
+
+// IPBurst flags many sessions from different IPs started in a short time,
+// as credential stuffing or a shared password tends to produce.
+type IPBurst struct {
+	// Window defaults to ten minutes
+	Window time.Duration
+	// MaxIPs is how many distinct IPs, the new one included, are normal in
+	// Window; 0 means 3
+	MaxIPs int
+	// Score of a finding; 0 means 60
+	Score int
+}
+
+func (b IPBurst) Detect(ctx context.Context, in Input) ([]Finding, error) {
+	var (
+		window = b.Window
+		maxIPs = orInt(b.MaxIPs, 3)
+		score  = orInt(b.Score, 60)
+	)
+	if window == 0 {
+		window = 10 * time.Minute
+	}
+
+	ips := map[string]bool{}
+	if in.Claims.DeviceIPAddress != "" {
+		ips[in.Claims.DeviceIPAddress] = true
+	}
+	for _, o := range in.Others {
+		if o.DeviceIPAddress != "" && in.At.Sub(o.StartedAt) <= window && o.StartedAt.Sub(in.At) <= window {
+			ips[o.DeviceIPAddress] = true
+		}
+	}
+
+	if len(ips) <= maxIPs {
+		return nil, nil
+	}
+
+	return []Finding{{
+		Detector: "ip_burst",
+		Score:    score,
+		Reason:   fmt.Sprintf("sign-ins from %d IP addresses within %s", len(ips), window),
+	}}, nil
+}
+
+// DefaultDatacenterASNs are networks of large hosting providers, where
+// people rarely browse from.
+var DefaultDatacenterASNs = map[uint]string{
+	16509:  "Amazon AWS",
+	14618:  "Amazon AWS",
+	8075:   "Microsoft Azure",
+	396982: "Google Cloud",
+	14061:  "DigitalOcean",
+	16276:  "OVH",
+	24940:  "Hetzner",
+	63949:  "Linode",
+	20473:  "Vultr",
+	45102:  "Alibaba Cloud",
+	31898:  "Oracle Cloud",
+}
+
+// Network flags a session from a TOR exit node or a datacenter when none of
+// the user's other sessions came from such a network.
+type Network struct {
+	// DatacenterASNs maps ASNs to provider names; nil means DefaultDatacenterASNs
+	DatacenterASNs map[uint]string
+	// TorExits lists TOR exit node addresses; see LoadTorExits
+	TorExits *TorExits
+	// Scores of findings; 0 means 70 for TOR and 50 for a datacenter
+	TorScore        int
+	DatacenterScore int
+}
+
+func (n Network) Detect(ctx context.Context, in Input) ([]Finding, error) {
+	dc := n.DatacenterASNs
+	if dc == nil {
+		dc = DefaultDatacenterASNs
+	}
+
+	var (
+		usedTor, usedDC bool
+		findings        []Finding
+	)
+	for _, o := range in.Others {
+		usedTor = usedTor || n.TorExits.Contains(o.DeviceIPAddress)
+		_, ok := dc[o.IPAddressASN]
+		usedDC = usedDC || ok
+	}
+
+	if n.TorExits.Contains(in.Claims.DeviceIPAddress) && !usedTor {
+		findings = append(findings, Finding{
+			Detector: "tor",
+			Score:    orInt(n.TorScore, 70),
+			Reason:   "signed in through the TOR network",
+		})
+	}
+
+	if name, ok := dc[in.Claims.IPAddressASN]; ok && !usedDC {
+		findings = append(findings, Finding{
+			Detector: "datacenter",
+			Score:    orInt(n.DatacenterScore, 50),
+			Reason:   fmt.Sprintf("signed in from a datacenter network (AS%d %s)", in.Claims.IPAddressASN, name),
+		})
+	}
+
+	return findings, nil
+}
+
+// TorExits is a set of TOR exit node addresses that can be refreshed while
+// in use. A nil *TorExits contains nothing.
+type TorExits struct {
+	mu  sync.RWMutex
+	ips map[string]bool
+}
+
+// LoadTorExits reads one address per line, as in the Tor Project's bulk
+// exit list; blank lines and lines starting with # are skipped.
+func LoadTorExits(r io.Reader) (*TorExits, error) {
+	t := &TorExits{}
+	return t, t.Reload(r)
+}
+
+// Reload replaces the addresses with those read from r.
+func (t *TorExits) Reload(r io.Reader) error {
+	ips := map[string]bool{}
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if ip := net.ParseIP(line); ip != nil {
+			ips[ip.String()] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.ips = ips
+	t.mu.Unlock()
+
+	return nil
+}
+
+func (t *TorExits) Contains(ip string) bool {
+	if t == nil {
+		return false
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.ips[parsed.String()]
+}
+
+const earthRadiusKm = 6371
+
+// distanceKm is the great-circle distance between two points.
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := func(d float64) float64 { return d * math.Pi / 180 }
+
+	dLat := rad(lat2 - lat1)
+	dLon := rad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+func hasCoords(lat, lon float64) bool {
+	return lat != 0 || lon != 0
+}
+
+func place(city, country string) string {
+	switch {
+	case city != "" && country != "":
+		return city + ", " + country
+	case city != "":
+		return city
+	case country != "":
+		return country
+	default:
+		return "unknown location"
+	}
+}
+
+func orFloat(v, def float64) float64 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+func orInt(v, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,287 @@
+package risk
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/hook"
+	"github.com/otyang/go-authsvc/notify"
+	"github.com/otyang/go-authsvc/session"
+)
+
+// Action is what the Monitor does about a risky session.
+type Action string
+
+const (
+	ActionNone Action = ""
+	// ActionAlert lets the session through and tells the user
+	ActionAlert Action = "alert"
+	// ActionStepUp refuses the session with session.ErrStepUpRequired
+	// until a factor is authenticated on it after the decision, with
+	// SessionService.StartStepUp and StepUp
+	ActionStepUp Action = "step_up"
+	// ActionRevoke signs the session out and tells the user
+	ActionRevoke Action = "revoke"
+)
+
+// NotificationType is the Type of the notifications the Monitor sends.
+const NotificationType = "suspicious_activity"
+
+// Rule takes Action on sessions scoring MinScore or more.
+type Rule struct {
+	MinScore int
+	Action   Action
+}
+
+// DefaultRules alert from a score of 40, ask for step-up from 60 and
+// revoke from 90.
+var DefaultRules = []Rule{
+	{MinScore: 90, Action: ActionRevoke},
+	{MinScore: 60, Action: ActionStepUp},
+	{MinScore: 40, Action: ActionAlert},
+}
+
+// DefaultCacheTTL is how long a session's decision is reused before its
+// sessions are listed and assessed again.
+const DefaultCacheTTL = 5 * time.Minute
+
+// SessionLister lists a user's sessions; *session.SessionService
+// implements it.
+type SessionLister interface {
+	List(ctx context.Context, userID string, currentSessionID string) ([]dto.SessionListResponse, error)
+}
+
+// Notifier delivers alerts; *notify.Router implements it.
+type Notifier interface {
+	Notify(ctx context.Context, n notify.Notification) error
+}
+
+// Decision is an assessment and the action its score calls for.
+type Decision struct {
+	Assessment
+	Action Action `json:"action,omitempty"`
+}
+
+// DecisionError refuses a session. It matches session.ErrStepUpRequired or
+// session.ErrSessionRevoked with errors.Is, and carries the findings.
+type DecisionError struct {
+	Decision Decision
+	err      error
+}
+
+func (e *DecisionError) Error() string {
+	return e.err.Error()
+}
+
+func (e *DecisionError) Is(target error) bool {
+	return target == e.err
+}
+
+// Monitor assesses sessions as Authenticate verifies them and acts on the
+// result. It implements session.SessionChecker.
+type Monitor struct {
+	sessions  SessionLister
+	detectors []Detector
+	rules     []Rule
+	revoke    func(ctx context.Context, sessionID string) error
+	notifier  Notifier
+	hooks     *hook.Hooks
+	cacheTTL  time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedDecision
+}
+
+type cachedDecision struct {
+	decision Decision
+	at       time.Time
+	// stepUpAt is when the session was first asked to step up; only a
+	// factor authenticated after it answers the challenge
+	stepUpAt time.Time
+}
+
+// reportedTTL is how long a decision is remembered, past its reuse, so the
+// same findings are not reported twice.
+const reportedTTL = 24 * time.Hour
+
+type MonitorOption func(*Monitor)
+
+// WithDetectors replaces the default detectors: ImpossibleTravel, IPBurst
+// and Network, with their default settings.
+func WithDetectors(d ...Detector) MonitorOption {
+	return func(m *Monitor) { m.detectors = d }
+}
+
+// WithRules replaces DefaultRules. The first rule whose MinScore the score
+// reaches wins, so list them highest first.
+func WithRules(r ...Rule) MonitorOption {
+	return func(m *Monitor) { m.rules = r }
+}
+
+// WithRevoker sets how ActionRevoke signs a session out, normally
+// SessionService.Logout by session id. Without it ActionRevoke only refuses
+// the session.
+func WithRevoker(fn func(ctx context.Context, sessionID string) error) MonitorOption {
+	return func(m *Monitor) { m.revoke = fn }
+}
+
+// WithNotifier tells users, in the security category, about sessions that
+// were alerted on or revoked.
+func WithNotifier(n Notifier) MonitorOption {
+	return func(m *Monitor) { m.notifier = n }
+}
+
+// WithHooks emits hook.EventRiskDetected for every session with findings.
+func WithHooks(h *hook.Hooks) MonitorOption {
+	return func(m *Monitor) { m.hooks = h }
+}
+
+func WithCacheTTL(d time.Duration) MonitorOption {
+	return func(m *Monitor) { m.cacheTTL = d }
+}
+
+func NewMonitor(sessions SessionLister, opts ...MonitorOption) *Monitor {
+	m := &Monitor{
+		sessions:  sessions,
+		detectors: []Detector{ImpossibleTravel{}, IPBurst{}, Network{}},
+		rules:     DefaultRules,
+		cacheTTL:  DefaultCacheTTL,
+		cache:     map[string]cachedDecision{},
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// Evaluate assesses a session against the user's other sessions.
+func (m *Monitor) Evaluate(ctx context.Context, info session.SessionInfo) (Decision, error) {
+	list, err := m.sessions.List(ctx, info.UserID, info.SessionID)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	a, err := Assess(ctx, Input{
+		UserID:    info.UserID,
+		SessionID: info.SessionID,
+		At:        info.StartedAt,
+		Claims:    info.Claims,
+		Others:    Others(list, info.SessionID),
+	}, m.detectors...)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	return Decision{Assessment: a, Action: Decide(a.Score, m.rules)}, nil
+}
+
+// CheckSession implements session.SessionChecker. A session is assessed
+// once per cache period. Its findings are reported, and a revoke carried
+// out, the first time or when its score rises.
+func (m *Monitor) CheckSession(ctx context.Context, info session.SessionInfo) error {
+	c, fresh, err := m.decide(ctx, info)
+	if err != nil {
+		return err
+	}
+	d := c.decision
+
+	if fresh {
+		m.report(ctx, info, d)
+	}
+
+	switch d.Action {
+	case ActionStepUp:
+		// factors the session started with do not count, only one
+		// authenticated since the challenge, as with SessionService.StepUp
+		if info.LastAuthenticatedAt.After(c.stepUpAt) {
+			return nil
+		}
+		return &DecisionError{Decision: d, err: session.ErrStepUpRequired}
+	case ActionRevoke:
+		if fresh && m.revoke != nil {
+			if err := m.revoke(ctx, info.SessionID); err != nil {
+				return err
+			}
+		}
+		return &DecisionError{Decision: d, err: session.ErrSessionRevoked}
+	}
+
+	return nil
+}
+
+// decide returns the session's decision and whether it is news: the first
+// for the session, or a higher score than before.
+func (m *Monitor) decide(ctx context.Context, info session.SessionInfo) (cachedDecision, bool, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	prev, ok := m.cache[info.SessionID]
+	m.mu.Unlock()
+	if ok && now.Sub(prev.at) < m.cacheTTL {
+		return prev, false, nil
+	}
+
+	d, err := m.Evaluate(ctx, info)
+	if err != nil {
+		return cachedDecision{}, false, err
+	}
+
+	c := cachedDecision{decision: d, at: now}
+	if d.Action == ActionStepUp {
+		c.stepUpAt = now
+		if ok && !prev.stepUpAt.IsZero() {
+			c.stepUpAt = prev.stepUpAt
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, old := range m.cache {
+		if now.Sub(old.at) > reportedTTL {
+			delete(m.cache, id)
+		}
+	}
+	m.cache[info.SessionID] = c
+
+	return c, !ok || d.Score > prev.decision.Score, nil
+}
+
+func (m *Monitor) report(ctx context.Context, info session.SessionInfo, d Decision) {
+	if len(d.Findings) == 0 {
+		return
+	}
+
+	data := map[string]any{
+		"session_id": info.SessionID,
+		"score":      d.Score,
+		"action":     string(d.Action),
+		"findings":   d.Findings,
+		"device":     info.Claims.DeviceName(),
+		"ip":         info.Claims.DeviceIPAddress,
+	}
+
+	m.hooks.Emit(ctx, hook.Event{Type: hook.EventRiskDetected, UserID: info.UserID, Data: data})
+
+	if m.notifier == nil || (d.Action != ActionAlert && d.Action != ActionRevoke) {
+		return
+	}
+
+	body := "We noticed unusual activity on your account: " + d.Findings[0].Reason + "."
+	if d.Action == ActionRevoke {
+		body += " The session was signed out; please change your password."
+	}
+
+	_ = m.notifier.Notify(ctx, notify.Notification{
+		UserID:   info.UserID,
+		Category: dto.CategorySecurity,
+		Type:     NotificationType,
+		Title:    "Unusual activity on your account",
+		Body:     body,
+		Data:     data,
+	})
+}
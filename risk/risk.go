@@ -0,0 +1,90 @@
+// Package risk scores sessions for signs of account takeover, such as
+// impossible travel between sign-ins, bursts of sign-ins from many IPs and
+// switches to TOR or datacenter networks.
+package risk
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+)
+
+// MaxScore is the highest risk score; 0 means nothing was found.
+const MaxScore = 100
+
+// Finding is one reason a session looks risky.
+type Finding struct {
+	Detector string `json:"detector"`
+	// Score is this finding's own risk, 0 to MaxScore
+	Score  int    `json:"score"`
+	Reason string `json:"reason"`
+}
+
+// Input is the session being assessed and the user's other sessions.
+type Input struct {
+	UserID    string
+	SessionID string
+	Email     string // set for sign-ins
+	At        time.Time
+	Claims    dto.SessionClaims
+	// Others are the user's other sessions, as SessionService.List returns them
+	Others []dto.SessionListResponse
+}
+
+// Detector looks for one kind of anomaly.
+type Detector interface {
+	Detect(ctx context.Context, in Input) ([]Finding, error)
+}
+
+type DetectorFunc func(ctx context.Context, in Input) ([]Finding, error)
+
+func (f DetectorFunc) Detect(ctx context.Context, in Input) ([]Finding, error) {
+	return f(ctx, in)
+}
+
+// Assessment is the combined result of the detectors.
+type Assessment struct {
+	Score    int       `json:"score"`
+	Findings []Finding `json:"findings,omitempty"`
+}
+
+// Assess runs every detector on in. The score treats findings as
+// independent chances of takeover: two findings of 50 give 75.
+func Assess(ctx context.Context, in Input, detectors ...Detector) (Assessment, error) {
+	var a Assessment
+
+	for _, d := range detectors {
+		findings, err := d.Detect(ctx, in)
+		if err != nil {
+			return Assessment{}, err
+		}
+		a.Findings = append(a.Findings, findings...)
+	}
+
+	sort.SliceStable(a.Findings, func(i, j int) bool { return a.Findings[i].Score > a.Findings[j].Score })
+	a.Score = combine(a.Findings)
+
+	return a, nil
+}
+
+func combine(findings []Finding) int {
+	safe := 1.0
+	for _, f := range findings {
+		safe *= 1 - float64(clamp(f.Score))/MaxScore
+	}
+
+	return int(math.Round((1 - safe) * MaxScore))
+}
+
+func clamp(score int) int {
+	if score < 0 {
+		return 0
+	}
+	if score > MaxScore {
+		return MaxScore
+	}
+	return score
+}
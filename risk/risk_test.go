@@ -0,0 +1,470 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/hook"
+	"github.com/otyang/go-authsvc/notify"
+	"github.com/otyang/go-authsvc/session"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	london = dto.SessionClaims{
+		DeviceIPAddress:    "81.2.69.142",
+		IPAddressCity:      "London",
+		IPAddressCountry:   "GB",
+		IPAddressLatitude:  51.5142,
+		IPAddressLongitude: -0.0931,
+	}
+	lagos = dto.SessionClaims{
+		DeviceIPAddress:    "102.89.1.1",
+		IPAddressCity:      "Lagos",
+		IPAddressCountry:   "NG",
+		IPAddressLatitude:  6.4541,
+		IPAddressLongitude: 3.3947,
+	}
+)
+
+func other(id string, startedAt time.Time, c dto.SessionClaims) dto.SessionListResponse {
+	return dto.SessionListResponse{
+		SessionID:          id,
+		StartedAt:          startedAt,
+		DeviceIPAddress:    c.DeviceIPAddress,
+		IPAddressCity:      c.IPAddressCity,
+		IPAddressCountry:   c.IPAddressCountry,
+		IPAddressASN:       c.IPAddressASN,
+		IPAddressLatitude:  c.IPAddressLatitude,
+		IPAddressLongitude: c.IPAddressLongitude,
+	}
+}
+
+func TestAssess(t *testing.T) {
+	fixed := func(scores ...int) Detector {
+		return DetectorFunc(func(ctx context.Context, in Input) ([]Finding, error) {
+			var f []Finding
+			for _, s := range scores {
+				f = append(f, Finding{Detector: "fixed", Score: s})
+			}
+			return f, nil
+		})
+	}
+
+	tests := []struct {
+		name      string
+		detectors []Detector
+		want      int
+	}{
+		{"none", nil, 0},
+		{"one", []Detector{fixed(40)}, 40},
+		{"independent", []Detector{fixed(50), fixed(50)}, 75},
+		{"clamped", []Detector{fixed(150, -10)}, MaxScore},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := Assess(context.TODO(), Input{}, tt.detectors...)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, a.Score)
+		})
+	}
+
+	a, _ := Assess(context.TODO(), Input{}, fixed(10), fixed(60))
+	assert.Equal(t, 60, a.Findings[0].Score, "findings are sorted by score")
+
+	boom := errors.New("boom")
+	_, err := Assess(context.TODO(), Input{}, DetectorFunc(func(ctx context.Context, in Input) ([]Finding, error) {
+		return nil, boom
+	}))
+	assert.ErrorIs(t, err, boom)
+}
+
+func TestImpossibleTravel(t *testing.T) {
+	now := time.Now()
+	noCoords := func(c dto.SessionClaims) dto.SessionClaims {
+		c.IPAddressLatitude, c.IPAddressLongitude = 0, 0
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		claims dto.SessionClaims
+		others []dto.SessionListResponse
+		want   int
+	}{
+		{"no other sessions", lagos, nil, 0},
+		{"too fast", lagos, []dto.SessionListResponse{other("s1", now.Add(-time.Hour), london)}, 80},
+		{"plausible flight", lagos, []dto.SessionListResponse{other("s1", now.Add(-12*time.Hour), london)}, 0},
+		{"same place", london, []dto.SessionListResponse{other("s1", now.Add(-time.Minute), london)}, 0},
+		{"country change", noCoords(lagos), []dto.SessionListResponse{other("s1", now.Add(-30*time.Minute), noCoords(london))}, 40},
+		{"country change later", noCoords(lagos), []dto.SessionListResponse{other("s1", now.Add(-2*time.Hour), noCoords(london))}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ImpossibleTravel{}.Detect(context.TODO(), Input{At: now, Claims: tt.claims, Others: tt.others})
+			assert.NoError(t, err)
+
+			if tt.want == 0 {
+				assert.Empty(t, f)
+				return
+			}
+			if assert.Len(t, f, 1) {
+				assert.Equal(t, tt.want, f[0].Score)
+				assert.Equal(t, "impossible_travel", f[0].Detector)
+			}
+		})
+	}
+}
+
+func TestIPBurst(t *testing.T) {
+	now := time.Now()
+	at := func(ip string, ago time.Duration) dto.SessionListResponse {
+		return dto.SessionListResponse{DeviceIPAddress: ip, StartedAt: now.Add(-ago)}
+	}
+	in := Input{At: now, Claims: dto.SessionClaims{DeviceIPAddress: "10.0.0.4"}}
+
+	in.Others = []dto.SessionListResponse{at("10.0.0.1", time.Minute), at("10.0.0.2", time.Minute)}
+	f, _ := IPBurst{}.Detect(context.TODO(), in)
+	assert.Empty(t, f)
+
+	in.Others = append(in.Others, at("10.0.0.3", 5*time.Minute))
+	f, _ = IPBurst{}.Detect(context.TODO(), in)
+	if assert.Len(t, f, 1) {
+		assert.Equal(t, 60, f[0].Score)
+	}
+
+	in.Others[2] = at("10.0.0.3", time.Hour)
+	f, _ = IPBurst{}.Detect(context.TODO(), in)
+	assert.Empty(t, f, "sessions outside the window don't count")
+}
+
+func TestNetwork(t *testing.T) {
+	tor, err := LoadTorExits(strings.NewReader("# exit list\n\n185.220.101.1\nnot-an-ip\n"))
+	assert.NoError(t, err)
+
+	var (
+		n       = Network{TorExits: tor}
+		viaTor  = dto.SessionClaims{DeviceIPAddress: "185.220.101.1"}
+		viaAWS  = dto.SessionClaims{DeviceIPAddress: "3.5.1.1", IPAddressASN: 16509}
+		atHome  = other("s1", time.Now(), london)
+		fromAWS = other("s2", time.Now(), viaAWS)
+	)
+
+	f, _ := n.Detect(context.TODO(), Input{Claims: viaTor, Others: []dto.SessionListResponse{atHome}})
+	if assert.Len(t, f, 1) {
+		assert.Equal(t, "tor", f[0].Detector)
+		assert.Equal(t, 70, f[0].Score)
+	}
+
+	f, _ = n.Detect(context.TODO(), Input{Claims: viaAWS, Others: []dto.SessionListResponse{atHome}})
+	if assert.Len(t, f, 1) {
+		assert.Equal(t, "datacenter", f[0].Detector)
+		assert.Contains(t, f[0].Reason, "Amazon AWS")
+	}
+
+	f, _ = n.Detect(context.TODO(), Input{Claims: viaAWS, Others: []dto.SessionListResponse{fromAWS}})
+	assert.Empty(t, f, "the user already signs in from a datacenter")
+
+	f, _ = n.Detect(context.TODO(), Input{Claims: london})
+	assert.Empty(t, f)
+}
+
+func TestTorExits(t *testing.T) {
+	var none *TorExits
+	assert.False(t, none.Contains("185.220.101.1"))
+
+	tor, _ := LoadTorExits(strings.NewReader("185.220.101.1\n2001:67c:e60:c0c::1\n"))
+	assert.True(t, tor.Contains("185.220.101.1"))
+	assert.True(t, tor.Contains("2001:067c:0e60:c0c:0::1"))
+	assert.False(t, tor.Contains("185.220.101.2"))
+	assert.False(t, tor.Contains(""))
+
+	assert.NoError(t, tor.Reload(strings.NewReader("185.220.101.2\n")))
+	assert.False(t, tor.Contains("185.220.101.1"))
+	assert.True(t, tor.Contains("185.220.101.2"))
+}
+
+type listerFunc func(ctx context.Context, userID, currentSessionID string) ([]dto.SessionListResponse, error)
+
+func (f listerFunc) List(ctx context.Context, userID, currentSessionID string) ([]dto.SessionListResponse, error) {
+	return f(ctx, userID, currentSessionID)
+}
+
+type notifierFunc func(ctx context.Context, n notify.Notification) error
+
+func (f notifierFunc) Notify(ctx context.Context, n notify.Notification) error { return f(ctx, n) }
+
+func TestMonitor_CheckSession(t *testing.T) {
+	fixed := func(score int) Detector {
+		return DetectorFunc(func(ctx context.Context, in Input) ([]Finding, error) {
+			return []Finding{{Detector: "fixed", Score: score, Reason: "testing"}}, nil
+		})
+	}
+
+	type result struct {
+		lists, revokes, notified, events int
+	}
+	newMonitor := func(score int, r *result) *Monitor {
+		h := hook.New()
+		h.On(hook.EventRiskDetected, func(ctx context.Context, e hook.Event) { r.events++ })
+
+		return NewMonitor(
+			listerFunc(func(ctx context.Context, userID, currentSessionID string) ([]dto.SessionListResponse, error) {
+				r.lists++
+				return []dto.SessionListResponse{{SessionID: currentSessionID, CurrentSession: true}}, nil
+			}),
+			WithDetectors(fixed(score)),
+			WithRevoker(func(ctx context.Context, sessionID string) error {
+				r.revokes++
+				return nil
+			}),
+			WithNotifier(notifierFunc(func(ctx context.Context, n notify.Notification) error {
+				assert.Equal(t, NotificationType, n.Type)
+				r.notified++
+				return nil
+			})),
+			WithHooks(h),
+		)
+	}
+	info := session.SessionInfo{UserID: "user-1", SessionID: "s1", StartedAt: time.Now(), Claims: lagos}
+
+	tests := []struct {
+		name    string
+		score   int
+		authAt  time.Time
+		wantErr error
+		want    result
+	}{
+		{"clean", 20, time.Time{}, nil, result{lists: 1, events: 1}},
+		{"alert", 45, time.Time{}, nil, result{lists: 1, events: 1, notified: 1}},
+		{"step-up", 70, time.Time{}, session.ErrStepUpRequired, result{lists: 1, events: 1}},
+		{"factors from sign-in", 70, info.StartedAt, session.ErrStepUpRequired, result{lists: 1, events: 1}},
+		{"step-up answered", 70, time.Now().Add(time.Minute), nil, result{lists: 1, events: 1}},
+		{"revoke", 95, time.Time{}, session.ErrSessionRevoked, result{lists: 1, events: 1, notified: 1, revokes: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r result
+			m := newMonitor(tt.score, &r)
+
+			in := info
+			in.AuthFactors = []string{"password", "totp"}
+			in.LastAuthenticatedAt = tt.authAt
+
+			for i := 0; i < 2; i++ {
+				err := m.CheckSession(context.TODO(), in)
+				if tt.wantErr == nil {
+					assert.NoError(t, err)
+					continue
+				}
+
+				assert.ErrorIs(t, err, tt.wantErr)
+				var de *DecisionError
+				if assert.ErrorAs(t, err, &de) {
+					assert.Equal(t, tt.score, de.Decision.Score)
+				}
+			}
+
+			assert.Equal(t, tt.want, r, "the second check reuses the first decision")
+		})
+	}
+}
+
+func TestMonitor_CheckSession_stepUpLater(t *testing.T) {
+	m := NewMonitor(
+		listerFunc(func(ctx context.Context, userID, currentSessionID string) ([]dto.SessionListResponse, error) {
+			return nil, nil
+		}),
+		WithDetectors(DetectorFunc(func(ctx context.Context, in Input) ([]Finding, error) {
+			return []Finding{{Detector: "fixed", Score: 70}}, nil
+		})),
+		WithCacheTTL(time.Nanosecond),
+	)
+	info := session.SessionInfo{UserID: "user-1", SessionID: "s1", LastAuthenticatedAt: time.Now().Add(-time.Minute)}
+
+	assert.ErrorIs(t, m.CheckSession(context.TODO(), info), session.ErrStepUpRequired)
+	time.Sleep(time.Millisecond)
+	assert.ErrorIs(t, m.CheckSession(context.TODO(), info), session.ErrStepUpRequired, "a fresh assessment keeps the challenge time")
+
+	info.LastAuthenticatedAt = time.Now()
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, m.CheckSession(context.TODO(), info))
+}
+
+func TestMonitor_Evaluate(t *testing.T) {
+	now := time.Now()
+	m := NewMonitor(listerFunc(func(ctx context.Context, userID, currentSessionID string) ([]dto.SessionListResponse, error) {
+		current := other("s2", now, lagos)
+		current.CurrentSession = true
+		return []dto.SessionListResponse{other("s1", now.Add(-time.Hour), london), current}, nil
+	}))
+
+	d, err := m.Evaluate(context.TODO(), session.SessionInfo{UserID: "user-1", SessionID: "s2", StartedAt: now, Claims: lagos})
+	assert.NoError(t, err)
+	assert.Equal(t, 80, d.Score)
+	assert.Equal(t, ActionStepUp, d.Action)
+	if assert.Len(t, d.Findings, 1) {
+		assert.Contains(t, d.Findings[0].Reason, "London, GB to Lagos, NG")
+	}
+}
+
+func TestDecide(t *testing.T) {
+	tests := []struct {
+		score int
+		want  Action
+	}{
+		{0, ActionNone},
+		{49, ActionNone},
+		{50, ActionStepUp},
+		{84, ActionStepUp},
+		{85, ActionBlock},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Decide(tt.score, DefaultSignInRules), "score %d", tt.score)
+	}
+
+	assert.Equal(t, ActionNone, Decide(0, []Rule{{MinScore: 0, Action: ActionAlert}}), "a zero score never acts")
+}
+
+func TestFailedAttempts(t *testing.T) {
+	var (
+		ctx   = context.TODO()
+		now   = time.Now()
+		store = NewMemoryAttemptStore(0)
+		d     = FailedAttempts{Store: store}
+		in    = Input{Email: "Ada@Example.com ", At: now}
+	)
+
+	_ = store.RecordFailure(ctx, AttemptKey("ada@example.com"), now.Add(-2*time.Hour))
+	for i := 0; i < 2; i++ {
+		_ = store.RecordFailure(ctx, AttemptKey("ada@example.com"), now.Add(-time.Minute))
+	}
+
+	f, err := d.Detect(ctx, in)
+	assert.NoError(t, err)
+	assert.Empty(t, f, "two recent failures are normal")
+
+	_ = store.RecordFailure(ctx, AttemptKey("ADA@example.com"), now)
+	f, _ = d.Detect(ctx, in)
+	if assert.Len(t, f, 1) {
+		assert.Equal(t, 40, f[0].Score)
+		assert.Contains(t, f[0].Reason, "3 failed sign-in attempts")
+	}
+
+	_ = store.Reset(ctx, AttemptKey(in.Email))
+	f, _ = d.Detect(ctx, in)
+	assert.Empty(t, f)
+}
+
+type historyFunc func(ctx context.Context, userID string, c dto.SessionClaims) (bool, error)
+
+func (f historyFunc) Known(ctx context.Context, userID string, c dto.SessionClaims) (bool, error) {
+	return f(ctx, userID, c)
+}
+
+func TestNewDevice(t *testing.T) {
+	known := func(k bool) DeviceHistory {
+		return historyFunc(func(ctx context.Context, userID string, c dto.SessionClaims) (bool, error) { return k, nil })
+	}
+	claims := lagos
+	claims.Browser, claims.OS = "Firefox", "Windows"
+
+	f, _ := NewDevice{History: known(true)}.Detect(context.TODO(), Input{Claims: claims})
+	assert.Empty(t, f)
+
+	f, _ = NewDevice{History: known(false)}.Detect(context.TODO(), Input{Claims: claims})
+	if assert.Len(t, f, 1) {
+		assert.Equal(t, 30, f[0].Score)
+		assert.Equal(t, "first sign-in from Firefox on Windows in Lagos, NG", f[0].Reason)
+	}
+}
+
+func TestIPReputation(t *testing.T) {
+	list, err := LoadIPList(strings.NewReader("# local blocklist\n198.51.100.0/24 open proxies\n203.0.113.7\n2001:db8::/32\n"))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		ip     string
+		listed bool
+		label  string
+	}{
+		{"198.51.100.42", true, "open proxies"},
+		{"203.0.113.7", true, ""},
+		{"203.0.113.8", false, ""},
+		{"2001:db8::1", true, ""},
+		{"", false, ""},
+	}
+	for _, tt := range tests {
+		label, ok := list.Lookup(tt.ip)
+		assert.Equal(t, tt.listed, ok, tt.ip)
+		assert.Equal(t, tt.label, label, tt.ip)
+	}
+
+	f, _ := IPReputation{List: list}.Detect(context.TODO(), Input{Claims: dto.SessionClaims{DeviceIPAddress: "198.51.100.42"}})
+	if assert.Len(t, f, 1) {
+		assert.Equal(t, "signed in from a listed IP address (open proxies)", f[0].Reason)
+	}
+
+	_, err = LoadIPList(strings.NewReader("not-an-ip\n"))
+	assert.Error(t, err)
+
+	var none *IPList
+	_, ok := none.Lookup("198.51.100.42")
+	assert.False(t, ok)
+}
+
+func TestTimeOfDay(t *testing.T) {
+	at := func(hour int) Input {
+		return Input{At: time.Date(2024, 5, 1, hour, 30, 0, 0, time.UTC)}
+	}
+
+	tests := []struct {
+		name string
+		d    TimeOfDay
+		hour int
+		want bool
+	}{
+		{"default quiet", TimeOfDay{}, 3, true},
+		{"default awake", TimeOfDay{}, 9, false},
+		{"window end is exclusive", TimeOfDay{}, 5, false},
+		{"wraps midnight", TimeOfDay{From: 22, To: 6}, 23, true},
+		{"wraps midnight morning", TimeOfDay{From: 22, To: 6}, 2, true},
+		{"wraps midnight afternoon", TimeOfDay{From: 22, To: 6}, 14, false},
+		{"in location", TimeOfDay{Location: time.FixedZone("WAT", 3600)}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := tt.d.Detect(context.TODO(), at(tt.hour))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, len(f) == 1)
+		})
+	}
+}
+
+func TestDetectors_Score(t *testing.T) {
+	a, err := Detectors{IPBurst{}, TimeOfDay{}}.Score(context.TODO(), Input{At: time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)})
+	assert.NoError(t, err)
+	assert.Equal(t, 15, a.Score)
+}
+
+func TestMemoryAttemptStore_sweep(t *testing.T) {
+	var (
+		ctx   = context.TODO()
+		now   = time.Now()
+		store = NewMemoryAttemptStore(time.Hour)
+	)
+
+	_ = store.RecordFailure(ctx, "stale", now.Add(-3*time.Hour))
+	_ = store.RecordFailure(ctx, "mixed", now.Add(-2*time.Hour))
+	_ = store.RecordFailure(ctx, "mixed", now.Add(-time.Minute))
+	_ = store.RecordFailure(ctx, "fresh", now)
+
+	assert.NotContains(t, store.failures, "stale")
+	assert.Len(t, store.failures["mixed"], 1)
+	assert.Len(t, store.failures["fresh"], 1)
+}
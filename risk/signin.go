@@ -0,0 +1,282 @@
+package risk
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+)
+
+// ActionBlock refuses a sign-in outright.
+const ActionBlock Action = "block"
+
+// DefaultSignInRules ask for step-up from a score of 50 and block from 85.
+var DefaultSignInRules = []Rule{
+	{MinScore: 85, Action: ActionBlock},
+	{MinScore: 50, Action: ActionStepUp},
+}
+
+// Scorer assesses a session or sign-in attempt. Detectors is the usual
+// implementation; a Scorer can also wrap an external risk service.
+type Scorer interface {
+	Score(ctx context.Context, in Input) (Assessment, error)
+}
+
+// Detectors scores with Assess.
+type Detectors []Detector
+
+func (d Detectors) Score(ctx context.Context, in Input) (Assessment, error) {
+	return Assess(ctx, in, d...)
+}
+
+// Decide returns the Action of the first rule whose MinScore score reaches,
+// or ActionNone.
+func Decide(score int, rules []Rule) Action {
+	if score == 0 {
+		return ActionNone
+	}
+
+	for _, r := range rules {
+		if score >= r.MinScore {
+			return r.Action
+		}
+	}
+	return ActionNone
+}
+
+// Others drops the session being assessed from a SessionService.List result.
+func Others(list []dto.SessionListResponse, sessionID string) []dto.SessionListResponse {
+	others := make([]dto.SessionListResponse, 0, len(list))
+	for _, s := range list {
+		if !s.CurrentSession && (sessionID == "" || s.SessionID != sessionID) {
+			others = append(others, s)
+		}
+	}
+	return others
+}
+
+// FailedAttempts flags sign-ins that follow failed ones for the same email.
+type FailedAttempts struct {
+	Store AttemptStore
+	// Window defaults to one hour
+	Window time.Duration
+	// Threshold is how many failures are normal in Window; 0 means 2
+	Threshold int
+	// Score of a finding; 0 means 40
+	Score int
+}
+
+func (a FailedAttempts) Detect(ctx context.Context, in Input) ([]Finding, error) {
+	if a.Store == nil || in.Email == "" {
+		return nil, nil
+	}
+
+	window := a.Window
+	if window == 0 {
+		window = time.Hour
+	}
+
+	n, err := a.Store.Failures(ctx, AttemptKey(in.Email), in.At.Add(-window))
+	if err != nil {
+		return nil, err
+	}
+	if n <= orInt(a.Threshold, 2) {
+		return nil, nil
+	}
+
+	return []Finding{{
+		Detector: "failed_attempts",
+		Score:    orInt(a.Score, 40),
+		Reason:   fmt.Sprintf("%d failed sign-in attempts within %s", n, window),
+	}}, nil
+}
+
+// DeviceHistory tells whether a user signed in from a device before;
+// *signinalert.Alerter implements it.
+type DeviceHistory interface {
+	Known(ctx context.Context, userID string, c dto.SessionClaims) (bool, error)
+}
+
+// NewDevice flags sign-ins from a device or location the user has not
+// used before.
+type NewDevice struct {
+	History DeviceHistory
+	// Score of a finding; 0 means 30
+	Score int
+}
+
+func (d NewDevice) Detect(ctx context.Context, in Input) ([]Finding, error) {
+	if d.History == nil {
+		return nil, nil
+	}
+
+	known, err := d.History.Known(ctx, in.UserID, in.Claims)
+	if err != nil || known {
+		return nil, err
+	}
+
+	device := in.Claims.DeviceName()
+	if device == "" {
+		device = "a new device"
+	}
+
+	return []Finding{{
+		Detector: "new_device",
+		Score:    orInt(d.Score, 30),
+		Reason:   fmt.Sprintf("first sign-in from %s in %s", device, place(in.Claims.IPAddressCity, in.Claims.IPAddressCountry)),
+	}}, nil
+}
+
+// IPReputation flags sign-ins from addresses on a local list, such as
+// known proxies or abusive networks.
+type IPReputation struct {
+	List *IPList
+	// Score of a finding; 0 means 60
+	Score int
+}
+
+func (r IPReputation) Detect(ctx context.Context, in Input) ([]Finding, error) {
+	label, ok := r.List.Lookup(in.Claims.DeviceIPAddress)
+	if !ok {
+		return nil, nil
+	}
+
+	reason := "signed in from a listed IP address"
+	if label != "" {
+		reason += " (" + label + ")"
+	}
+
+	return []Finding{{Detector: "ip_reputation", Score: orInt(r.Score, 60), Reason: reason}}, nil
+}
+
+// IPList is a set of addresses and CIDR ranges that can be refreshed while
+// in use. A nil *IPList contains nothing.
+type IPList struct {
+	mu   sync.RWMutex
+	nets []listedNet
+}
+
+type listedNet struct {
+	net   *net.IPNet
+	label string
+}
+
+// LoadIPList reads one address or CIDR range per line, optionally followed
+// by a label; blank lines and lines starting with # are skipped.
+func LoadIPList(r io.Reader) (*IPList, error) {
+	l := &IPList{}
+	return l, l.Reload(r)
+}
+
+// Reload replaces the list with the entries read from r.
+func (l *IPList) Reload(r io.Reader) error {
+	var nets []listedNet
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entry, label, _ := strings.Cut(line, " ")
+		n, err := parseNet(entry)
+		if err != nil {
+			return err
+		}
+		nets = append(nets, listedNet{net: n, label: strings.TrimSpace(label)})
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.nets = nets
+	l.mu.Unlock()
+
+	return nil
+}
+
+func parseNet(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		return n, err
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("risk: invalid IP address %q", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// Lookup reports whether ip is listed, and the label of its entry.
+func (l *IPList) Lookup(ip string) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", false
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, n := range l.nets {
+		if n.net.Contains(parsed) {
+			return n.label, true
+		}
+	}
+	return "", false
+}
+
+// TimeOfDay flags sign-ins during quiet hours, From up to To, such as the
+// small hours when few genuine users sign in. The window may wrap midnight.
+type TimeOfDay struct {
+	// From and To are hours, 0 to 23; both 0 means 1 to 5
+	From, To int
+	// Location the hours are in; nil means UTC
+	Location *time.Location
+	// Score of a finding; 0 means 15
+	Score int
+}
+
+func (t TimeOfDay) Detect(ctx context.Context, in Input) ([]Finding, error) {
+	from, to := t.From, t.To
+	if from == 0 && to == 0 {
+		from, to = 1, 5
+	}
+
+	loc := t.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	at := in.At.In(loc)
+	h := at.Hour()
+
+	quiet := from <= h && h < to
+	if from > to {
+		quiet = h >= from || h < to
+	}
+	if !quiet {
+		return nil, nil
+	}
+
+	return []Finding{{
+		Detector: "time_of_day",
+		Score:    orInt(t.Score, 15),
+		Reason:   fmt.Sprintf("signed in at %s, between %02d:00 and %02d:00", at.Format("15:04 MST"), from, to),
+	}}, nil
+}
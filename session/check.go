@@ -0,0 +1,48 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+)
+
+var (
+	ErrStepUpRequired = errors.New("step-up authentication required")
+	ErrSessionRevoked = errors.New("session revoked")
+)
+
+// SessionInfo is what a SessionChecker sees of an authenticated session.
+type SessionInfo struct {
+	UserID      string
+	SessionID   string
+	Role        string
+	StartedAt   time.Time
+	Claims      dto.SessionClaims
+	AuthFactors []string
+	// LastAuthenticatedAt is when any factor of the session was last
+	// authenticated, e.g. by StepUp
+	LastAuthenticatedAt time.Time
+}
+
+// SessionChecker vets a session after Authenticate verified it. Returning
+// an error, such as ErrStepUpRequired, fails the Authenticate call.
+type SessionChecker interface {
+	CheckSession(ctx context.Context, info SessionInfo) error
+}
+
+// WithSessionCheckers runs c, in order, on every session Authenticate
+// verifies, after its own suspension and two factor checks.
+func WithSessionCheckers(c ...SessionChecker) Option {
+	return func(s *SessionService) { s.checkers = append(s.checkers, c...) }
+}
+
+func (s *SessionService) checkSession(ctx context.Context, info SessionInfo) error {
+	for _, c := range s.checkers {
+		if err := c.CheckSession(ctx, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package session
 
 import (
 	"errors"
+	"time"
 
 	"github.com/otyang/go-authsvc/dto"
 
@@ -24,15 +25,83 @@ type SessionLogoutParams struct {
 var (
 	ErrPhoneNumberRequired = errors.New("phone number required")
 	ErrTwoFARequired       = errors.New("two factor auth required")
+	ErrAccountSuspended    = errors.New("account suspended")
+	ErrDeletionScheduled   = errors.New("account scheduled for deletion")
 )
 
-func isTwoFARequiredForThisSession(session dto.Session, stytchAuthFactors []sessions.AuthenticationFactor) bool {
+// SuspendedError is returned for a suspended user. It matches
+// ErrAccountSuspended with errors.Is.
+type SuspendedError struct {
+	UserID string
+	Reason string
+}
+
+func (e *SuspendedError) Error() string {
+	if e.Reason == "" {
+		return ErrAccountSuspended.Error()
+	}
+	return ErrAccountSuspended.Error() + ": " + e.Reason
+}
+
+func (e *SuspendedError) Is(target error) bool {
+	return target == ErrAccountSuspended
+}
+
+// CheckSuspended returns a *SuspendedError if the user is suspended.
+func CheckSuspended[M dto.Metadata](user dto.UserOf[M]) error {
+	if !user.IsSuspended {
+		return nil
+	}
+
+	reason := ""
+	if r := user.TrustedMetadata.System().SuspendedReason; r != nil {
+		reason = *r
+	}
+
+	return &SuspendedError{UserID: user.UserID, Reason: reason}
+}
+
+// DeletionScheduledError is returned for a user whose deletion is
+// scheduled; user.UserService.CancelDeletion lifts it. It matches
+// ErrDeletionScheduled with errors.Is.
+type DeletionScheduledError struct {
+	UserID string
+	DueAt  string
+}
+
+func (e *DeletionScheduledError) Error() string {
+	return ErrDeletionScheduled.Error() + " at " + e.DueAt
+}
+
+func (e *DeletionScheduledError) Is(target error) bool {
+	return target == ErrDeletionScheduled
+}
+
+// CheckDeletionScheduled returns a *DeletionScheduledError if the user's
+// deletion is scheduled, so they cannot sign back in during the grace
+// period and still be purged later.
+func CheckDeletionScheduled[M dto.Metadata](user dto.UserOf[M]) error {
+	due := user.TrustedMetadata.System().DeletionDueAt
+	if due == nil {
+		return nil
+	}
+
+	return &DeletionScheduledError{UserID: user.UserID, DueAt: *due}
+}
+
+func isTwoFARequiredForThisSession[M dto.Metadata](session dto.SessionOf[M], stytchAuthFactors []sessions.AuthenticationFactor) bool {
 	// user have no two_fa activated or user initiated
 	// two_fa usage on his account but havent completed initiation
 	if !session.User.TotpIsEnabled {
 		return false
 	}
 
+	// an impersonation session is minted by magic link for an admin who
+	// already authenticated, so it never holds the user's TOTP factor
+	if session.ImpersonatedBy != "" {
+		return false
+	}
+
 	if len(stytchAuthFactors) == 0 {
 		return true
 	}
@@ -46,6 +115,25 @@ func isTwoFARequiredForThisSession(session dto.Session, stytchAuthFactors []sess
 	return true
 }
 
-func isPhoneNumberRequiredForThisSession(session dto.Session) bool {
+func authFactorTypes(stytchAuthFactors []sessions.AuthenticationFactor) []string {
+	var types []string
+	for _, f := range stytchAuthFactors {
+		types = append(types, string(f.Type))
+	}
+	return types
+}
+
+// lastAuthenticatedAt is the latest time any of the factors was used.
+func lastAuthenticatedAt(stytchAuthFactors []sessions.AuthenticationFactor) time.Time {
+	var last time.Time
+	for _, f := range stytchAuthFactors {
+		if f.LastAuthenticatedAt != nil && f.LastAuthenticatedAt.After(last) {
+			last = *f.LastAuthenticatedAt
+		}
+	}
+	return last
+}
+
+func isPhoneNumberRequiredForThisSession[M dto.Metadata](session dto.SessionOf[M]) bool {
 	return !session.User.PhoneIsVerified
 }
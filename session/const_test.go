@@ -0,0 +1,55 @@
+package session
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/sessions"
+)
+
+func TestCheckSuspended(t *testing.T) {
+	reason := "chargeback fraud"
+
+	assert.NoError(t, CheckSuspended(dto.User{UserID: "u1"}))
+
+	err := CheckSuspended(dto.User{
+		UserID:          "u1",
+		IsSuspended:     true,
+		TrustedMetadata: dto.TrustedMetadata{SystemMetadata: dto.SystemMetadata{Suspended: true, SuspendedReason: &reason}},
+	})
+
+	var se *SuspendedError
+	assert.ErrorIs(t, err, ErrAccountSuspended)
+	assert.True(t, errors.As(err, &se))
+	assert.Equal(t, reason, se.Reason)
+	assert.Equal(t, "account suspended: chargeback fraud", err.Error())
+}
+
+func TestCheckDeletionScheduled(t *testing.T) {
+	due := "2026-11-01T00:00:00Z"
+
+	assert.NoError(t, CheckDeletionScheduled(dto.User{UserID: "u1"}))
+
+	err := CheckDeletionScheduled(dto.User{
+		UserID:          "u1",
+		TrustedMetadata: dto.TrustedMetadata{SystemMetadata: dto.SystemMetadata{DeletionDueAt: &due}},
+	})
+
+	var de *DeletionScheduledError
+	assert.ErrorIs(t, err, ErrDeletionScheduled)
+	if assert.True(t, errors.As(err, &de)) {
+		assert.Equal(t, due, de.DueAt)
+	}
+}
+
+func TestAuthFactorTypes(t *testing.T) {
+	got := authFactorTypes([]sessions.AuthenticationFactor{
+		{Type: sessions.AuthenticationFactorTypePassword},
+		{Type: sessions.AuthenticationFactorTypeTOTP, DeliveryMethod: sessions.AuthenticationFactorDeliveryMethodAuthenticatorApp},
+	})
+
+	assert.Equal(t, []string{"password", "totp"}, got)
+}
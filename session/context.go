@@ -0,0 +1,40 @@
+package session
+
+import (
+	"context"
+
+	"github.com/otyang/go-authsvc/dto"
+)
+
+type (
+	contextKey      struct{}
+	typedContextKey struct{}
+)
+
+// NewContext returns a copy of ctx carrying the authenticated session, for
+// middleware further down the chain to read with FromContext. A session of
+// any schema, e.g. from AuthenticateOf, can be stored; FromContextOf reads
+// it back as it was.
+func NewContext[M dto.Metadata](ctx context.Context, s *dto.SessionOf[M]) context.Context {
+	if s == nil {
+		ctx = context.WithValue(ctx, typedContextKey{}, nil)
+		return context.WithValue(ctx, contextKey{}, (*dto.Session)(nil))
+	}
+
+	ctx = context.WithValue(ctx, typedContextKey{}, s)
+	return context.WithValue(ctx, contextKey{}, s.Untyped())
+}
+
+// FromContext returns the session stored by NewContext, if any, with the
+// default schema, as rbac and policy take it.
+func FromContext(ctx context.Context) (*dto.Session, bool) {
+	s, ok := ctx.Value(contextKey{}).(*dto.Session)
+	return s, ok && s != nil
+}
+
+// FromContextOf returns the session stored by NewContext with its schema M,
+// if it was stored with that schema.
+func FromContextOf[M dto.Metadata](ctx context.Context) (*dto.SessionOf[M], bool) {
+	s, ok := ctx.Value(typedContextKey{}).(*dto.SessionOf[M])
+	return s, ok && s != nil
+}
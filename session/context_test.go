@@ -0,0 +1,49 @@
+package session
+
+import (
+	"context"
+	"testing"
+
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type appMetadata struct {
+	dto.SystemMetadata `mapstructure:",squash"`
+	Plan               string `mapstructure:"plan"`
+}
+
+func TestContext_typed(t *testing.T) {
+	sn := &dto.SessionOf[appMetadata]{
+		ID:             "s1",
+		ImpersonatedBy: "admin-1",
+		User: dto.UserOf[appMetadata]{
+			UserID:          "user-1",
+			TrustedMetadata: appMetadata{SystemMetadata: dto.SystemMetadata{UserRole: "admin"}, Plan: "pro"},
+		},
+	}
+	ctx := NewContext(context.TODO(), sn)
+
+	typed, ok := FromContextOf[appMetadata](ctx)
+	assert.True(t, ok)
+	assert.Same(t, sn, typed)
+
+	untyped, ok := FromContext(ctx)
+	if assert.True(t, ok) {
+		assert.Equal(t, "s1", untyped.ID)
+		assert.Equal(t, "user-1", untyped.User.UserID)
+		assert.Equal(t, "admin", untyped.User.TrustedMetadata.UserRole)
+	}
+	assert.ErrorIs(t, ForbidImpersonation(ctx), ErrImpersonationForbidden)
+
+	_, ok = FromContextOf[dto.TrustedMetadata](ctx)
+	assert.False(t, ok, "a different schema is not found")
+
+	plain := &dto.Session{ID: "s2"}
+	got, _ := FromContext(NewContext(ctx, plain))
+	assert.Same(t, plain, got)
+
+	_, ok = FromContext(NewContext[dto.TrustedMetadata](ctx, nil))
+	assert.False(t, ok)
+}
@@ -0,0 +1,33 @@
+package session
+
+import (
+	"context"
+
+	"github.com/otyang/go-authsvc/dto"
+)
+
+// ClaimsEnricher fills in session claims that can be derived from the
+// device, such as its location. It should leave claims the caller set
+// alone, unless they only repeat what the client said about itself.
+type ClaimsEnricher interface {
+	EnrichClaims(ctx context.Context, c *dto.SessionClaims)
+}
+
+type ClaimsEnricherFunc func(ctx context.Context, c *dto.SessionClaims)
+
+func (f ClaimsEnricherFunc) EnrichClaims(ctx context.Context, c *dto.SessionClaims) {
+	f(ctx, c)
+}
+
+// WithClaimsEnrichers runs e, in order, on the claims of every session this
+// service or a CustomService sharing it creates.
+func WithClaimsEnrichers(e ...ClaimsEnricher) Option {
+	return func(s *SessionService) { s.enrichers = append(s.enrichers, e...) }
+}
+
+// EnrichClaims runs the configured enrichers on c.
+func (s *SessionService) EnrichClaims(ctx context.Context, c *dto.SessionClaims) {
+	for _, e := range s.enrichers {
+		e.EnrichClaims(ctx, c)
+	}
+}
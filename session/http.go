@@ -0,0 +1,42 @@
+package session
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SessionCookieName is read when a request carries no bearer token.
+const SessionCookieName = "session_token"
+
+// Middleware authenticates the request's session token, taken from an
+// "Authorization: Bearer" header or the session cookie, and stores the
+// session in the request context. Requests without a valid session get 401.
+func (s *SessionService) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := tokenFromRequest(r)
+		if token == "" {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		sn, err := s.Authenticate(r.Context(), SessionAuthenticateParams{SessionToken: token})
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), sn)))
+	})
+}
+
+func tokenFromRequest(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+
+	if c, err := r.Cookie(SessionCookieName); err == nil {
+		return c.Value
+	}
+
+	return ""
+}
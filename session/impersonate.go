@@ -0,0 +1,200 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/otyang/go-authsvc/audit"
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/magiclinks"
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/sessions"
+)
+
+const (
+	DefaultImpersonationMinutes int32 = 15
+	MaxImpersonationMinutes     int32 = 60
+)
+
+var (
+	ErrImpersonationReasonRequired = errors.New("impersonation reason required")
+	ErrImpersonationForbidden      = errors.New("not allowed in an impersonation session")
+	ErrImpersonationExpired        = errors.New("impersonation session expired")
+	ErrNotImpersonation            = errors.New("not an impersonation session")
+)
+
+type ImpersonateParams struct {
+	AdminUserID  string
+	TargetUserID string
+	Reason       string
+	// DurationMinutes defaults to DefaultImpersonationMinutes and is capped
+	// at MaxImpersonationMinutes.
+	DurationMinutes int32
+	// SessionClaims describe the admin's device.
+	SessionClaims dto.SessionClaims
+}
+
+type ImpersonateResponse struct {
+	SessionID    string
+	SessionToken string
+	SessionJWT   string
+	ExpiresAt    time.Time
+}
+
+// Impersonate issues a short lived session for the target user, marked with
+// the acting admin so that Authenticate reports it in Session.ImpersonatedBy.
+// Checking the admin may impersonate is left to the caller.
+func (s *SessionService) Impersonate(ctx context.Context, p ImpersonateParams) (*ImpersonateResponse, error) {
+	if p.Reason == "" {
+		return nil, ErrImpersonationReasonRequired
+	}
+
+	if p.DurationMinutes <= 0 {
+		p.DurationMinutes = DefaultImpersonationMinutes
+	}
+	if p.DurationMinutes > MaxImpersonationMinutes {
+		p.DurationMinutes = MaxImpersonationMinutes
+	}
+
+	expiresAt := time.Now().UTC().Add(time.Duration(p.DurationMinutes) * time.Minute)
+
+	claims := p.SessionClaims
+	s.EnrichClaims(ctx, &claims)
+	claims.ImpersonatedBy = p.AdminUserID
+	claims.ImpersonationReason = p.Reason
+	claims.ImpersonationExpiresAt = expiresAt.Format(time.RFC3339)
+
+	sclaims, err := dto.DecodeFromXToX[map[string]any](claims, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// a single use magic link token is the only way to mint a session for a
+	// user without their credentials
+	link, err := s.client.MagicLinks.Create(ctx, &magiclinks.CreateParams{
+		UserID:            p.TargetUserID,
+		ExpirationMinutes: 1,
+	})
+	if err != nil {
+		return nil, dto.HandleError(err)
+	}
+
+	resp, err := s.client.MagicLinks.Authenticate(ctx, &magiclinks.AuthenticateParams{
+		Token:                  link.Token,
+		SessionDurationMinutes: p.DurationMinutes,
+		SessionCustomClaims:    *sclaims,
+	})
+	if err != nil {
+		return nil, dto.HandleError(err)
+	}
+
+	if err := audit.Log(ctx, s.auditLog, audit.Event{
+		Action:    audit.ActionImpersonationStart,
+		ActorID:   p.AdminUserID,
+		UserID:    p.TargetUserID,
+		SessionID: resp.Session.SessionID,
+		Reason:    p.Reason,
+		Data:      map[string]any{"expires_at": claims.ImpersonationExpiresAt},
+	}); err != nil {
+		// an impersonation that is not on record must not stay usable
+		_ = s.Logout(ctx, SessionLogoutParams{SessionID: resp.Session.SessionID})
+		return nil, err
+	}
+
+	return &ImpersonateResponse{
+		SessionID:    resp.Session.SessionID,
+		SessionToken: resp.SessionToken,
+		SessionJWT:   resp.SessionJWT,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// EndImpersonation revokes an impersonation session and records its end.
+func (s *SessionService) EndImpersonation(ctx context.Context, sessionToken string) error {
+	resp, err := s.client.Sessions.Authenticate(ctx, &sessions.AuthenticateParams{
+		SessionToken: sessionToken,
+	})
+	if err != nil {
+		return dto.HandleError(err)
+	}
+
+	claims, err := dto.DecodeFromXToX[dto.SessionClaims](resp.Session.CustomClaims, false)
+	if err != nil {
+		return err
+	}
+
+	if claims.ImpersonatedBy == "" {
+		return ErrNotImpersonation
+	}
+
+	if err := s.Logout(ctx, SessionLogoutParams{SessionID: resp.Session.SessionID}); err != nil {
+		return err
+	}
+
+	return audit.Log(ctx, s.auditLog, impersonationEnd(resp.Session.UserID, resp.Session.SessionID, claims.ImpersonatedBy, claims.ImpersonationReason, EndedByAdmin))
+}
+
+// Why an impersonation session ended, recorded as "ended_by" on
+// audit.ActionImpersonationEnd.
+const (
+	EndedByAdmin  = "admin"
+	EndedByExpiry = "expiry"
+	EndedByRevoke = "revoke"
+)
+
+func impersonationEnd(userID, sessionID, adminID, reason, endedBy string) audit.Event {
+	return audit.Event{
+		Action:    audit.ActionImpersonationEnd,
+		ActorID:   adminID,
+		UserID:    userID,
+		SessionID: sessionID,
+		Reason:    reason,
+		Data:      map[string]any{"ended_by": endedBy},
+	}
+}
+
+// ForbidImpersonation returns ErrImpersonationForbidden when the session in
+// ctx (see NewContext) is an impersonation session. Sensitive operations
+// call it before doing anything.
+func ForbidImpersonation(ctx context.Context) error {
+	if sn, ok := FromContext(ctx); ok && sn.ImpersonatedBy != "" {
+		return ErrImpersonationForbidden
+	}
+	return nil
+}
+
+// ForbidImpersonatedToken is ForbidImpersonation for flows that are handed a
+// session token instead of a context session.
+func (s *SessionService) ForbidImpersonatedToken(ctx context.Context, sessionToken string) error {
+	if err := ForbidImpersonation(ctx); err != nil || sessionToken == "" {
+		return err
+	}
+
+	resp, err := s.client.Sessions.Authenticate(ctx, &sessions.AuthenticateParams{
+		SessionToken: sessionToken,
+	})
+	if err != nil {
+		return dto.HandleError(err)
+	}
+
+	claims, err := dto.DecodeFromXToX[dto.SessionClaims](resp.Session.CustomClaims, false)
+	if err != nil {
+		return err
+	}
+
+	if claims.ImpersonatedBy != "" {
+		return ErrImpersonationForbidden
+	}
+
+	return nil
+}
+
+func impersonationExpired(claims *dto.SessionClaims, now time.Time) bool {
+	if claims.ImpersonatedBy == "" {
+		return false
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, claims.ImpersonationExpiresAt)
+	return err != nil || now.After(expiresAt)
+}
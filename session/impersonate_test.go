@@ -0,0 +1,67 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/otyang/go-authsvc/audit"
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/sessions"
+)
+
+func TestForbidImpersonation(t *testing.T) {
+	var (
+		plain       = NewContext(context.TODO(), &dto.Session{ID: "s1"})
+		impersonate = NewContext(context.TODO(), &dto.Session{ID: "s2", ImpersonatedBy: "admin-1"})
+	)
+
+	assert.NoError(t, ForbidImpersonation(context.TODO()))
+	assert.NoError(t, ForbidImpersonation(plain))
+	assert.ErrorIs(t, ForbidImpersonation(impersonate), ErrImpersonationForbidden)
+}
+
+func TestImpersonationExpired(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name   string
+		claims dto.SessionClaims
+		want   bool
+	}{
+		{name: "not impersonated", claims: dto.SessionClaims{}, want: false},
+		{name: "live", claims: dto.SessionClaims{ImpersonatedBy: "a", ImpersonationExpiresAt: "2024-03-01T12:10:00Z"}, want: false},
+		{name: "expired", claims: dto.SessionClaims{ImpersonatedBy: "a", ImpersonationExpiresAt: "2024-03-01T11:59:00Z"}, want: true},
+		{name: "missing expiry", claims: dto.SessionClaims{ImpersonatedBy: "a"}, want: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, impersonationExpired(&tc.claims, now))
+		})
+	}
+}
+
+func TestImpersonationEnd(t *testing.T) {
+	e := impersonationEnd("user-1", "s1", "admin-1", "ticket 42", EndedByExpiry)
+
+	assert.Equal(t, audit.ActionImpersonationEnd, e.Action)
+	assert.Equal(t, "admin-1", e.ActorID)
+	assert.Equal(t, "user-1", e.UserID)
+	assert.Equal(t, "s1", e.SessionID)
+	assert.Equal(t, "ticket 42", e.Reason)
+	assert.Equal(t, EndedByExpiry, e.Data["ended_by"])
+}
+
+func TestImpersonation_skipsTwoFA(t *testing.T) {
+	var (
+		totpUser = dto.User{TotpIsEnabled: true}
+		emailed  = []sessions.AuthenticationFactor{{DeliveryMethod: sessions.AuthenticationFactorDeliveryMethodEmail}}
+	)
+
+	assert.True(t, isTwoFARequiredForThisSession(dto.Session{User: totpUser}, emailed))
+	assert.False(t, isTwoFARequiredForThisSession(dto.Session{User: totpUser, ImpersonatedBy: "admin-1"}, emailed),
+		"the admin authenticated, not the TOTP-enabled user")
+}
@@ -0,0 +1,225 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/sessions"
+)
+
+var (
+	ErrPushTokenRequired   = errors.New("push token required")
+	ErrInvalidPushPlatform = errors.New("push platform must be fcm or apns")
+	ErrPushTokensDisabled  = errors.New("push token store not configured")
+)
+
+// PushTokenStore keeps device push tokens by the session that registered
+// them. A token belongs to one session of each user at a time, so no user
+// can take over or remove another's registration.
+type PushTokenStore interface {
+	// Save stores t, replacing the same user's earlier registration of the
+	// same token.
+	Save(ctx context.Context, t dto.PushToken) error
+	// Delete removes userID's registration of token.
+	Delete(ctx context.Context, userID, token string) error
+	DeleteSession(ctx context.Context, sessionID string) error
+	ListUser(ctx context.Context, userID string) ([]dto.PushToken, error)
+}
+
+// WithPushTokens keeps device push tokens in store and drops a session's
+// tokens when it is logged out or revoked.
+func WithPushTokens(store PushTokenStore) Option {
+	return func(s *SessionService) { s.pushTokens = store }
+}
+
+type RegisterPushTokenParams struct {
+	// SessionToken is the session the device is signed in with; the token
+	// is registered to its user and session.
+	SessionToken string
+	Platform     dto.PushPlatform
+	Token        string
+}
+
+// RegisterPushToken ties a device token to the session it was sent from.
+func (s *SessionService) RegisterPushToken(ctx context.Context, p RegisterPushTokenParams) error {
+	if err := s.validatePushToken(p); err != nil {
+		return err
+	}
+
+	userID, sessionID, err := s.pushOwner(ctx, p.SessionToken)
+	if err != nil {
+		return err
+	}
+
+	return s.savePushToken(ctx, userID, sessionID, p)
+}
+
+func (s *SessionService) validatePushToken(p RegisterPushTokenParams) error {
+	if s.pushTokens == nil {
+		return ErrPushTokensDisabled
+	}
+	if p.Token == "" {
+		return ErrPushTokenRequired
+	}
+	if !p.Platform.Valid() {
+		return ErrInvalidPushPlatform
+	}
+	return nil
+}
+
+func (s *SessionService) savePushToken(ctx context.Context, userID, sessionID string, p RegisterPushTokenParams) error {
+	return s.pushTokens.Save(ctx, dto.PushToken{
+		Token:        p.Token,
+		Platform:     p.Platform,
+		UserID:       userID,
+		SessionID:    sessionID,
+		RegisteredAt: time.Now().UTC(),
+	})
+}
+
+// UnregisterPushToken removes a device token registered by the user of
+// sessionToken; other users' registrations of it are kept.
+func (s *SessionService) UnregisterPushToken(ctx context.Context, sessionToken, token string) error {
+	if s.pushTokens == nil {
+		return ErrPushTokensDisabled
+	}
+
+	userID, _, err := s.pushOwner(ctx, sessionToken)
+	if err != nil {
+		return err
+	}
+
+	return s.pushTokens.Delete(ctx, userID, token)
+}
+
+// pushOwner authenticates sessionToken and names its user and session.
+func (s *SessionService) pushOwner(ctx context.Context, sessionToken string) (userID, sessionID string, err error) {
+	sn, err := s.Authenticate(ctx, SessionAuthenticateParams{SessionToken: sessionToken})
+	if err != nil {
+		return "", "", err
+	}
+	return sn.UserID, sn.ID, nil
+}
+
+// PushTokens lists the push targets of a user. Tokens of sessions that
+// ended without a logout, by expiring, are dropped along the way.
+func (s *SessionService) PushTokens(ctx context.Context, userID string) ([]dto.PushToken, error) {
+	if s.pushTokens == nil {
+		return nil, ErrPushTokensDisabled
+	}
+
+	tokens, err := s.pushTokens.ListUser(ctx, userID)
+	if err != nil || len(tokens) == 0 {
+		return nil, err
+	}
+
+	active, err := s.List(ctx, userID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	live := make(map[string]bool, len(active))
+	for _, sn := range active {
+		live[sn.SessionID] = true
+	}
+
+	var out []dto.PushToken
+	for _, t := range tokens {
+		if !live[t.SessionID] {
+			_ = s.pushTokens.DeleteSession(ctx, t.SessionID)
+			continue
+		}
+		out = append(out, t)
+	}
+
+	return out, nil
+}
+
+// pushSessionID names the session Logout is about to end, so its push
+// tokens can be dropped afterwards. A session given by token or JWT is
+// looked up; if it no longer authenticates there is nothing to find and
+// PushTokens cleans up later.
+func (s *SessionService) pushSessionID(ctx context.Context, p SessionLogoutParams) string {
+	if s.pushTokens == nil || p.SessionID != "" {
+		return p.SessionID
+	}
+
+	resp, err := s.client.Sessions.Authenticate(ctx, &sessions.AuthenticateParams{
+		SessionToken: p.OrSessionToken,
+		SessionJWT:   p.OrSessionJWT,
+	})
+	if err != nil {
+		return ""
+	}
+
+	return resp.Session.SessionID
+}
+
+func (s *SessionService) dropPushTokens(ctx context.Context, sessionID string) {
+	if s.pushTokens == nil || sessionID == "" {
+		return
+	}
+
+	_ = s.pushTokens.DeleteSession(ctx, sessionID)
+}
+
+// MemoryPushTokenStore is a PushTokenStore for tests and single instance
+// deployments.
+type MemoryPushTokenStore struct {
+	mu     sync.RWMutex
+	tokens map[pushKey]dto.PushToken
+}
+
+type pushKey struct{ userID, token string }
+
+func NewMemoryPushTokenStore() *MemoryPushTokenStore {
+	return &MemoryPushTokenStore{tokens: map[pushKey]dto.PushToken{}}
+}
+
+func (m *MemoryPushTokenStore) Save(ctx context.Context, t dto.PushToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tokens[pushKey{t.UserID, t.Token}] = t
+	return nil
+}
+
+func (m *MemoryPushTokenStore) Delete(ctx context.Context, userID, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.tokens, pushKey{userID, token})
+	return nil
+}
+
+func (m *MemoryPushTokenStore) DeleteSession(ctx context.Context, sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for token, t := range m.tokens {
+		if t.SessionID == sessionID {
+			delete(m.tokens, token)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryPushTokenStore) ListUser(ctx context.Context, userID string) ([]dto.PushToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var out []dto.PushToken
+	for _, t := range m.tokens {
+		if t.UserID == userID {
+			out = append(out, t)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].RegisteredAt.Before(out[j].RegisteredAt) })
+	return out, nil
+}
@@ -0,0 +1,78 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterPushToken(t *testing.T) {
+	ctx := context.TODO()
+
+	assert.ErrorIs(t, NewSessionService(nil).RegisterPushToken(ctx, RegisterPushTokenParams{}), ErrPushTokensDisabled)
+
+	store := NewMemoryPushTokenStore()
+	svc := NewSessionService(nil, WithPushTokens(store))
+
+	testCases := []struct {
+		name string
+		p    RegisterPushTokenParams
+		err  error
+	}{
+		{"missing token", RegisterPushTokenParams{Platform: dto.PushPlatformFCM}, ErrPushTokenRequired},
+		{"unknown platform", RegisterPushTokenParams{Token: "t", Platform: "wns"}, ErrInvalidPushPlatform},
+		{"fcm", RegisterPushTokenParams{Token: "t1", Platform: dto.PushPlatformFCM}, nil},
+		{"apns", RegisterPushTokenParams{Token: "t2", Platform: dto.PushPlatformAPNs}, nil},
+	}
+
+	for i, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := svc.validatePushToken(tc.p)
+			assert.ErrorIs(t, err, tc.err)
+			if err == nil {
+				assert.NoError(t, svc.savePushToken(ctx, "u1", fmt.Sprintf("s%d", i), tc.p))
+			}
+		})
+	}
+
+	tokens, _ := store.ListUser(ctx, "u1")
+	assert.Len(t, tokens, 2)
+}
+
+func TestMemoryPushTokenStore(t *testing.T) {
+	ctx := context.TODO()
+	store := NewMemoryPushTokenStore()
+
+	_ = store.Save(ctx, dto.PushToken{Token: "t1", UserID: "u1", SessionID: "s1"})
+	_ = store.Save(ctx, dto.PushToken{Token: "t2", UserID: "u1", SessionID: "s1"})
+	_ = store.Save(ctx, dto.PushToken{Token: "t3", UserID: "u2", SessionID: "s3"})
+
+	// the device signed in again, so the token moves to the new session
+	_ = store.Save(ctx, dto.PushToken{Token: "t2", UserID: "u1", SessionID: "s2"})
+
+	assert.NoError(t, store.DeleteSession(ctx, "s1"))
+	tokens, _ := store.ListUser(ctx, "u1")
+	if assert.Len(t, tokens, 1) {
+		assert.Equal(t, "t2", tokens[0].Token)
+	}
+
+	// Logout drops the session's tokens once the session is known
+	svc := NewSessionService(nil, WithPushTokens(store))
+	svc.dropPushTokens(ctx, "s2")
+	tokens, _ = store.ListUser(ctx, "u1")
+	assert.Empty(t, tokens)
+
+	// the same device token registered by another user is theirs alone
+	_ = store.Save(ctx, dto.PushToken{Token: "t3", UserID: "u1", SessionID: "s4"})
+	assert.NoError(t, store.Delete(ctx, "u1", "t3"))
+	tokens, _ = store.ListUser(ctx, "u2")
+	assert.Len(t, tokens, 1, "deleting is scoped to the owner")
+
+	assert.NoError(t, store.Delete(ctx, "u2", "t3"))
+	tokens, _ = store.ListUser(ctx, "u2")
+	assert.Empty(t, tokens)
+}
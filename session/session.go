@@ -2,27 +2,58 @@ package session
 
 import (
 	"context"
+	"time"
 
+	"github.com/otyang/go-authsvc/audit"
 	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/migrate"
 
 	"github.com/stytchauth/stytch-go/v11/stytch/consumer/sessions"
 	"github.com/stytchauth/stytch-go/v11/stytch/consumer/stytchapi"
 	"github.com/stytchauth/stytch-go/v11/stytch/stytcherror"
+	"golang.org/x/sync/errgroup"
 )
 
 // SessionService encapsulates interactions with Stytch sessions API
 type SessionService struct {
-	client *stytchapi.API
+	client     *stytchapi.API
+	auditLog   audit.Logger
+	migrations *migrate.Registry
+	pushTokens PushTokenStore
+	enrichers  []ClaimsEnricher
+	checkers   []SessionChecker
 }
 
-func NewSessionService(client *stytchapi.API) *SessionService {
-	return &SessionService{
+type Option func(*SessionService)
+
+// WithAuditLogger sets where impersonation starts and ends are recorded.
+func WithAuditLogger(l audit.Logger) Option {
+	return func(s *SessionService) { s.auditLog = l }
+}
+
+// WithMigrations upgrades the user's trusted metadata in memory before
+// Authenticate decodes it. Nothing is written back.
+func WithMigrations(r *migrate.Registry) Option {
+	return func(s *SessionService) { s.migrations = r }
+}
+
+func NewSessionService(client *stytchapi.API, opts ...Option) *SessionService {
+	s := &SessionService{
 		client: client,
 	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 // Logout logs out of a specific session using its ID, or token, or JWT.
+// Push tokens registered by the session are removed with it.
 func (s *SessionService) Logout(ctx context.Context, p SessionLogoutParams) error {
+	sessionID := s.pushSessionID(ctx, p)
+
 	_, err := s.client.Sessions.Revoke(ctx, &sessions.RevokeParams{
 		SessionID:    p.SessionID,
 		SessionToken: p.OrSessionToken,
@@ -31,11 +62,47 @@ func (s *SessionService) Logout(ctx context.Context, p SessionLogoutParams) erro
 
 	if v, ok := err.(stytcherror.Error); ok {
 		if string(v.ErrorType) == "invalid_session_id" {
-			return nil
+			err = nil
+		}
+	}
+	if err != nil {
+		return dto.HandleError(err)
+	}
+
+	s.dropPushTokens(ctx, sessionID)
+	return nil
+}
+
+// RevokeAll logs out every session of a user except exceptSessionID, which
+// may be empty to revoke them all. Impersonation sessions it ends are
+// recorded as audit.ActionImpersonationEnd.
+func (s *SessionService) RevokeAll(ctx context.Context, userID string, exceptSessionID string) error {
+	listOfSessions, err := s.List(ctx, userID, exceptSessionID)
+	if err != nil {
+		return err
+	}
+
+	var g errgroup.Group
+
+	for _, sesn := range listOfSessions {
+		if sesn.CurrentSession {
+			continue
 		}
+
+		sesn := sesn
+		g.Go(func() error {
+			if err := s.Logout(ctx, SessionLogoutParams{SessionID: sesn.SessionID}); err != nil {
+				return err
+			}
+			if sesn.ImpersonatedBy == "" {
+				return nil
+			}
+			return audit.Log(ctx, s.auditLog, impersonationEnd(userID, sesn.SessionID,
+				sesn.ImpersonatedBy, sesn.ImpersonationReason, EndedByRevoke))
+		})
 	}
 
-	return dto.HandleError(err)
+	return g.Wait()
 }
 
 // Lists active sessions for a user.
@@ -66,6 +133,20 @@ func (s *SessionService) List(ctx context.Context, userID string, currentSession
 				DeviceType:       sessionClaims.DeviceType,
 				IPAddressCity:    sessionClaims.IPAddressCity,
 				IPAddressCountry: sessionClaims.IPAddressCountry,
+				ImpersonatedBy:   sessionClaims.ImpersonatedBy,
+
+				ImpersonationReason: sessionClaims.ImpersonationReason,
+
+				IPAddressASN:       sessionClaims.IPAddressASN,
+				IPAddressASOrg:     sessionClaims.IPAddressASOrg,
+				IPAddressLatitude:  sessionClaims.IPAddressLatitude,
+				IPAddressLongitude: sessionClaims.IPAddressLongitude,
+
+				Browser:        sessionClaims.Browser,
+				BrowserVersion: sessionClaims.BrowserVersion,
+				OS:             sessionClaims.OS,
+				OSVersion:      sessionClaims.OSVersion,
+				DeviceName:     sessionClaims.DeviceName(),
 			})
 		}
 	}
@@ -74,6 +155,11 @@ func (s *SessionService) List(ctx context.Context, userID string, currentSession
 
 // Authenticates a session and returns user and session details.
 func (s *SessionService) Authenticate(ctx context.Context, p SessionAuthenticateParams) (*dto.Session, error) {
+	return AuthenticateOf[dto.TrustedMetadata](ctx, s, p)
+}
+
+// AuthenticateOf is Authenticate for an application metadata schema M.
+func AuthenticateOf[M dto.Metadata](ctx context.Context, s *SessionService, p SessionAuthenticateParams) (*dto.SessionOf[M], error) {
 	resp, err := s.client.Sessions.Authenticate(ctx, &sessions.AuthenticateParams{
 		SessionToken:           p.SessionToken,
 		SessionJWT:             p.OrSessionJWT,
@@ -83,14 +169,33 @@ func (s *SessionService) Authenticate(ctx context.Context, p SessionAuthenticate
 		return nil, dto.HandleError(err)
 	}
 
-	// Convert Stytch user and session data to internal DTOs
-	user := dto.ConvertStytchUserToUser(resp.User)
+	resp.User.TrustedMetadata, _, err = s.migrations.Migrate(resp.User.TrustedMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert Stytch user and session data to internal DTOs. A malformed
+	// application field is left zero; a malformed system field fails
+	// closed, as the checks below depend on them.
+	user, err := dto.ConvertStytchUserOf[M](resp.User)
+	if err := dto.LenientMetadata(err); err != nil {
+		return nil, err
+	}
 	sessionClaims, err := dto.DecodeFromXToX[dto.SessionClaims](resp.Session.CustomClaims, false)
 	if err != nil {
 		return nil, err
 	}
 
-	sn := dto.Session{
+	// extending the ttl must not stretch an impersonation past its limit
+	if impersonationExpired(sessionClaims, time.Now()) {
+		if err := s.Logout(ctx, SessionLogoutParams{SessionID: resp.Session.SessionID}); err == nil {
+			_ = audit.Log(ctx, s.auditLog, impersonationEnd(user.UserID, resp.Session.SessionID,
+				sessionClaims.ImpersonatedBy, sessionClaims.ImpersonationReason, EndedByExpiry))
+		}
+		return nil, ErrImpersonationExpired
+	}
+
+	sn := dto.SessionOf[M]{
 		UserID:           user.UserID,
 		ID:               resp.Session.SessionID,
 		Jwt:              resp.SessionJWT,
@@ -103,7 +208,30 @@ func (s *SessionService) Authenticate(ctx context.Context, p SessionAuthenticate
 		DeviceType:       sessionClaims.DeviceType,
 		IPAddressCity:    sessionClaims.IPAddressCity,
 		IPAddressCountry: sessionClaims.IPAddressCountry,
+		AuthFactors:      authFactorTypes(resp.Session.AuthenticationFactors),
 		User:             user,
+
+		IPAddressASN:       sessionClaims.IPAddressASN,
+		IPAddressASOrg:     sessionClaims.IPAddressASOrg,
+		IPAddressLatitude:  sessionClaims.IPAddressLatitude,
+		IPAddressLongitude: sessionClaims.IPAddressLongitude,
+
+		Browser:        sessionClaims.Browser,
+		BrowserVersion: sessionClaims.BrowserVersion,
+		OS:             sessionClaims.OS,
+		OSVersion:      sessionClaims.OSVersion,
+		DeviceName:     sessionClaims.DeviceName(),
+
+		ImpersonatedBy:      sessionClaims.ImpersonatedBy,
+		ImpersonationReason: sessionClaims.ImpersonationReason,
+	}
+
+	if err := CheckSuspended(user); err != nil {
+		return nil, err
+	}
+
+	if err := CheckDeletionScheduled(user); err != nil {
+		return nil, err
 	}
 
 	if isTwoFARequiredForThisSession(sn, resp.Session.AuthenticationFactors) {
@@ -114,5 +242,19 @@ func (s *SessionService) Authenticate(ctx context.Context, p SessionAuthenticate
 		return nil, ErrPhoneNumberRequired
 	}
 
+	err = s.checkSession(ctx, SessionInfo{
+		UserID:      sn.UserID,
+		SessionID:   sn.ID,
+		Role:        user.TrustedMetadata.System().UserRole,
+		StartedAt:   sn.StartedAt,
+		Claims:      *sessionClaims,
+		AuthFactors: sn.AuthFactors,
+
+		LastAuthenticatedAt: lastAuthenticatedAt(resp.Session.AuthenticationFactors),
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return &sn, nil
 }
@@ -0,0 +1,134 @@
+package session
+
+import (
+	"context"
+	"errors"
+
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/otp"
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/otp/email"
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/sessions"
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/totps"
+)
+
+// StepUpMethod is how a session proves a second factor.
+type StepUpMethod string
+
+const (
+	// StepUpTOTP asks users with an authenticator app for a code from it
+	StepUpTOTP StepUpMethod = "totp"
+	// StepUpEmailOTP emails everyone else a one-time code
+	StepUpEmailOTP StepUpMethod = "email_otp"
+)
+
+var (
+	ErrInvalidStepUpMethod = errors.New("step-up method must be totp or email_otp")
+	ErrStepUpCodeRequired  = errors.New("step-up code required")
+	ErrNoStepUpMethod      = errors.New("user has no authenticator app or email to step up with")
+)
+
+type StartStepUpParams struct {
+	SessionToken string
+	// ExpirationMinutes of an emailed code; 0 leaves Stytch's default
+	ExpirationMinutes int32
+}
+
+type StartStepUpResponse struct {
+	Method StepUpMethod
+	// EmailID is the emailed code's method id, for StepUpParams
+	EmailID string
+}
+
+// StartStepUp begins answering ErrStepUpRequired for a session, such as a
+// risk.Monitor asks for. Users with an authenticator app are asked for a
+// code from it; everyone else is emailed one. Finish with StepUp.
+func (s *SessionService) StartStepUp(ctx context.Context, p StartStepUpParams) (*StartStepUpResponse, error) {
+	// not Authenticate: its checkers refuse the very session stepping up
+	resp, err := s.client.Sessions.Authenticate(ctx, &sessions.AuthenticateParams{
+		SessionToken: p.SessionToken,
+	})
+	if err != nil {
+		return nil, dto.HandleError(err)
+	}
+
+	user := dto.ConvertStytchUserToUser(resp.User)
+
+	method, err := stepUpMethod(user)
+	if err != nil || method == StepUpTOTP {
+		return &StartStepUpResponse{Method: method}, err
+	}
+
+	r, err := s.client.OTPs.Email.Send(ctx, &email.SendParams{
+		Email:             *user.Email,
+		ExpirationMinutes: p.ExpirationMinutes,
+	})
+	if err != nil {
+		return nil, dto.HandleError(err)
+	}
+
+	return &StartStepUpResponse{Method: StepUpEmailOTP, EmailID: r.EmailID}, nil
+}
+
+func stepUpMethod(user dto.User) (StepUpMethod, error) {
+	switch {
+	case user.TotpIsEnabled:
+		return StepUpTOTP, nil
+	case user.Email != nil && *user.Email != "":
+		return StepUpEmailOTP, nil
+	}
+	return "", ErrNoStepUpMethod
+}
+
+type StepUpParams struct {
+	SessionToken string
+	Method       StepUpMethod
+	// EmailID from StartStepUp, for StepUpEmailOTP
+	EmailID string
+	Code    string
+}
+
+type StepUpResponse struct {
+	SessionToken string
+	SessionJWT   string
+}
+
+// StepUp adds the TOTP or emailed code to the session as a second factor,
+// after which a step-up asked for by a SessionChecker is satisfied.
+func (s *SessionService) StepUp(ctx context.Context, p StepUpParams) (*StepUpResponse, error) {
+	if p.Code == "" {
+		return nil, ErrStepUpCodeRequired
+	}
+
+	switch p.Method {
+	case StepUpTOTP:
+		sn, err := s.client.Sessions.Authenticate(ctx, &sessions.AuthenticateParams{
+			SessionToken: p.SessionToken,
+		})
+		if err != nil {
+			return nil, dto.HandleError(err)
+		}
+
+		resp, err := s.client.TOTPs.Authenticate(ctx, &totps.AuthenticateParams{
+			UserID:       sn.User.UserID,
+			TOTPCode:     p.Code,
+			SessionToken: p.SessionToken,
+		})
+		if err != nil {
+			return nil, dto.HandleError(err)
+		}
+		return &StepUpResponse{SessionToken: resp.SessionToken, SessionJWT: resp.SessionJWT}, nil
+	case StepUpEmailOTP:
+		resp, err := s.client.OTPs.Authenticate(ctx, &otp.AuthenticateParams{
+			MethodID:     p.EmailID,
+			Code:         p.Code,
+			SessionToken: p.SessionToken,
+		})
+		if err != nil {
+			return nil, dto.HandleError(err)
+		}
+		return &StepUpResponse{SessionToken: resp.SessionToken, SessionJWT: resp.SessionJWT}, nil
+	}
+
+	return nil, ErrInvalidStepUpMethod
+}
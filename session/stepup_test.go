@@ -0,0 +1,47 @@
+package session
+
+import (
+	"context"
+	"testing"
+
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStepUpMethod(t *testing.T) {
+	var (
+		addr  = "ada@example.com"
+		blank = ""
+	)
+
+	testCases := []struct {
+		name string
+		user dto.User
+		want StepUpMethod
+		err  error
+	}{
+		{name: "authenticator app first", user: dto.User{TotpIsEnabled: true, Email: &addr}, want: StepUpTOTP},
+		{name: "email otherwise", user: dto.User{Email: &addr}, want: StepUpEmailOTP},
+		{name: "blank email", user: dto.User{Email: &blank}, err: ErrNoStepUpMethod},
+		{name: "neither", user: dto.User{}, err: ErrNoStepUpMethod},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := stepUpMethod(tc.user)
+			assert.ErrorIs(t, err, tc.err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestStepUp_invalid(t *testing.T) {
+	svc := NewSessionService(nil)
+
+	_, err := svc.StepUp(context.TODO(), StepUpParams{SessionToken: "t", Method: StepUpTOTP})
+	assert.ErrorIs(t, err, ErrStepUpCodeRequired)
+
+	_, err = svc.StepUp(context.TODO(), StepUpParams{SessionToken: "t", Method: "sms", Code: "123456"})
+	assert.ErrorIs(t, err, ErrInvalidStepUpMethod)
+}
@@ -0,0 +1,114 @@
+package signinalert
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultLinkTTL = 7 * 24 * time.Hour
+
+// MinSecretLength is the shortest secret NewRevokeLinks accepts.
+const MinSecretLength = 32
+
+var (
+	ErrInvalidRevokeLink = errors.New("invalid revoke link")
+	ErrRevokeLinkExpired = errors.New("revoke link expired")
+	ErrRevokeLinkUsed    = errors.New("revoke link already used")
+	ErrSecretTooShort    = errors.New("revoke link secret too short")
+)
+
+// RevokeLinks signs "this wasn't me" links naming a user and one of their
+// sessions, so the link alone is enough to revoke that session.
+type RevokeLinks struct {
+	secret  []byte
+	baseURL string
+	ttl     time.Duration
+}
+
+// NewRevokeLinks returns links to baseURL, which should be served by
+// Alerter.Handler, signed with secret and valid for ttl (DefaultLinkTTL
+// when zero). secret must be random and at least MinSecretLength bytes,
+// as anyone who can guess it can sign users out everywhere.
+func NewRevokeLinks(secret []byte, baseURL string, ttl time.Duration) (*RevokeLinks, error) {
+	if len(secret) < MinSecretLength {
+		return nil, fmt.Errorf("%w: %d bytes, need %d", ErrSecretTooShort, len(secret), MinSecretLength)
+	}
+	if ttl <= 0 {
+		ttl = DefaultLinkTTL
+	}
+
+	return &RevokeLinks{secret: secret, baseURL: baseURL, ttl: ttl}, nil
+}
+
+// URL returns the revoke link for the session, with the token in its
+// "token" query parameter.
+func (l *RevokeLinks) URL(userID, sessionID string) (string, error) {
+	u, err := url.Parse(l.baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set("token", l.token(userID, sessionID, time.Now().Add(l.ttl)))
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+func (l *RevokeLinks) token(userID, sessionID string, expiresAt time.Time) string {
+	payload := userID + "\n" + sessionID + "\n" + strconv.FormatInt(expiresAt.Unix(), 10)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(l.sign(payload))
+}
+
+// Parse checks a token from URL and returns the user and session it names.
+func (l *RevokeLinks) Parse(token string) (userID, sessionID string, err error) {
+	p, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", "", ErrInvalidRevokeLink
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(p)
+	if err != nil {
+		return "", "", ErrInvalidRevokeLink
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, l.sign(string(payload))) {
+		return "", "", ErrInvalidRevokeLink
+	}
+
+	parts := strings.Split(string(payload), "\n")
+	if len(parts) != 3 {
+		return "", "", ErrInvalidRevokeLink
+	}
+
+	exp, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", "", ErrInvalidRevokeLink
+	}
+	if time.Now().Unix() > exp {
+		return "", "", ErrRevokeLinkExpired
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// linkID identifies a token for Store.Spend without storing the token.
+func linkID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (l *RevokeLinks) sign(payload string) []byte {
+	h := hmac.New(sha256.New, l.secret)
+	h.Write([]byte("signinalert.revoke\n" + payload))
+	return h.Sum(nil)
+}
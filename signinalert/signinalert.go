@@ -0,0 +1,377 @@
+// Package signinalert remembers the devices and locations each user signs
+// in from and warns them about sign-ins from new ones, with a link to
+// revoke the session if it wasn't them.
+package signinalert
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/hook"
+	"github.com/otyang/go-authsvc/notify"
+	"github.com/otyang/go-authsvc/session"
+	"github.com/otyang/go-authsvc/user"
+)
+
+// NotificationType is the Type of new device notifications. It matches
+// mailer.TemplateNewSignIn, so the email channel picks that template.
+const NotificationType = "new_sign_in"
+
+// Field is a session claim compared to tell devices apart.
+type Field string
+
+const (
+	FieldUserAgent  Field = "user_agent"
+	FieldDeviceType Field = "device_type"
+	FieldIPAddress  Field = "ip_address"
+	FieldCountry    Field = "country"
+	FieldCity       Field = "city"
+)
+
+// DefaultFields treats any change of user agent, device type, IP address,
+// country or city as a new device.
+var DefaultFields = []Field{FieldUserAgent, FieldDeviceType, FieldIPAddress, FieldCountry, FieldCity}
+
+var ErrRevokeNotConfigured = errors.New("signinalert: revoke links not configured")
+
+// Notifier delivers alerts; *notify.Router implements it.
+type Notifier interface {
+	Notify(ctx context.Context, n notify.Notification) error
+}
+
+// RevokeFunc ends a session the user disowned.
+type RevokeFunc func(ctx context.Context, userID, sessionID string) error
+
+type Alerter struct {
+	store    Store
+	notifier Notifier
+	links    *RevokeLinks
+	revoke   RevokeFunc
+	fields   []Field
+	onError  func(error)
+	hooks    *hook.Hooks
+
+	// alerts being delivered, see Wait
+	inFlight sync.WaitGroup
+}
+
+type Option func(*Alerter)
+
+// WithNotifier sends alerts, in the security category, through n.
+func WithNotifier(n Notifier) Option {
+	return func(a *Alerter) { a.notifier = n }
+}
+
+// WithRevokeLinks adds a "this wasn't me" link to alerts and lets Handler
+// act on it with revoke, see Revoke.
+func WithRevokeLinks(l *RevokeLinks, revoke RevokeFunc) Option {
+	return func(a *Alerter) { a.links, a.revoke = l, revoke }
+}
+
+// WithFields sets the claims compared to tell devices apart. The default
+// is DefaultFields; dropping FieldIPAddress quietens users on mobile
+// networks.
+func WithFields(f ...Field) Option {
+	return func(a *Alerter) { a.fields = f }
+}
+
+// WithErrorHandler receives the errors of sign-ins observed through Attach
+// and of alert deliveries, which have no caller to return them to.
+func WithErrorHandler(fn func(error)) Option {
+	return func(a *Alerter) { a.onError = fn }
+}
+
+func New(store Store, opts ...Option) *Alerter {
+	a := &Alerter{
+		store:  store,
+		fields: DefaultFields,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+// Attach observes every hook.EventSignedIn on h and emits
+// hook.EventNewDeviceSignIn and hook.EventSessionDisowned on it.
+func (a *Alerter) Attach(h *hook.Hooks) {
+	a.hooks = h
+
+	h.On(hook.EventSignedIn, func(ctx context.Context, e hook.Event) {
+		sessionID, _ := e.Data["session_id"].(string)
+
+		_, err := a.Observe(ctx, e.UserID, sessionID, dto.SessionClaimsFromEventData(e.Data))
+		if err != nil && a.onError != nil {
+			a.onError(err)
+		}
+	})
+}
+
+// Key identifies the device and location of c by the compared fields.
+func (a *Alerter) Key(c dto.SessionClaims) string {
+	values := map[Field]string{
+		FieldUserAgent:  c.DeviceUserAgent,
+		FieldDeviceType: c.DeviceType,
+		FieldIPAddress:  c.DeviceIPAddress,
+		FieldCountry:    c.IPAddressCountry,
+		FieldCity:       c.IPAddressCity,
+	}
+
+	h := sha256.New()
+	for _, f := range a.fields {
+		h.Write([]byte(string(f) + "=" + values[f] + "\n"))
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// Known reports whether the user signed in from c's device and location
+// before. Every device is known to a user with no history, as Observe
+// doesn't alert on the first one either. It implements risk.DeviceHistory.
+func (a *Alerter) Known(ctx context.Context, userID string, c dto.SessionClaims) (bool, error) {
+	known, err := a.store.Get(ctx, userID, a.Key(c))
+	if err != nil || known != nil {
+		return known != nil, err
+	}
+
+	history, err := a.store.List(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return len(history) == 0, nil
+}
+
+// Observe records a sign-in and alerts the user when its device and
+// location were not seen before. A user's first device is recorded without
+// an alert. It reports whether an alert was raised.
+func (a *Alerter) Observe(ctx context.Context, userID, sessionID string, c dto.SessionClaims) (bool, error) {
+	var (
+		key = a.Key(c)
+		now = time.Now().UTC()
+	)
+
+	known, err := a.store.Get(ctx, userID, key)
+	if err != nil {
+		return false, err
+	}
+	if known != nil {
+		known.LastSeen = now
+		known.Latitude, known.Longitude = c.IPAddressLatitude, c.IPAddressLongitude
+		return false, a.store.Save(ctx, *known)
+	}
+
+	history, err := a.store.List(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	d := Device{
+		UserID:     userID,
+		Key:        key,
+		UserAgent:  c.DeviceUserAgent,
+		DeviceType: c.DeviceType,
+		DeviceName: c.DeviceName(),
+		IPAddress:  c.DeviceIPAddress,
+		Country:    c.IPAddressCountry,
+		City:       c.IPAddressCity,
+		Latitude:   c.IPAddressLatitude,
+		Longitude:  c.IPAddressLongitude,
+		FirstSeen:  now,
+		LastSeen:   now,
+	}
+	if err := a.store.Save(ctx, d); err != nil {
+		return false, err
+	}
+
+	if len(history) == 0 {
+		return false, nil
+	}
+
+	return true, a.alert(ctx, sessionID, d)
+}
+
+func (a *Alerter) alert(ctx context.Context, sessionID string, d Device) error {
+	data := map[string]any{
+		"session_id": sessionID,
+		"device":     d.DeviceName,
+		"location":   location(d),
+		"ip":         d.IPAddress,
+	}
+	if data["device"] == "" {
+		data["device"] = d.UserAgent
+	}
+
+	if a.links != nil && sessionID != "" {
+		link, err := a.links.URL(d.UserID, sessionID)
+		if err != nil {
+			return err
+		}
+		data["revoke_url"] = link
+	}
+
+	a.hooks.Emit(ctx, hook.Event{Type: hook.EventNewDeviceSignIn, UserID: d.UserID, Data: data})
+
+	if a.notifier == nil {
+		return nil
+	}
+
+	n := notify.Notification{
+		UserID:   d.UserID,
+		Category: dto.CategorySecurity,
+		Type:     NotificationType,
+		Title:    "New sign-in to your account",
+		Body:     body(d),
+		Data:     data,
+	}
+
+	// delivery may wait on SMTP or push gateways; the sign-in must not
+	a.inFlight.Add(1)
+	go func() {
+		defer a.inFlight.Done()
+
+		if err := a.notifier.Notify(context.WithoutCancel(ctx), n); err != nil && a.onError != nil {
+			a.onError(err)
+		}
+	}()
+
+	return nil
+}
+
+// Wait blocks until the alerts being delivered are sent, e.g. on shutdown.
+func (a *Alerter) Wait() {
+	a.inFlight.Wait()
+}
+
+func location(d Device) string {
+	var parts []string
+	for _, p := range []string{d.City, d.Country} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func body(d Device) string {
+	b := "Your account was just signed in to from a new device"
+	if d.DeviceName != "" {
+		b = "Your account was just signed in to from " + d.DeviceName
+	}
+	if loc := location(d); loc != "" {
+		b += " in " + loc
+	}
+	return b + ". If this wasn't you, sign that session out and change your password."
+}
+
+// Devices lists the devices a user signed in from, most recent first.
+func (a *Alerter) Devices(ctx context.Context, userID string) ([]Device, error) {
+	return a.store.List(ctx, userID)
+}
+
+// Forget removes a device, so the next sign-in from it alerts again.
+func (a *Alerter) Forget(ctx context.Context, userID, key string) error {
+	return a.store.Forget(ctx, userID, key)
+}
+
+// Disown revokes the session a revoke link names. Each link works once.
+func (a *Alerter) Disown(ctx context.Context, token string) error {
+	if a.links == nil || a.revoke == nil {
+		return ErrRevokeNotConfigured
+	}
+
+	userID, sessionID, err := a.links.Parse(token)
+	if err != nil {
+		return err
+	}
+
+	first, err := a.store.Spend(ctx, linkID(token), time.Now().Add(a.links.ttl))
+	if err != nil {
+		return err
+	}
+	if !first {
+		return ErrRevokeLinkUsed
+	}
+
+	if err := a.revoke(ctx, userID, sessionID); err != nil {
+		return err
+	}
+
+	a.hooks.Emit(ctx, hook.Event{
+		Type:   hook.EventSessionDisowned,
+		UserID: userID,
+		Data:   map[string]any{"session_id": sessionID},
+	})
+	return nil
+}
+
+var confirmPage = template.Must(template.New("confirm").Parse(`<!doctype html>
+<title>Sign out this session?</title>
+<p>If you did not sign in from this device, sign that session out. You will then need to set a new password.</p>
+<form method="post">
+<input type="hidden" name="token" value="{{.}}">
+<button type="submit">Sign it out</button>
+</form>
+`))
+
+// Handler serves revoke links. Opening one shows a confirmation page, and
+// only its POST revokes the session, so mail scanners that prefetch links
+// revoke nothing.
+func (a *Alerter) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		switch r.Method {
+		case http.MethodGet:
+			token := r.URL.Query().Get("token")
+			if a.links == nil {
+				err = ErrRevokeNotConfigured
+			} else if _, _, err = a.links.Parse(token); err == nil {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				_ = confirmPage.Execute(w, token)
+				return
+			}
+		case http.MethodPost:
+			if err = a.Disown(r.Context(), r.FormValue("token")); err == nil {
+				_, _ = w.Write([]byte("That session has been signed out. Please set a new password before signing in again.\n"))
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch {
+		case errors.Is(err, ErrInvalidRevokeLink):
+			http.Error(w, "This link is not valid.", http.StatusBadRequest)
+		case errors.Is(err, ErrRevokeLinkExpired):
+			http.Error(w, "This link has expired. Sign in and review your sessions instead.", http.StatusGone)
+		case errors.Is(err, ErrRevokeLinkUsed):
+			http.Error(w, "This link was already used.", http.StatusGone)
+		default:
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	})
+}
+
+// Revoke signs the session out and, since whoever used it knew the
+// password, makes the user reset it before signing in again.
+func Revoke(sessions *session.SessionService, users *user.UserService) RevokeFunc {
+	return func(ctx context.Context, userID, sessionID string) error {
+		if err := sessions.Logout(ctx, session.SessionLogoutParams{SessionID: sessionID}); err != nil {
+			return err
+		}
+
+		return users.SetPasswordResetRequired(ctx, userID, true)
+	}
+}
@@ -0,0 +1,206 @@
+package signinalert
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/hook"
+	"github.com/otyang/go-authsvc/notify"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "a-test-secret-of-at-least-32-bytes"
+
+func testLinks(t *testing.T, secret, baseURL string, ttl time.Duration) *RevokeLinks {
+	links, err := NewRevokeLinks([]byte(secret), baseURL, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return links
+}
+
+type notifierFunc func(ctx context.Context, n notify.Notification) error
+
+func (f notifierFunc) Notify(ctx context.Context, n notify.Notification) error { return f(ctx, n) }
+
+func TestAlerter_Observe(t *testing.T) {
+	var (
+		sent  []notify.Notification
+		links = testLinks(t, testSecret, "https://example.com/revoke", 0)
+		h     = hook.New()
+		a     = New(NewMemoryStore(),
+			WithNotifier(notifierFunc(func(ctx context.Context, n notify.Notification) error {
+				sent = append(sent, n)
+				return nil
+			})),
+			WithRevokeLinks(links, nil),
+		)
+		events []hook.Event
+	)
+	a.Attach(h)
+	h.On(hook.EventNewDeviceSignIn, func(ctx context.Context, e hook.Event) { events = append(events, e) })
+
+	laptop := dto.SessionClaims{
+		DeviceIPAddress:  "81.2.69.142",
+		DeviceUserAgent:  "Mozilla/5.0 (Macintosh)",
+		DeviceType:       dto.DeviceTypeDesktop,
+		IPAddressCountry: "GB",
+		IPAddressCity:    "London",
+		Browser:          "Chrome",
+		OS:               "macOS",
+	}
+	phone := laptop
+	phone.DeviceIPAddress = "102.89.1.1"
+	phone.IPAddressCountry = "NG"
+	phone.IPAddressCity = "Lagos"
+
+	signIn := func(sessionID string, c dto.SessionClaims) {
+		data := c.EventData()
+		data["session_id"] = sessionID
+		h.Emit(context.TODO(), hook.Event{Type: hook.EventSignedIn, UserID: "user-1", Data: data})
+		a.Wait()
+	}
+
+	signIn("s1", laptop)
+	assert.Empty(t, sent, "the first device is not news")
+
+	signIn("s2", laptop)
+	assert.Empty(t, sent)
+
+	signIn("s3", phone)
+	if assert.Len(t, sent, 1) && assert.Len(t, events, 1) {
+		n := sent[0]
+		assert.Equal(t, dto.CategorySecurity, n.Category)
+		assert.Equal(t, NotificationType, n.Type)
+		assert.Equal(t, "Chrome on macOS", n.Data["device"])
+		assert.Equal(t, "Lagos, NG", n.Data["location"])
+
+		u, err := url.Parse(n.Data["revoke_url"].(string))
+		assert.NoError(t, err)
+		userID, sessionID, err := links.Parse(u.Query().Get("token"))
+		assert.NoError(t, err)
+		assert.Equal(t, "user-1", userID)
+		assert.Equal(t, "s3", sessionID)
+	}
+
+	devices, err := a.Devices(context.TODO(), "user-1")
+	assert.NoError(t, err)
+	if assert.Len(t, devices, 2) {
+		assert.Equal(t, "Lagos", devices[0].City, "most recent first")
+	}
+
+	// without the IP, the same phone on another address is not new
+	a = New(NewMemoryStore(), WithFields(FieldUserAgent, FieldDeviceType, FieldCountry, FieldCity))
+	_, _ = a.Observe(context.TODO(), "user-1", "s1", laptop)
+	moved := laptop
+	moved.DeviceIPAddress = "81.2.69.200"
+	alerted, err := a.Observe(context.TODO(), "user-1", "s2", moved)
+	assert.NoError(t, err)
+	assert.False(t, alerted)
+}
+
+func TestAlerter_Known(t *testing.T) {
+	var (
+		ctx    = context.TODO()
+		a      = New(NewMemoryStore())
+		laptop = dto.SessionClaims{DeviceIPAddress: "81.2.69.142", IPAddressCountry: "GB"}
+		phone  = dto.SessionClaims{DeviceIPAddress: "102.89.1.1", IPAddressCountry: "NG"}
+	)
+
+	known, err := a.Known(ctx, "user-1", laptop)
+	assert.NoError(t, err)
+	assert.True(t, known, "nothing is new without history")
+
+	_, _ = a.Observe(ctx, "user-1", "s1", laptop)
+
+	known, _ = a.Known(ctx, "user-1", laptop)
+	assert.True(t, known)
+	known, _ = a.Known(ctx, "user-1", phone)
+	assert.False(t, known)
+}
+
+func TestRevokeLinks(t *testing.T) {
+	links := testLinks(t, testSecret, "https://example.com/revoke?src=email", time.Hour)
+
+	raw, err := links.URL("user-1", "s1")
+	assert.NoError(t, err)
+	u, _ := url.Parse(raw)
+	assert.Equal(t, "email", u.Query().Get("src"))
+
+	token := u.Query().Get("token")
+	userID, sessionID, err := links.Parse(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", userID)
+	assert.Equal(t, "s1", sessionID)
+
+	_, _, err = testLinks(t, "another-secret-of-32-bytes-or-more", "", 0).Parse(token)
+	assert.ErrorIs(t, err, ErrInvalidRevokeLink)
+
+	_, _, err = links.Parse("garbage")
+	assert.ErrorIs(t, err, ErrInvalidRevokeLink)
+
+	expired := links.token("user-1", "s1", time.Now().Add(-time.Minute))
+	_, _, err = links.Parse(expired)
+	assert.ErrorIs(t, err, ErrRevokeLinkExpired)
+}
+
+func TestNewRevokeLinks_shortSecret(t *testing.T) {
+	for _, secret := range []string{"", "secret", testSecret[:MinSecretLength-1]} {
+		_, err := NewRevokeLinks([]byte(secret), "https://example.com/revoke", 0)
+		assert.ErrorIs(t, err, ErrSecretTooShort, "%d bytes", len(secret))
+	}
+
+	_, err := NewRevokeLinks([]byte(testSecret), "https://example.com/revoke", 0)
+	assert.NoError(t, err)
+}
+
+func TestAlerter_Handler(t *testing.T) {
+	var (
+		revoked []string
+		links   = testLinks(t, testSecret, "https://example.com/revoke", 0)
+		a       = New(NewMemoryStore(), WithRevokeLinks(links, func(ctx context.Context, userID, sessionID string) error {
+			revoked = append(revoked, userID+"/"+sessionID)
+			return nil
+		}))
+	)
+
+	serve := func(method, token string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+
+		req := httptest.NewRequest(method, "/revoke?token="+url.QueryEscape(token), nil)
+		if method == http.MethodPost {
+			req = httptest.NewRequest(method, "/revoke", strings.NewReader(url.Values{"token": {token}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+
+		a.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	valid := links.token("user-1", "s1", time.Now().Add(time.Hour))
+
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodGet, "nope").Code)
+	assert.Equal(t, http.StatusGone, serve(http.MethodGet, links.token("user-1", "s1", time.Now().Add(-time.Second))).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "nope").Code)
+
+	page := serve(http.MethodGet, valid)
+	assert.Equal(t, http.StatusOK, page.Code)
+	assert.Contains(t, page.Body.String(), `<form method="post">`)
+	assert.Empty(t, revoked, "opening the link revokes nothing")
+
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodDelete, valid).Code)
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, valid).Code)
+	assert.Equal(t, []string{"user-1/s1"}, revoked)
+
+	assert.Equal(t, http.StatusGone, serve(http.MethodPost, valid).Code, "links are single use")
+	assert.Len(t, revoked, 1)
+
+	assert.ErrorIs(t, New(NewMemoryStore()).Disown(context.TODO(), "x"), ErrRevokeNotConfigured)
+}
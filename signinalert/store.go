@@ -0,0 +1,111 @@
+package signinalert
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Device is one combination of device and location a user signed in from.
+type Device struct {
+	UserID string `json:"user_id"`
+	// Key identifies the combination, see Alerter.Key
+	Key        string    `json:"key"`
+	UserAgent  string    `json:"user_agent"`
+	DeviceType string    `json:"device_type"`
+	DeviceName string    `json:"device_name,omitempty"`
+	IPAddress  string    `json:"ip_address"`
+	Country    string    `json:"country"`
+	City       string    `json:"city"`
+	Latitude   float64   `json:"latitude,omitempty"`
+	Longitude  float64   `json:"longitude,omitempty"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// Store keeps the devices users signed in from.
+type Store interface {
+	// Get returns nil and no error for a device never seen.
+	Get(ctx context.Context, userID, key string) (*Device, error)
+	// Save adds d or replaces the device with the same UserID and Key.
+	Save(ctx context.Context, d Device) error
+	// List returns the user's devices, most recently seen first.
+	List(ctx context.Context, userID string) ([]Device, error)
+	Forget(ctx context.Context, userID, key string) error
+	// Spend marks a revoke link used, reporting false if it already was.
+	// The record may be dropped after until, when the link has expired.
+	Spend(ctx context.Context, linkID string, until time.Time) (bool, error)
+}
+
+// MemoryStore is a Store for tests and single instance deployments.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	devices map[string]map[string]Device // user id, key
+	spent   map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{devices: map[string]map[string]Device{}, spent: map[string]time.Time{}}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, userID, key string) (*Device, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	d, ok := s.devices[userID][key]
+	if !ok {
+		return nil, nil
+	}
+	return &d, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, d Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.devices[d.UserID] == nil {
+		s.devices[d.UserID] = map[string]Device{}
+	}
+	s.devices[d.UserID][d.Key] = d
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, userID string) ([]Device, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]Device, 0, len(s.devices[userID]))
+	for _, d := range s.devices[userID] {
+		out = append(out, d)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+	return out, nil
+}
+
+func (s *MemoryStore) Forget(ctx context.Context, userID, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.devices[userID], key)
+	return nil
+}
+
+func (s *MemoryStore) Spend(ctx context.Context, linkID string, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, u := range s.spent {
+		if now.After(u) {
+			delete(s.spent, id)
+		}
+	}
+
+	if _, ok := s.spent[linkID]; ok {
+		return false, nil
+	}
+	s.spent[linkID] = until
+	return true, nil
+}
@@ -0,0 +1,127 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/users"
+)
+
+// Suspend blocks a user from signing in and revokes their sessions. The
+// reason is kept in trusted metadata and reported by session.SuspendedError.
+func (u *UserService) Suspend(ctx context.Context, userID string, reason string) error {
+	if err := u.patchMetadata(ctx, userID, map[string]any{
+		"suspended":        true,
+		"suspended_reason": reason,
+		"suspended_at":     time.Now().UTC().Format(time.RFC3339),
+	}); err != nil {
+		return err
+	}
+
+	return u.sessionSvc.RevokeAll(ctx, userID, "")
+}
+
+// Reactivate lifts a suspension.
+func (u *UserService) Reactivate(ctx context.Context, userID string) error {
+	return u.patchMetadata(ctx, userID, map[string]any{
+		"suspended":        false,
+		"suspended_reason": nil,
+		"suspended_at":     nil,
+	})
+}
+
+// RevokeAllSessions signs a user out everywhere.
+func (u *UserService) RevokeAllSessions(ctx context.Context, userID string) error {
+	return u.sessionSvc.RevokeAll(ctx, userID, "")
+}
+
+// SetPasswordResetRequired flags, or clears, a forced password reset. While
+// set, SignIn refuses the user until the password has been reset.
+func (u *UserService) SetPasswordResetRequired(ctx context.Context, userID string, required bool) error {
+	return u.patchMetadata(ctx, userID, map[string]any{
+		"password_reset_required": required,
+	})
+}
+
+// ErrSystemMetadataKey refuses a raw write to a key of dto.SystemMetadata.
+var ErrSystemMetadataKey = errors.New("system metadata key cannot be patched")
+
+// PatchTrustedMetadata overwrites the given top level application keys of
+// trusted metadata, leaving the rest as they are. A nil value clears a key.
+// System keys are refused with ErrSystemMetadataKey: roles and PINs change
+// through Update, which vets them, and suspensions through Suspend.
+func (u *UserService) PatchTrustedMetadata(ctx context.Context, userID string, patch map[string]any) error {
+	for k := range patch {
+		if dto.IsSystemKey(k) {
+			return fmt.Errorf("%w: %s", ErrSystemMetadataKey, k)
+		}
+	}
+
+	return u.patchMetadata(ctx, userID, patch)
+}
+
+// patchMetadata is PatchTrustedMetadata for the system keys this package
+// manages itself.
+func (u *UserService) patchMetadata(ctx context.Context, userID string, patch map[string]any) error {
+	_, err := u.updateMetadata(ctx, userID, func(cur users.User, _ bool) (map[string]any, *users.Name, error) {
+		tm := make(map[string]any, len(cur.TrustedMetadata)+len(patch))
+		for k, v := range cur.TrustedMetadata {
+			tm[k] = v
+		}
+		for k, v := range patch {
+			tm[k] = v
+		}
+		return tm, nil, nil
+	})
+
+	return err
+}
+
+// SeedTrustedMetadata sets the keys of defaults the user has no value for,
+// keeping the values they have, and returns the user as stored. It fills
+// in the metadata of users created outside this package, e.g. by signup or
+// a password import.
+func (u *UserService) SeedTrustedMetadata(ctx context.Context, userID string, defaults map[string]any) (*dto.User, error) {
+	stored, err := u.updateMetadata(ctx, userID, func(cur users.User, _ bool) (map[string]any, *users.Name, error) {
+		return seed(cur.TrustedMetadata, defaults), nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user := dto.ConvertStytchUserToUser(stored)
+	return &user, nil
+}
+
+// seed merges defaults under tm, or returns nil when tm has them all.
+func seed(tm, defaults map[string]any) map[string]any {
+	var missing bool
+	for k := range defaults {
+		if isUnset(tm[k]) {
+			missing = true
+			break
+		}
+	}
+	if !missing {
+		return nil
+	}
+
+	out := make(map[string]any, len(tm)+len(defaults))
+	for k, v := range defaults {
+		out[k] = v
+	}
+	for k, v := range tm {
+		if !isUnset(v) {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func isUnset(v any) bool {
+	return v == nil || v == ""
+}
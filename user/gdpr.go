@@ -0,0 +1,179 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/otyang/go-authsvc/audit"
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/hook"
+	"github.com/otyang/go-authsvc/session"
+
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/users"
+)
+
+var ErrNoDeletionScheduled = errors.New("no deletion scheduled")
+
+// Archive is everything held about a user, for a data subject access
+// request. It is meant to be serialised with encoding/json.
+type Archive struct {
+	ExportedAt      time.Time                 `json:"exported_at"`
+	User            dto.User                  `json:"user"`
+	TrustedMetadata map[string]any            `json:"trusted_metadata"`
+	Sessions        []dto.SessionListResponse `json:"sessions"`
+	AuditEvents     []audit.Event             `json:"audit_events"`
+}
+
+// Export gathers the user's profile, raw trusted metadata, sessions and,
+// when the audit logger can be read back, their audit trail.
+func (u *UserService) Export(ctx context.Context, userID string) (*Archive, error) {
+	// one read for both views: the archive carries the raw metadata too,
+	// so malformed fields are kept
+	su, err := u.fetchStytchUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	raw := su.TrustedMetadata
+
+	if su.TrustedMetadata, _, err = u.migrations.Migrate(raw); err != nil {
+		return nil, err
+	}
+	user, err := dto.ConvertStytchUser(su)
+	if err != nil && !errors.Is(err, dto.ErrInvalidMetadata) {
+		return nil, err
+	}
+
+	sessions, err := u.sessionSvc.List(ctx, userID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var events []audit.Event
+	if r, ok := u.auditLog.(audit.Reader); ok {
+		if events, err = r.ForUser(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := audit.Log(ctx, u.auditLog, audit.Event{Action: audit.ActionUserExported, ActorID: actorID(ctx), UserID: userID}); err != nil {
+		return nil, err
+	}
+
+	return &Archive{
+		ExportedAt:      time.Now().UTC(),
+		User:            user,
+		TrustedMetadata: raw,
+		Sessions:        sessions,
+		AuditEvents:     events,
+	}, nil
+}
+
+// Delete erases a user. With a deletion grace period configured the user is
+// signed out and scheduled for deletion instead, which CancelDeletion can
+// undo until PurgeDueDeletions runs past the due time. Until then SignIn and
+// Authenticate refuse the user with session.ErrDeletionScheduled.
+func (u *UserService) Delete(ctx context.Context, userID string) error {
+	if u.deletionGrace <= 0 {
+		return u.deleteNow(ctx, userID)
+	}
+
+	due := time.Now().UTC().Add(u.deletionGrace).Format(time.RFC3339)
+
+	if err := u.patchMetadata(ctx, userID, map[string]any{"deletion_due_at": due}); err != nil {
+		return err
+	}
+
+	if err := u.sessionSvc.RevokeAll(ctx, userID, ""); err != nil {
+		return err
+	}
+
+	u.hooks.Emit(ctx, hook.Event{Type: hook.EventUserDeletionScheduled, UserID: userID, Data: map[string]any{"due_at": due}})
+
+	return audit.Log(ctx, u.auditLog, audit.Event{
+		Action:  audit.ActionUserDeletionScheduled,
+		ActorID: actorID(ctx),
+		UserID:  userID,
+		Data:    map[string]any{"due_at": due},
+	})
+}
+
+// CancelDeletion withdraws a scheduled deletion.
+func (u *UserService) CancelDeletion(ctx context.Context, userID string) error {
+	user, err := u.Get(ctx, userID)
+	if err := dto.LenientMetadata(err); err != nil {
+		return err
+	}
+
+	if user.TrustedMetadata.DeletionDueAt == nil {
+		return ErrNoDeletionScheduled
+	}
+
+	if err := u.patchMetadata(ctx, userID, map[string]any{"deletion_due_at": nil}); err != nil {
+		return err
+	}
+
+	u.hooks.Emit(ctx, hook.Event{Type: hook.EventUserDeletionCancelled, UserID: userID})
+
+	return audit.Log(ctx, u.auditLog, audit.Event{Action: audit.ActionUserDeletionCancelled, ActorID: actorID(ctx), UserID: userID})
+}
+
+// PurgeDueDeletions erases every user whose scheduled deletion is due by
+// now. It is meant to run periodically and returns the erased user ids.
+func (u *UserService) PurgeDueDeletions(ctx context.Context, now time.Time) ([]string, error) {
+	var (
+		due []string
+		it  = u.Iterate(SearchParams{})
+	)
+
+	for it.Next(ctx) {
+		if deletionDue(it.User(), now) {
+			due = append(due, it.User().UserID)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	var purged []string
+	for _, userID := range due {
+		if err := u.deleteNow(ctx, userID); err != nil {
+			return purged, err
+		}
+		purged = append(purged, userID)
+	}
+
+	return purged, nil
+}
+
+func (u *UserService) deleteNow(ctx context.Context, userID string) error {
+	if err := u.sessionSvc.RevokeAll(ctx, userID, ""); err != nil {
+		return err
+	}
+
+	if _, err := u.client.Users.Delete(ctx, &users.DeleteParams{UserID: userID}); err != nil {
+		return dto.HandleError(err)
+	}
+
+	// apps purge their own data from this hook
+	u.hooks.Emit(ctx, hook.Event{Type: hook.EventUserDeleted, UserID: userID})
+
+	return audit.Log(ctx, u.auditLog, audit.Event{Action: audit.ActionUserDeleted, ActorID: actorID(ctx), UserID: userID})
+}
+
+func deletionDue(user dto.User, now time.Time) bool {
+	if user.TrustedMetadata.DeletionDueAt == nil {
+		return false
+	}
+
+	dueAt, err := time.Parse(time.RFC3339, *user.TrustedMetadata.DeletionDueAt)
+	return err == nil && !dueAt.After(now)
+}
+
+// actorID is the user behind the session in ctx, if any.
+func actorID(ctx context.Context) string {
+	if sn, ok := session.FromContext(ctx); ok {
+		return sn.UserID
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+package user
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeletionDue(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name  string
+		dueAt *string
+		want  bool
+	}{
+		{name: "not scheduled", dueAt: nil, want: false},
+		{name: "due", dueAt: toPointer("2024-03-01T12:00:00Z"), want: true},
+		{name: "not yet due", dueAt: toPointer("2024-03-08T12:00:00Z"), want: false},
+		{name: "malformed", dueAt: toPointer("next week"), want: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			user := dto.User{TrustedMetadata: dto.TrustedMetadata{SystemMetadata: dto.SystemMetadata{DeletionDueAt: tc.dueAt}}}
+			assert.Equal(t, tc.want, deletionDue(user, now))
+		})
+	}
+}
+
+func TestUserService_Export(t *testing.T) {
+	var userReads int
+
+	client := fakeStytch(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/users/user-1":
+			userReads++
+			_, _ = w.Write([]byte(`{"status_code":200,"user_id":"user-1","trusted_metadata":{"system_user_id":"SYS1","notification_sms":"often"}}`))
+		case "/v1/sessions":
+			_, _ = w.Write([]byte(`{"status_code":200,"sessions":[]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	archive, err := NewUserService(client).Export(context.TODO(), "user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, userReads, "the user is read once")
+
+	assert.Equal(t, "SYS1", archive.User.SytstemUserID)
+	assert.Equal(t, "often", archive.TrustedMetadata["notification_sms"], "raw metadata keeps malformed fields")
+}
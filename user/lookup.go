@@ -0,0 +1,87 @@
+package user
+
+import (
+	"context"
+	"errors"
+
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/users"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+// stytch caps a single search page at 1000 results
+const searchPageLimit uint32 = 1000
+
+// each walks every user matching query page by page, stopping early once
+// fn returns false. A nil query matches all users.
+func (u *UserService) each(ctx context.Context, query *users.SearchUsersQuery, fn func(users.User) bool) error {
+	var cursor string
+
+	for {
+		resp, err := u.client.Users.Search(ctx, &users.SearchParams{
+			Cursor: cursor,
+			Limit:  searchPageLimit,
+			Query:  query,
+		})
+		if err != nil {
+			return dto.HandleError(err)
+		}
+
+		for _, su := range resp.Results {
+			if !fn(su) {
+				return nil
+			}
+		}
+
+		cursor = resp.ResultsMetadata.NextCursor
+		if cursor == "" {
+			return nil
+		}
+	}
+}
+
+// FindByTrustedMetadata returns users whose trusted metadata has key set to
+// value, stopping after limit matches when limit is positive.
+func (u *UserService) FindByTrustedMetadata(ctx context.Context, key string, value any, limit int) ([]dto.User, error) {
+	var (
+		found []dto.User
+		it    = u.Iterate(SearchParams{TrustedMetadata: map[string]any{key: value}})
+	)
+
+	for (limit <= 0 || len(found) < limit) && it.Next(ctx) {
+		found = append(found, it.User())
+	}
+
+	return found, it.Err()
+}
+
+func (u *UserService) FindBySystemUserID(ctx context.Context, systemUserID string) (*dto.User, error) {
+	found, err := u.FindByTrustedMetadata(ctx, "system_user_id", systemUserID, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(found) == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	return &found[0], nil
+}
+
+// ListReferrals returns the users who signed up with userID's referral code.
+func (u *UserService) ListReferrals(ctx context.Context, userID string) ([]dto.User, error) {
+	return u.FindByTrustedMetadata(ctx, "referred_by", userID, 0)
+}
+
+// SystemUserIDExists reports whether a user holds systemUserID. Stytch
+// cannot search trusted metadata, so this may page through every user.
+func (u *UserService) SystemUserIDExists(ctx context.Context, systemUserID string) (bool, error) {
+	_, err := u.FindBySystemUserID(ctx, systemUserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
@@ -0,0 +1,52 @@
+package user
+
+import (
+	"context"
+
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/users"
+)
+
+// MigrateTrustedMetadata upgrades, and stores, the trusted metadata of every
+// user older than the latest schema version (see WithMigrations). It returns
+// the ids of the users that were, or with dryRun would be, migrated.
+//
+// Writes go through the same revision check as other updates, so a user
+// updated while the batch runs is migrated on top of that update, and one
+// already migrated by it is skipped.
+func (u *UserService) MigrateTrustedMetadata(ctx context.Context, dryRun bool) ([]string, error) {
+	var pending []string
+
+	if err := u.each(ctx, nil, func(su users.User) bool {
+		if u.migrations.NeedsMigration(su.TrustedMetadata) {
+			pending = append(pending, su.UserID)
+		}
+		return true
+	}); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return pending, nil
+	}
+
+	var migrated []string
+
+	for _, userID := range pending {
+		var changed bool
+
+		if _, err := u.updateMetadata(ctx, userID, func(cur users.User, m bool) (map[string]any, *users.Name, error) {
+			if changed = m; !m {
+				return nil, nil, nil
+			}
+			return cur.TrustedMetadata, nil, nil
+		}); err != nil {
+			return migrated, err
+		}
+
+		if changed {
+			migrated = append(migrated, userID)
+		}
+	}
+
+	return migrated, nil
+}
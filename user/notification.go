@@ -0,0 +1,52 @@
+package user
+
+import (
+	"context"
+	"errors"
+
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/users"
+)
+
+var ErrCategoryRequired = errors.New("notification category is required")
+
+// SetNotificationPreferences stores the channels a user receives category
+// on. Turning off a mandatory channel, such as email for security notices,
+// fails with dto.ErrMandatoryChannel.
+func (u *UserService) SetNotificationPreferences(ctx context.Context, userID string, category string, p dto.ChannelPreferences) (*dto.User, error) {
+	if category == "" {
+		return nil, ErrCategoryRequired
+	}
+
+	if err := dto.ValidateChannelPreferences(category, p); err != nil {
+		return nil, err
+	}
+
+	stored, err := u.updateMetadata(ctx, userID, func(cur users.User, _ bool) (map[string]any, *users.Name, error) {
+		user, err := dto.ConvertStytchUser(cur)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		prefs := make(map[string]dto.ChannelPreferences, len(user.TrustedMetadata.NotificationPreferences)+1)
+		for k, v := range user.TrustedMetadata.NotificationPreferences {
+			prefs[k] = v
+		}
+		prefs[category] = p
+		user.TrustedMetadata.NotificationPreferences = prefs
+
+		data, err := user.TrustedMetadata.ToMap()
+		return data, nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := dto.ConvertStytchUser(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
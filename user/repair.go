@@ -0,0 +1,206 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/idgen"
+
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/users"
+)
+
+// maxIDAttempts bounds how many ids are drawn for a user before giving up
+const maxIDAttempts = 5
+
+var ErrIDGenerationExhausted = errors.New("could not generate a unique system user id")
+
+type SystemUserIDReassignment struct {
+	UserID          string
+	OldSystemUserID string
+	NewSystemUserID string
+}
+
+// ReassignDuplicateSystemUserIDs finds users sharing a SystemUserID and gives
+// every one but the earliest created a fresh id. With dryRun set, the planned
+// changes are returned without being written.
+func (u *UserService) ReassignDuplicateSystemUserIDs(ctx context.Context, gen idgen.Generator, dryRun bool) ([]SystemUserIDReassignment, error) {
+	var all []users.User
+
+	if err := u.each(ctx, nil, func(su users.User) bool {
+		all = append(all, su)
+		return true
+	}); err != nil {
+		return nil, err
+	}
+
+	plan, err := planReassignments(all, gen)
+	if err != nil || dryRun {
+		return plan, err
+	}
+
+	for i, r := range plan {
+		_, err := u.updateMetadata(ctx, r.UserID, func(cur users.User, _ bool) (map[string]any, *users.Name, error) {
+			// leave users whose id changed since the scan alone
+			if fmt.Sprint(cur.TrustedMetadata["system_user_id"]) != r.OldSystemUserID {
+				return nil, nil, nil
+			}
+
+			tm := make(map[string]any, len(cur.TrustedMetadata))
+			for k, v := range cur.TrustedMetadata {
+				tm[k] = v
+			}
+			tm["system_user_id"] = r.NewSystemUserID
+			return tm, nil, nil
+		})
+		if err != nil {
+			return plan[:i], err
+		}
+	}
+
+	return plan, nil
+}
+
+func planReassignments(all []users.User, gen idgen.Generator) ([]SystemUserIDReassignment, error) {
+	var (
+		taken  = map[string]bool{}
+		groups = map[string][]users.User{}
+	)
+
+	for _, su := range all {
+		id := fmt.Sprint(su.TrustedMetadata["system_user_id"])
+		if su.TrustedMetadata["system_user_id"] == nil || id == "" {
+			continue
+		}
+		taken[id] = true
+		groups[id] = append(groups[id], su)
+	}
+
+	var dupIDs []string
+	for id, g := range groups {
+		if len(g) > 1 {
+			dupIDs = append(dupIDs, id)
+		}
+	}
+	sort.Strings(dupIDs)
+
+	var plan []SystemUserIDReassignment
+
+	for _, id := range dupIDs {
+		g := groups[id]
+		sort.SliceStable(g, func(i, j int) bool {
+			return createdAt(g[i]).Before(createdAt(g[j]))
+		})
+
+		// the oldest account keeps its id, since it has had longest to share it
+		for _, su := range g[1:] {
+			newID, err := UniqueSystemUserID(gen, taken)
+			if err != nil {
+				return plan, err
+			}
+
+			plan = append(plan, SystemUserIDReassignment{
+				UserID:          su.UserID,
+				OldSystemUserID: id,
+				NewSystemUserID: newID,
+			})
+		}
+	}
+
+	return plan, nil
+}
+
+// UniqueSystemUserID draws ids from gen until one is not in taken, and
+// marks it taken.
+func UniqueSystemUserID(gen idgen.Generator, taken map[string]bool) (string, error) {
+	id, err := drawID(gen, func(id string) (bool, error) { return taken[id], nil })
+	if err == nil {
+		taken[id] = true
+	}
+	return id, err
+}
+
+// NewSystemUserID draws ids from gen until one no user holds, as checked by
+// SystemUserIDExists.
+func (u *UserService) NewSystemUserID(ctx context.Context, gen idgen.Generator) (string, error) {
+	return drawID(gen, func(id string) (bool, error) { return u.SystemUserIDExists(ctx, id) })
+}
+
+// drawID draws up to maxIDAttempts ids, returning the first one not taken.
+func drawID(gen idgen.Generator, taken func(id string) (bool, error)) (string, error) {
+	for i := 0; i < maxIDAttempts; i++ {
+		id, err := gen.Generate()
+		if err != nil {
+			return "", err
+		}
+
+		exists, err := taken(id)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return id, nil
+		}
+	}
+
+	return "", ErrIDGenerationExhausted
+}
+
+func createdAt(su users.User) time.Time {
+	if su.CreatedAt == nil {
+		return time.Time{}
+	}
+	return *su.CreatedAt
+}
+
+// BootstrapTrustedMetadata applies dto.DefaultTrustedMetadata, with a fresh
+// SystemUserID, to users created before it existed or whose signup never
+// completed it. Keys the user already has are kept. It returns the ids of
+// the users that were, or with dryRun would be, updated.
+func (u *UserService) BootstrapTrustedMetadata(ctx context.Context, gen idgen.Generator, dryRun bool) ([]string, error) {
+	var (
+		all   []users.User
+		taken = map[string]bool{}
+	)
+
+	if err := u.each(ctx, nil, func(su users.User) bool {
+		all = append(all, su)
+		if id, ok := su.TrustedMetadata["system_user_id"].(string); ok && id != "" {
+			taken[id] = true
+		}
+		return true
+	}); err != nil {
+		return nil, err
+	}
+
+	var updated []string
+
+	for _, su := range all {
+		if id, ok := su.TrustedMetadata["system_user_id"].(string); ok && id != "" {
+			continue
+		}
+
+		newID, err := UniqueSystemUserID(gen, taken)
+		if err != nil {
+			return updated, err
+		}
+
+		defaults, err := dto.NewTrustedMetadata(newID).ToMap()
+		if err != nil {
+			return updated, err
+		}
+
+		if !dryRun {
+			if _, err := u.SeedTrustedMetadata(ctx, su.UserID, defaults); err != nil {
+				return updated, err
+			}
+		}
+
+		updated = append(updated, su.UserID)
+	}
+
+	return updated, nil
+}
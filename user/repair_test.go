@@ -0,0 +1,81 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/otyang/go-authsvc/idgen"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/users"
+)
+
+func TestPlanReassignments(t *testing.T) {
+	var (
+		older = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+		newer = older.Add(time.Hour)
+		seq   = []string{"dup", "fresh1", "fresh2"}
+		gen   = idgen.GeneratorFunc(func() (string, error) {
+			id := seq[0]
+			seq = seq[1:]
+			return id, nil
+		})
+	)
+
+	all := []users.User{
+		{UserID: "u3", CreatedAt: &newer, TrustedMetadata: map[string]any{"system_user_id": "dup"}},
+		{UserID: "u1", CreatedAt: &older, TrustedMetadata: map[string]any{"system_user_id": "dup"}},
+		{UserID: "u2", CreatedAt: &newer, TrustedMetadata: map[string]any{"system_user_id": "unique"}},
+		{UserID: "u4", TrustedMetadata: map[string]any{}},
+	}
+
+	plan, err := planReassignments(all, gen)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []SystemUserIDReassignment{
+		{UserID: "u3", OldSystemUserID: "dup", NewSystemUserID: "fresh1"},
+	}, plan)
+}
+
+func TestPlanReassignments_Exhausted(t *testing.T) {
+	gen := idgen.GeneratorFunc(func() (string, error) { return "dup", nil })
+
+	all := []users.User{
+		{UserID: "u1", TrustedMetadata: map[string]any{"system_user_id": "dup"}},
+		{UserID: "u2", TrustedMetadata: map[string]any{"system_user_id": "dup"}},
+	}
+
+	_, err := planReassignments(all, gen)
+	assert.ErrorIs(t, err, ErrIDGenerationExhausted)
+}
+
+func TestDrawID(t *testing.T) {
+	var (
+		n   = 0
+		gen = idgen.GeneratorFunc(func() (string, error) { n++; return fmt.Sprint("id", n), nil })
+	)
+
+	id, err := drawID(gen, func(id string) (bool, error) { return id != "id3", nil })
+	assert.NoError(t, err)
+	assert.Equal(t, "id3", id, "collisions draw again")
+
+	_, err = drawID(gen, func(string) (bool, error) { return true, nil })
+	assert.ErrorIs(t, err, ErrIDGenerationExhausted)
+	assert.Equal(t, 3+maxIDAttempts, n)
+
+	lookup := errors.New("search failed")
+	_, err = drawID(gen, func(string) (bool, error) { return false, lookup })
+	assert.ErrorIs(t, err, lookup)
+}
+
+func TestSeed(t *testing.T) {
+	defaults := map[string]any{"system_user_id": "1001", "user_role": "customer"}
+
+	assert.Equal(t, defaults, seed(nil, defaults))
+	assert.Nil(t, seed(map[string]any{"system_user_id": "7", "user_role": "admin"}, defaults), "nothing to fill in")
+
+	got := seed(map[string]any{"system_user_id": "", "user_role": "admin", "extra": true}, defaults)
+	assert.Equal(t, map[string]any{"system_user_id": "1001", "user_role": "admin", "extra": true}, got)
+}
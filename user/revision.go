@@ -0,0 +1,198 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/users"
+)
+
+// revisionKey is the trusted metadata key counting updates made through
+// this package.
+const revisionKey = "revision"
+
+const defaultUpdateAttempts = 3
+
+var ErrConflict = errors.New("user was updated concurrently")
+
+// ConflictError is returned when an update kept racing with other writers
+// for every attempt. It matches ErrConflict with errors.Is.
+type ConflictError struct {
+	UserID   string
+	Attempts int
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: user %s, %d attempts", ErrConflict, e.UserID, e.Attempts)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// WithUpdateAttempts sets how often an update is retried after losing a
+// race before it fails with a *ConflictError. The default is 3.
+func WithUpdateAttempts(n int) Option {
+	return func(u *UserService) { u.updateAttempts = n }
+}
+
+// WithUserLocks serialises updates to the same user within this process.
+// Stytch has no conditional writes, so the revision check only narrows the
+// race between writers; for hot paths served by one process the lock
+// closes it.
+func WithUserLocks() Option {
+	return func(u *UserService) { u.locks = &userLocks{m: map[string]*userLock{}} }
+}
+
+// metadataChange computes a user's new trusted metadata, and optionally a
+// new name, from the current user. migrated reports whether cur's metadata
+// was upgraded by WithMigrations on read. Returning a nil map leaves the
+// user unchanged.
+type metadataChange func(cur users.User, migrated bool) (map[string]any, *users.Name, error)
+
+// updateMetadata is the read-modify-write behind every trusted metadata
+// update. The revision read with the user is compared with a fresh read just
+// before writing; if another writer got in between, the change is computed
+// again on top of their update.
+func (u *UserService) updateMetadata(ctx context.Context, userID string, change metadataChange) (users.User, error) {
+	defer u.locks.lock(userID)()
+
+	attempts := u.updateAttempts
+	if attempts <= 0 {
+		attempts = defaultUpdateAttempts
+	}
+
+	for i := 0; i < attempts; i++ {
+		if err := ctx.Err(); err != nil {
+			return users.User{}, err
+		}
+
+		cur, err := u.fetchStytchUser(ctx, userID)
+		if err != nil {
+			return users.User{}, err
+		}
+		rev := revision(cur.TrustedMetadata)
+
+		var migrated bool
+		cur.TrustedMetadata, migrated, err = u.migrations.Migrate(cur.TrustedMetadata)
+		if err != nil {
+			return users.User{}, err
+		}
+
+		tm, name, err := change(cur, migrated)
+		if err != nil {
+			return users.User{}, err
+		}
+		if tm == nil {
+			return cur, nil
+		}
+		tm[revisionKey] = rev + 1
+
+		latest, err := u.fetchStytchUser(ctx, userID)
+		if err != nil {
+			return users.User{}, err
+		}
+		if revision(latest.TrustedMetadata) != rev {
+			continue
+		}
+
+		return u.updateUser(ctx, userID, name, tm)
+	}
+
+	return users.User{}, &ConflictError{UserID: userID, Attempts: attempts}
+}
+
+// userUpdate is the users.UpdateParams body with every part of the name
+// sent: the SDK omits empty parts, so a cleared part would be kept.
+type userUpdate struct {
+	Name            *fullName      `json:"name,omitempty"`
+	TrustedMetadata map[string]any `json:"trusted_metadata,omitempty"`
+}
+
+type fullName struct {
+	FirstName  string `json:"first_name"`
+	MiddleName string `json:"middle_name"`
+	LastName   string `json:"last_name"`
+}
+
+func (u *UserService) updateUser(ctx context.Context, userID string, name *users.Name, tm map[string]any) (users.User, error) {
+	body := userUpdate{TrustedMetadata: tm}
+	if name != nil {
+		body.Name = &fullName{FirstName: name.FirstName, MiddleName: name.MiddleName, LastName: name.LastName}
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return users.User{}, err
+	}
+
+	var resp users.UpdateResponse
+	err = u.client.Users.C.NewRequest(ctx, http.MethodPut, fmt.Sprintf("/v1/users/%s", userID), nil, b, &resp)
+	if err != nil {
+		return users.User{}, dto.HandleError(err)
+	}
+
+	return resp.User, nil
+}
+
+// revision reads the update counter; stored metadata comes back from JSON,
+// so it is usually a float64.
+func revision(tm map[string]any) int64 {
+	switch v := tm[revisionKey].(type) {
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	default:
+		return 0
+	}
+}
+
+// userLocks hands out one mutex per user id, dropping it once unused. A nil
+// *userLocks does no locking.
+type userLocks struct {
+	mu sync.Mutex
+	m  map[string]*userLock
+}
+
+type userLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks userID and returns the matching unlock.
+func (l *userLocks) lock(userID string) func() {
+	if l == nil {
+		return func() {}
+	}
+
+	l.mu.Lock()
+	ul, ok := l.m[userID]
+	if !ok {
+		ul = &userLock{}
+		l.m[userID] = ul
+	}
+	ul.refs++
+	l.mu.Unlock()
+
+	ul.Lock()
+
+	return func() {
+		ul.Unlock()
+
+		l.mu.Lock()
+		ul.refs--
+		if ul.refs == 0 {
+			delete(l.m, userID)
+		}
+		l.mu.Unlock()
+	}
+}
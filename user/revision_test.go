@@ -0,0 +1,107 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevision(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    map[string]any
+		expected int64
+	}{
+		{name: "missing", input: map[string]any{}, expected: 0},
+		{name: "nil map", input: nil, expected: 0},
+		{name: "json number", input: map[string]any{revisionKey: float64(7)}, expected: 7},
+		{name: "int", input: map[string]any{revisionKey: 3}, expected: 3},
+		{name: "garbage", input: map[string]any{revisionKey: "x"}, expected: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, revision(tc.input))
+		})
+	}
+}
+
+func TestConflictError(t *testing.T) {
+	err := error(&ConflictError{UserID: "user-1", Attempts: 3})
+
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.Contains(t, err.Error(), "user-1")
+}
+
+func TestUserLocks(t *testing.T) {
+	var (
+		l       = &userLocks{m: map[string]*userLock{}}
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		running int
+		maxSeen int
+	)
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer l.lock("user-1")()
+
+			mu.Lock()
+			running++
+			if running > maxSeen {
+				maxSeen = running
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, maxSeen)
+	assert.Empty(t, l.m, "unused locks are dropped")
+
+	// other users are not blocked, and a nil lock set is a no-op
+	unlock := l.lock("user-1")
+	l.lock("user-2")()
+	unlock()
+
+	var none *userLocks
+	none.lock("user-1")()
+}
+
+func TestUserService_Update_clearName(t *testing.T) {
+	var sent map[string]any
+
+	client := fakeStytch(t, func(w http.ResponseWriter, r *http.Request) {
+		user := `"user_id":"user-1","name":{"first_name":"Ada","middle_name":"Eze","last_name":"Obi"},"trusted_metadata":{"user_role":"customer"}`
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = w.Write([]byte(`{"status_code":200,` + user + `}`))
+		case http.MethodPut:
+			b, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(b, &sent)
+			_, _ = w.Write([]byte(`{"status_code":200,"user_id":"user-1","user":{` + user + `}}`))
+		}
+	})
+
+	_, err := NewUserService(client).Update(context.TODO(), "user-1", dto.ProfileUpdate{MiddleName: dto.Clear[string]()})
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]any{"first_name": "Ada", "middle_name": "", "last_name": "Obi"}, sent["name"],
+		"a cleared part is sent empty, not left out")
+}
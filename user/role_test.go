@@ -0,0 +1,68 @@
+package user
+
+import (
+	"context"
+	"testing"
+
+	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/rbac"
+	"github.com/otyang/go-authsvc/session"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUserService_authorizeRoleChange(t *testing.T) {
+	var (
+		u     = &UserService{roles: rbac.DefaultRegistry()}
+		admin = session.NewContext(context.TODO(), &dto.Session{
+			User: dto.User{TrustedMetadata: dto.TrustedMetadata{SystemMetadata: dto.SystemMetadata{UserRole: rbac.RoleAdmin}}},
+		})
+		customer = session.NewContext(context.TODO(), &dto.Session{
+			User: dto.User{TrustedMetadata: dto.TrustedMetadata{SystemMetadata: dto.SystemMetadata{UserRole: rbac.RoleCustomer}}},
+		})
+	)
+
+	assert.NoError(t, u.authorizeRoleChange(context.TODO(), nil))
+	assert.NoError(t, u.authorizeRoleChange(admin, toPointer(rbac.RoleAdmin)))
+	assert.ErrorIs(t, u.authorizeRoleChange(admin, toPointer("1role")), rbac.ErrUnknownRole)
+	assert.ErrorIs(t, u.authorizeRoleChange(customer, toPointer(rbac.RoleAdmin)), rbac.ErrForbidden)
+	assert.ErrorIs(t, u.authorizeRoleChange(context.TODO(), toPointer(rbac.RoleAdmin)), rbac.ErrForbidden)
+
+	// without a registry rbac.Default is enforced
+	assert.ErrorIs(t, (&UserService{}).authorizeRoleChange(context.TODO(), toPointer("1role")), rbac.ErrUnknownRole)
+	assert.ErrorIs(t, (&UserService{}).authorizeRoleChange(context.TODO(), toPointer(rbac.RoleAdmin)), rbac.ErrForbidden)
+	assert.NoError(t, (&UserService{}).authorizeRoleChange(admin, toPointer(rbac.RoleAdmin)))
+	assert.Same(t, rbac.Default, NewUserService(nil, WithRoles(nil)).roles)
+}
+
+func TestUserService_vetSystemChange(t *testing.T) {
+	var (
+		u       = &UserService{roles: rbac.DefaultRegistry()}
+		pinHash = "$2a$10$stored"
+		before  = dto.SystemMetadata{UserRole: rbac.RoleCustomer, PinHash: &pinHash}
+		imp     = session.NewContext(context.TODO(), &dto.Session{ImpersonatedBy: "admin-1"})
+	)
+
+	unchanged := map[string]any{"user_role": rbac.RoleCustomer, "pin_hash": &pinHash}
+	assert.NoError(t, u.vetSystemChange(imp, before, unchanged))
+	assert.Equal(t, &pinHash, unchanged["pin_hash"], "an unchanged PIN is not hashed again")
+
+	assert.ErrorIs(t, u.vetSystemChange(context.TODO(), before, map[string]any{"user_role": rbac.RoleAdmin}), rbac.ErrForbidden)
+
+	newPin := map[string]any{"user_role": rbac.RoleCustomer, "pin_hash": "1234"}
+	assert.ErrorIs(t, u.vetSystemChange(imp, before, newPin), session.ErrImpersonationForbidden)
+	assert.ErrorIs(t, u.vetSystemChange(imp, before, map[string]any{"user_role": rbac.RoleCustomer}), session.ErrImpersonationForbidden, "nor cleared")
+
+	assert.NoError(t, u.vetSystemChange(context.TODO(), before, newPin))
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(newPin["pin_hash"].(string)), []byte("1234")))
+}
+
+func TestUserService_PatchTrustedMetadata_systemKeys(t *testing.T) {
+	u := &UserService{}
+
+	for _, key := range []string{"user_role", "pin_hash", "suspended", "revision", "schema_version"} {
+		err := u.PatchTrustedMetadata(context.TODO(), "user-1", map[string]any{"theme": "dark", key: "x"})
+		assert.ErrorIs(t, err, ErrSystemMetadataKey, key)
+	}
+}
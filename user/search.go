@@ -0,0 +1,219 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/users"
+)
+
+// SearchParams filters users. Zero fields are ignored; all set fields must
+// match. Email, Status and the created-at range are filtered by Stytch, the
+// rest are matched against trusted metadata as each page comes back.
+type SearchParams struct {
+	Email         string
+	PhoneNumber   string
+	Status        string // "active" or "pending"
+	Role          string
+	SystemUserID  string // doubles as the referral code
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// TrustedMetadata matches top level keys by their printed value.
+	TrustedMetadata map[string]any
+	// PageSize defaults to, and is capped at, 1000.
+	PageSize uint32
+}
+
+type SearchPage struct {
+	Users []dto.User
+	// Skipped are the users whose trusted metadata could not be migrated;
+	// they are left out of Users rather than failing the page.
+	Skipped []SkippedUser
+	// NextCursor is empty on the last page.
+	NextCursor string
+}
+
+// SkippedUser is a user a search left out, and why.
+type SkippedUser struct {
+	UserID string
+	Err    error
+}
+
+// Search returns one page of matching users starting at cursor. Since some
+// filters are applied after Stytch pages the results, a page may hold fewer
+// than PageSize users, or none, while NextCursor is still set.
+func (u *UserService) Search(ctx context.Context, p SearchParams, cursor string) (*SearchPage, error) {
+	limit := p.PageSize
+	if limit == 0 || limit > searchPageLimit {
+		limit = searchPageLimit
+	}
+
+	resp, err := u.client.Users.Search(ctx, &users.SearchParams{
+		Cursor: cursor,
+		Limit:  limit,
+		Query:  p.query(),
+	})
+	if err != nil {
+		return nil, dto.HandleError(err)
+	}
+
+	page := u.page(p, resp.Results)
+	page.NextCursor = resp.ResultsMetadata.NextCursor
+
+	return page, nil
+}
+
+// page migrates and filters one page of results.
+func (u *UserService) page(p SearchParams, results []users.User) *SearchPage {
+	page := &SearchPage{}
+
+	for _, su := range results {
+		tm, _, err := u.migrations.Migrate(su.TrustedMetadata)
+		if err != nil {
+			page.Skipped = append(page.Skipped, SkippedUser{UserID: su.UserID, Err: err})
+			continue
+		}
+
+		su.TrustedMetadata = tm
+		if p.matches(su) {
+			page.Users = append(page.Users, dto.ConvertStytchUserToUser(su))
+		}
+	}
+
+	return page
+}
+
+// UserIterator walks every page of a search:
+//
+//	it := svc.Iterate(params)
+//	for it.Next(ctx) {
+//		u := it.User()
+//	}
+//	if err := it.Err(); err != nil {...}
+type UserIterator struct {
+	svc     *UserService
+	params  SearchParams
+	cursor  string
+	buf     []dto.User
+	cur     dto.User
+	skipped []SkippedUser
+	done    bool
+	err     error
+}
+
+func (u *UserService) Iterate(p SearchParams) *UserIterator {
+	return &UserIterator{svc: u, params: p}
+}
+
+// Next advances to the next user, fetching pages as needed. It returns
+// false when the results are exhausted or an error occurred.
+func (it *UserIterator) Next(ctx context.Context) bool {
+	for len(it.buf) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+
+		page, err := it.svc.Search(ctx, it.params, it.cursor)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.buf, it.cursor = page.Users, page.NextCursor
+		it.skipped = append(it.skipped, page.Skipped...)
+		it.done = it.cursor == ""
+	}
+
+	it.cur, it.buf = it.buf[0], it.buf[1:]
+	return true
+}
+
+func (it *UserIterator) User() dto.User { return it.cur }
+
+func (it *UserIterator) Err() error { return it.err }
+
+// Skipped returns the users left out so far; see SearchPage.Skipped.
+func (it *UserIterator) Skipped() []SkippedUser { return it.skipped }
+
+// ExportUsers streams every matching user to w as JSON lines, one user per
+// line, without holding the full result set in memory.
+func (u *UserService) ExportUsers(ctx context.Context, p SearchParams, w io.Writer) (int, error) {
+	var (
+		enc   = json.NewEncoder(w)
+		it    = u.Iterate(p)
+		count = 0
+	)
+
+	for it.Next(ctx) {
+		if err := enc.Encode(it.User()); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, it.Err()
+}
+
+func (p SearchParams) query() *users.SearchUsersQuery {
+	var operands []map[string]any
+
+	if p.Email != "" {
+		operands = append(operands, map[string]any{"filter_name": "email_address", "filter_value": []string{p.Email}})
+	}
+
+	if p.Status != "" {
+		operands = append(operands, map[string]any{"filter_name": "status", "filter_value": p.Status})
+	}
+
+	if !p.CreatedAfter.IsZero() || !p.CreatedBefore.IsZero() {
+		between := map[string]any{}
+		if !p.CreatedAfter.IsZero() {
+			between["greater_than"] = p.CreatedAfter.UTC().Format(time.RFC3339)
+		}
+		if !p.CreatedBefore.IsZero() {
+			between["less_than"] = p.CreatedBefore.UTC().Format(time.RFC3339)
+		}
+		operands = append(operands, map[string]any{"filter_name": "created_at_between", "filter_value": between})
+	}
+
+	if len(operands) == 0 {
+		return nil
+	}
+
+	return &users.SearchUsersQuery{
+		Operator: users.SearchUsersQueryOperatorAND,
+		Operands: operands,
+	}
+}
+
+// matches applies the filters Stytch cannot evaluate.
+func (p SearchParams) matches(su users.User) bool {
+	want := map[string]any{}
+	for k, v := range p.TrustedMetadata {
+		want[k] = v
+	}
+
+	if p.PhoneNumber != "" {
+		want["user_phone_number"] = p.PhoneNumber
+	}
+	if p.Role != "" {
+		want["user_role"] = p.Role
+	}
+	if p.SystemUserID != "" {
+		want["system_user_id"] = p.SystemUserID
+	}
+
+	for k, v := range want {
+		got, ok := su.TrustedMetadata[k]
+		if !ok || got == nil || fmt.Sprint(got) != fmt.Sprint(v) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,74 @@
+package user
+
+import (
+	"testing"
+	"time"
+
+	"github.com/otyang/go-authsvc/migrate"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/users"
+)
+
+func TestSearchParams_query(t *testing.T) {
+	assert.Nil(t, SearchParams{Role: "admin"}.query())
+
+	q := SearchParams{
+		Email:        "a@example.com",
+		Status:       "active",
+		CreatedAfter: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}.query()
+
+	assert.Equal(t, users.SearchUsersQueryOperatorAND, q.Operator)
+	assert.Equal(t, []map[string]any{
+		{"filter_name": "email_address", "filter_value": []string{"a@example.com"}},
+		{"filter_name": "status", "filter_value": "active"},
+		{"filter_name": "created_at_between", "filter_value": map[string]any{"greater_than": "2024-01-01T00:00:00Z"}},
+	}, q.Operands)
+}
+
+func TestSearchParams_matches(t *testing.T) {
+	su := users.User{TrustedMetadata: map[string]any{
+		"system_user_id":    "abc123",
+		"user_role":         "admin",
+		"user_phone_number": "+2348000000000",
+		"notification_sms":  true,
+	}}
+
+	testCases := []struct {
+		name   string
+		params SearchParams
+		want   bool
+	}{
+		{name: "no filters", params: SearchParams{}, want: true},
+		{name: "phone", params: SearchParams{PhoneNumber: "+2348000000000"}, want: true},
+		{name: "referral code", params: SearchParams{SystemUserID: "abc123", Role: "admin"}, want: true},
+		{name: "wrong role", params: SearchParams{SystemUserID: "abc123", Role: "customer"}, want: false},
+		{name: "metadata bool", params: SearchParams{TrustedMetadata: map[string]any{"notification_sms": true}}, want: true},
+		{name: "missing key", params: SearchParams{TrustedMetadata: map[string]any{"referred_by": "x"}}, want: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.params.matches(su))
+		})
+	}
+}
+
+func TestUserService_page(t *testing.T) {
+	u := &UserService{migrations: migrate.NewRegistry(func(tm map[string]any) error { return nil })}
+
+	page := u.page(SearchParams{Role: "admin"}, []users.User{
+		{UserID: "u1", TrustedMetadata: map[string]any{"user_role": "admin", "schema_version": 0}},
+		{UserID: "u2", TrustedMetadata: map[string]any{"user_role": "admin", "schema_version": "two"}},
+		{UserID: "u3", TrustedMetadata: map[string]any{"user_role": "customer"}},
+	})
+
+	if assert.Len(t, page.Users, 1) {
+		assert.Equal(t, "u1", page.Users[0].UserID)
+	}
+	if assert.Len(t, page.Skipped, 1, "a bad schema_version skips the user, not the page") {
+		assert.Equal(t, "u2", page.Skipped[0].UserID)
+		assert.ErrorIs(t, page.Skipped[0].Err, migrate.ErrInvalidVersion)
+	}
+}
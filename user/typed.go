@@ -0,0 +1,67 @@
+package user
+
+import (
+	"context"
+
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stytchauth/stytch-go/v11/stytch/consumer/users"
+)
+
+// Typed reads and updates users through an application metadata schema M.
+// It shares the role checks and other options of the UserService it wraps.
+type Typed[M dto.Metadata] struct {
+	svc *UserService
+}
+
+func NewTyped[M dto.Metadata](svc *UserService) *Typed[M] {
+	return &Typed[M]{svc: svc}
+}
+
+// Get is UserService.Get for the schema M.
+func (t *Typed[M]) Get(ctx context.Context, userID string) (*dto.UserOf[M], error) {
+	uv, err := t.svc.getStytchUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := dto.ConvertStytchUserOf[M](uv)
+	return &user, err
+}
+
+// UpdateMetadata merges patch into the user's metadata (see dto.ApplyPatch)
+// and returns the user as stored afterwards. A pin_hash in patch is the
+// plain PIN, hashed before it is stored, as with UserService.Update.
+func (t *Typed[M]) UpdateMetadata(ctx context.Context, userID string, patch any) (*dto.UserOf[M], error) {
+	stored, err := t.svc.updateMetadata(ctx, userID, func(cur users.User, _ bool) (map[string]any, *users.Name, error) {
+		user, err := dto.ConvertStytchUserOf[M](cur)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		updated, err := dto.ApplyPatch(user.TrustedMetadata, patch)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		data, err := dto.MetadataToMap(updated)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := t.svc.vetSystemChange(ctx, user.TrustedMetadata.System(), data); err != nil {
+			return nil, nil, err
+		}
+		return data, nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := dto.ConvertStytchUserOf[M](stored)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
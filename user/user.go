@@ -2,32 +2,128 @@ package user
 
 import (
 	"context"
+	"time"
 
+	"github.com/otyang/go-authsvc/audit"
 	"github.com/otyang/go-authsvc/dto"
+	"github.com/otyang/go-authsvc/hook"
+	"github.com/otyang/go-authsvc/migrate"
+	"github.com/otyang/go-authsvc/rbac"
+	"github.com/otyang/go-authsvc/session"
 
 	"github.com/stytchauth/stytch-go/v11/stytch/consumer/stytchapi"
 	"github.com/stytchauth/stytch-go/v11/stytch/consumer/users"
 )
 
 type UserService struct {
-	client *stytchapi.API
+	client        *stytchapi.API
+	sessionSvc    *session.SessionService
+	roles         *rbac.Registry
+	hooks         *hook.Hooks
+	auditLog      audit.Logger
+	deletionGrace time.Duration
+	migrations    *migrate.Registry
+
+	updateAttempts int
+	locks          *userLocks
+}
+
+type Option func(*UserService)
+
+// WithRoles replaces rbac.Default in the role checks of Update and
+// UpdateProfile: the new role must be registered, and the session in ctx
+// (see session.NewContext) must hold rbac.PermRoleAdmin. A nil reg keeps
+// rbac.Default.
+func WithRoles(reg *rbac.Registry) Option {
+	return func(u *UserService) {
+		if reg != nil {
+			u.roles = reg
+		}
+	}
+}
+
+// WithHooks sets where deletion events are sent.
+func WithHooks(h *hook.Hooks) Option {
+	return func(u *UserService) { u.hooks = h }
+}
+
+// WithAuditLogger records exports and deletions. If l also implements
+// audit.Reader, Export includes the user's audit trail.
+func WithAuditLogger(l audit.Logger) Option {
+	return func(u *UserService) { u.auditLog = l }
 }
 
-func NewUserService(client *stytchapi.API) *UserService {
-	return &UserService{
-		client: client,
+// WithDeletionGracePeriod makes Delete schedule erasure d from now instead
+// of erasing at once.
+func WithDeletionGracePeriod(d time.Duration) Option {
+	return func(u *UserService) { u.deletionGrace = d }
+}
+
+// WithMigrations upgrades trusted metadata as it is read. The upgraded
+// metadata is stored by the next update of the user; see also
+// MigrateTrustedMetadata.
+func WithMigrations(r *migrate.Registry) Option {
+	return func(u *UserService) { u.migrations = r }
+}
+
+// WithSessionService shares a configured SessionService, so the sessions
+// Delete revokes are audited and cleaned up the same way as on Logout.
+func WithSessionService(svc *session.SessionService) Option {
+	return func(u *UserService) { u.sessionSvc = svc }
+}
+
+func NewUserService(client *stytchapi.API, opts ...Option) *UserService {
+	u := &UserService{
+		client:     client,
+		sessionSvc: session.NewSessionService(client),
+		roles:      rbac.Default,
+	}
+
+	for _, opt := range opts {
+		opt(u)
 	}
+
+	return u
 }
 
+// Get returns a user. When trusted metadata has fields that do not decode,
+// the user is returned with those fields zero, together with a
+// *dto.MetadataError naming them, so admin tools can still show and repair
+// the account.
 func (u *UserService) Get(ctx context.Context, userID string) (*dto.User, error) {
+	uv, err := u.getStytchUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := dto.ConvertStytchUser(uv)
+	return &user, err
+}
+
+// getStytchUser fetches a user with its trusted metadata migrated.
+func (u *UserService) getStytchUser(ctx context.Context, userID string) (users.User, error) {
+	uv, err := u.fetchStytchUser(ctx, userID)
+	if err != nil {
+		return users.User{}, err
+	}
+
+	uv.TrustedMetadata, _, err = u.migrations.Migrate(uv.TrustedMetadata)
+	if err != nil {
+		return users.User{}, err
+	}
+
+	return uv, nil
+}
+
+func (u *UserService) fetchStytchUser(ctx context.Context, userID string) (users.User, error) {
 	resp, err := u.client.Users.Get(context.Background(), &users.GetParams{
 		UserID: userID,
 	})
 	if err != nil {
-		return nil, dto.HandleError(err)
+		return users.User{}, dto.HandleError(err)
 	}
 
-	uv := users.User{
+	return users.User{
 		UserID:                 resp.UserID,
 		Emails:                 resp.Emails,
 		Status:                 resp.Status,
@@ -42,43 +138,134 @@ func (u *UserService) Get(ctx context.Context, userID string) (*dto.User, error)
 		Password:               resp.Password,
 		TrustedMetadata:        resp.TrustedMetadata,
 		UntrustedMetadata:      resp.UntrustedMetadata,
+	}, nil
+}
+
+// UpdateProfile applies param, leaving nil fields and empty name parts
+// unchanged, and returns the user as stored afterwards. Use Update to clear
+// fields.
+func (u *UserService) UpdateProfile(ctx context.Context, userID string, param *dto.UpdateUserParams) (*dto.User, error) {
+	if param == nil {
+		return u.Get(ctx, userID)
 	}
 
-	user := dto.ConvertStytchUserToUser(uv)
+	return u.Update(ctx, userID, param.ProfileUpdate())
+}
+
+// Update applies p and returns the user as stored afterwards.
+func (u *UserService) Update(ctx context.Context, userID string, p dto.ProfileUpdate) (*dto.User, error) {
+	stored, err := u.updateMetadata(ctx, userID, func(cur users.User, _ bool) (map[string]any, *users.Name, error) {
+		user, err := dto.ConvertStytchUser(cur)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		metadata, err := dto.ApplyPatch(user.TrustedMetadata, p)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		data, err := metadata.ToMap()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := u.vetSystemChange(ctx, user.TrustedMetadata.System(), data); err != nil {
+			return nil, nil, err
+		}
+
+		// stytch replaces the whole name, so unchanged parts are sent as they are
+		name, changed := p.NameWith(dto.Name{
+			FirstName:  deref(user.FirstName),
+			MiddleName: deref(user.MiddleName),
+			LastName:   deref(user.LastName),
+		})
+		if !changed {
+			return data, nil, nil
+		}
+
+		return data, &users.Name{
+			FirstName:  name.FirstName,
+			MiddleName: name.MiddleName,
+			LastName:   name.LastName,
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := dto.ConvertStytchUser(stored)
+	if err != nil {
+		return nil, err
+	}
 
 	return &user, nil
 }
 
-func (u *UserService) UpdateProfile(ctx context.Context, userID string, param *dto.UpdateUserParams) (*dto.User, error) {
-	user, err := u.Get(ctx, userID)
-	if err != nil {
-		return nil, dto.HandleError(err)
+func deref(s *string) string {
+	if s == nil {
+		return ""
 	}
+	return *s
+}
 
-	if param == nil {
-		return user, nil
+// vetSystemChange applies the rules every metadata update follows, through
+// whichever schema it is made: data is the metadata about to be stored.
+// Changing the role takes a role admin; changing the PIN is refused in an
+// impersonation session, and a new PIN is stored hashed.
+func (u *UserService) vetSystemChange(ctx context.Context, before dto.SystemMetadata, data map[string]any) error {
+	if role := str(data["user_role"]); role != before.UserRole {
+		if err := u.authorizeRoleChange(ctx, &role); err != nil {
+			return err
+		}
 	}
 
-	updatedUserTrustedMetadata, err := param.UpdateWith(user.TrustedMetadata)
-	if err != nil {
-		return nil, err
+	pin := str(data["pin_hash"])
+	if pin == deref(before.PinHash) {
+		return nil
+	}
+	if err := session.ForbidImpersonation(ctx); err != nil {
+		return err
+	}
+	if pin == "" {
+		return nil
 	}
 
-	data, err := dto.DecodeFromXToX[map[string]any](updatedUserTrustedMetadata, true)
+	hashed, err := dto.HashPin(pin)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	data["pin_hash"] = hashed
+	return nil
+}
 
-	// update the user personal datas
-	_, err = u.client.Users.Update(ctx, &users.UpdateParams{
-		UserID: userID,
-		Name: &users.Name{
-			FirstName:  param.Name.FirstName,
-			MiddleName: param.Name.MiddleName,
-			LastName:   param.Name.LastName,
-		},
-		TrustedMetadata: *data,
-	})
+// str reads a string metadata value, which may still be a pointer.
+func str(v any) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case *string:
+		return deref(x)
+	}
+	return ""
+}
+
+// authorizeRoleChange requires a registered role and a role admin in ctx,
+// by rbac.Default when no registry was given.
+func (u *UserService) authorizeRoleChange(ctx context.Context, role *string) error {
+	if role == nil {
+		return nil
+	}
+
+	roles := u.roles
+	if roles == nil {
+		roles = rbac.Default
+	}
+
+	if err := roles.Validate(*role); err != nil {
+		return err
+	}
 
-	return user, dto.HandleError(err)
+	actor, _ := session.FromContext(ctx)
+	return roles.Require(actor, rbac.PermRoleAdmin)
 }
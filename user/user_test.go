@@ -3,6 +3,8 @@ package user
 import (
 	"context"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/otyang/go-authsvc/dto"
@@ -25,6 +27,22 @@ func setUpClient() *stytchapi.API {
 	return client
 }
 
+// fakeStytch serves the Stytch API with h, which answers in JSON.
+func fakeStytch(t *testing.T, h http.HandlerFunc) *stytchapi.API {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		h(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := stytchapi.NewClient(stytchProjectID, stytchSecret,
+		stytchapi.WithBaseURI(srv.URL), stytchapi.WithSkipJWKSInitialization())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
 func TestUserService_Get(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,230 @@
+// Package useragent reads the device type, browser and OS out of a
+// User-Agent header, so sessions can be listed as "Chrome on macOS" without
+// trusting what the client says about itself.
+package useragent
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/otyang/go-authsvc/dto"
+)
+
+// Agent is what a User-Agent says about the device. Unknown parts are empty.
+type Agent struct {
+	DeviceType     string // one of the dto.DeviceType* constants
+	Browser        string // for an app, the app's product name
+	BrowserVersion string
+	OS             string
+	OSVersion      string
+}
+
+// Parser classifies user agents. Its zero value is ready to use.
+type Parser struct {
+	appNames []string
+}
+
+// NewParser returns a parser that also treats agents naming one of
+// appNames, such as the product token of the company's own mobile app, as
+// DeviceTypeApp even when they look like a browser.
+func NewParser(appNames ...string) *Parser {
+	return &Parser{appNames: appNames}
+}
+
+// Parse classifies ua with the default parser.
+func Parse(ua string) Agent {
+	return (&Parser{}).Parse(ua)
+}
+
+var botMarkers = []string{
+	"crawler", "spider", "slurp", "headlesschrome", "lighthouse",
+	"curl/", "wget/", "python-requests", "go-http-client", "java/", "httpclient",
+}
+
+// botToken matches "bot" as a word or ending a product name, as in
+// "Googlebot/2.1" or "DuckDuckBot-Https", but not inside device models
+// such as "CUBOT_X30".
+var botToken = regexp.MustCompile(`\bbot\b|[a-z]bot[/-]`)
+
+// tokens seen in the user agents of HTTP clients inside native apps
+var appMarkers = []string{"okhttp", "cfnetwork", "dalvik", "dart", "alamofire", "expo", "reactnative"}
+
+func (p *Parser) Parse(ua string) Agent {
+	ua = strings.TrimSpace(ua)
+	if ua == "" {
+		return Agent{}
+	}
+
+	var (
+		a     = Agent{}
+		lower = strings.ToLower(ua)
+	)
+
+	a.OS, a.OSVersion = parseOS(ua)
+
+	switch {
+	case containsAny(lower, botMarkers) || botToken.MatchString(lower):
+		a.DeviceType = dto.DeviceTypeBot
+		a.Browser, a.BrowserVersion = botName(ua)
+		return a
+	case p.isApp(ua, lower):
+		a.DeviceType = dto.DeviceTypeApp
+		a.Browser, a.BrowserVersion = product(ua)
+		if a.OS == "" {
+			a.OS = appOS(lower)
+		}
+		return a
+	}
+
+	a.Browser, a.BrowserVersion = parseBrowser(ua)
+
+	switch {
+	case strings.Contains(ua, "iPad") || strings.Contains(lower, "tablet") ||
+		(strings.Contains(ua, "Android") && !strings.Contains(ua, "Mobile")):
+		a.DeviceType = dto.DeviceTypeTablet
+	case strings.Contains(ua, "Mobi") || strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPod"):
+		a.DeviceType = dto.DeviceTypeMobile
+	default:
+		a.DeviceType = dto.DeviceTypeDesktop
+	}
+
+	return a
+}
+
+// isApp reports agents that are not browsers: anything not claiming to be
+// Mozilla compatible, known native HTTP clients and the configured apps.
+func (p *Parser) isApp(ua, lower string) bool {
+	for _, name := range p.appNames {
+		if strings.Contains(ua, name) {
+			return true
+		}
+	}
+
+	return !strings.HasPrefix(ua, "Mozilla/") || containsAny(lower, appMarkers)
+}
+
+// EnrichClaims sets the device type, browser and OS claims from
+// c.DeviceUserAgent, replacing what the client reported. Parser satisfies
+// session.ClaimsEnricher.
+func (p *Parser) EnrichClaims(ctx context.Context, c *dto.SessionClaims) {
+	a := p.Parse(c.DeviceUserAgent)
+	if a.DeviceType == "" {
+		return
+	}
+
+	c.DeviceType = a.DeviceType
+	c.Browser, c.BrowserVersion = a.Browser, a.BrowserVersion
+	c.OS, c.OSVersion = a.OS, a.OSVersion
+}
+
+var browsers = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	// order matters: most browsers also claim to be Chrome or Safari
+	{"Edge", regexp.MustCompile(`Edg(?:e|A|iOS)?/([\d.]+)`)},
+	{"Opera", regexp.MustCompile(`(?:OPR|OPiOS|Opera)/([\d.]+)`)},
+	{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/([\d.]+)`)},
+	{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/([\d.]+)`)},
+	{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/([\d.]+)`)},
+	{"Safari", regexp.MustCompile(`Version/([\d.]+).*Safari/`)},
+	{"Internet Explorer", regexp.MustCompile(`(?:MSIE |Trident/.*rv:)([\d.]+)`)},
+}
+
+func parseBrowser(ua string) (string, string) {
+	for _, b := range browsers {
+		if m := b.re.FindStringSubmatch(ua); m != nil {
+			return b.name, m[1]
+		}
+	}
+	return "", ""
+}
+
+var (
+	iosRe     = regexp.MustCompile(`(?:iPhone|CPU) OS ([\d_]+)`)
+	androidRe = regexp.MustCompile(`Android ([\d.]+)`)
+	windowsRe = regexp.MustCompile(`Windows NT ([\d.]+)`)
+	macRe     = regexp.MustCompile(`Mac OS X ([\d_.]+)`)
+	// apps often write e.g. "(iOS 17.1; iPhone15,2)"
+	appOSRe = regexp.MustCompile(`(iOS|iPadOS|Android) ([\d.]+)`)
+)
+
+// windows maps NT kernel versions to release names. Windows 11 still
+// reports 10.0.
+var windows = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+	"6.0":  "Vista",
+	"5.1":  "XP",
+}
+
+func parseOS(ua string) (string, string) {
+	if m := iosRe.FindStringSubmatch(ua); m != nil && (strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad") || strings.Contains(ua, "iPod")) {
+		name := "iOS"
+		if strings.Contains(ua, "iPad") {
+			name = "iPadOS"
+		}
+		return name, strings.ReplaceAll(m[1], "_", ".")
+	}
+	if m := androidRe.FindStringSubmatch(ua); m != nil {
+		return "Android", m[1]
+	}
+	if m := windowsRe.FindStringSubmatch(ua); m != nil {
+		return "Windows", windows[m[1]]
+	}
+	if strings.Contains(ua, "CrOS") {
+		return "ChromeOS", ""
+	}
+	if m := macRe.FindStringSubmatch(ua); m != nil {
+		return "macOS", strings.ReplaceAll(m[1], "_", ".")
+	}
+	if m := appOSRe.FindStringSubmatch(ua); m != nil {
+		return m[1], m[2]
+	}
+	if strings.Contains(ua, "Linux") {
+		return "Linux", ""
+	}
+	return "", ""
+}
+
+// appOS guesses the platform of a native HTTP client that does not name it.
+func appOS(lower string) string {
+	switch {
+	case strings.Contains(lower, "cfnetwork") || strings.Contains(lower, "darwin"):
+		return "iOS"
+	case strings.Contains(lower, "okhttp") || strings.Contains(lower, "dalvik"):
+		return "Android"
+	}
+	return ""
+}
+
+var botRe = regexp.MustCompile(`(?i)([\w-]*(?:bot|crawler|spider|slurp|headlesschrome|lighthouse))(?:/([\d.]+))?`)
+
+// botName prefers the crawler's own token over the Mozilla prefix most
+// crawlers send, e.g. "Googlebot" and "2.1".
+func botName(ua string) (string, string) {
+	if m := botRe.FindStringSubmatch(ua); m != nil {
+		return m[1], m[2]
+	}
+	return product(ua)
+}
+
+// product returns the first product token, e.g. "MyApp" and "2.3.1" for
+// "MyApp/2.3.1 (iOS 17.1)".
+func product(ua string) (string, string) {
+	tok, _, _ := strings.Cut(ua, " ")
+	name, version, _ := strings.Cut(tok, "/")
+	return name, version
+}
+
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package useragent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/otyang/go-authsvc/dto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name string
+		ua   string
+		want Agent
+	}{
+		{
+			name: "chrome on macOS",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			want: Agent{dto.DeviceTypeDesktop, "Chrome", "120.0.0.0", "macOS", "10.15.7"},
+		},
+		{
+			name: "edge on windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			want: Agent{dto.DeviceTypeDesktop, "Edge", "120.0.2210.91", "Windows", "10"},
+		},
+		{
+			name: "firefox on linux",
+			ua:   "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			want: Agent{dto.DeviceTypeDesktop, "Firefox", "121.0", "Linux", ""},
+		},
+		{
+			name: "safari on iphone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+			want: Agent{dto.DeviceTypeMobile, "Safari", "17.2", "iOS", "17.2"},
+		},
+		{
+			name: "chrome on ipad",
+			ua:   "Mozilla/5.0 (iPad; CPU OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1",
+			want: Agent{dto.DeviceTypeTablet, "Chrome", "120.0.6099.119", "iPadOS", "17.2"},
+		},
+		{
+			name: "samsung internet on android phone",
+			ua:   "Mozilla/5.0 (Linux; Android 13; SM-S901B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Mobile Safari/537.36",
+			want: Agent{dto.DeviceTypeMobile, "Samsung Internet", "23.0", "Android", "13"},
+		},
+		{
+			name: "android tablet",
+			ua:   "Mozilla/5.0 (Linux; Android 12; SM-X200) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			want: Agent{dto.DeviceTypeTablet, "Chrome", "120.0.0.0", "Android", "12"},
+		},
+		{
+			name: "googlebot",
+			ua:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: Agent{dto.DeviceTypeBot, "Googlebot", "2.1", "", ""},
+		},
+		{
+			name: "bingbot",
+			ua:   "Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)",
+			want: Agent{dto.DeviceTypeBot, "bingbot", "2.0", "", ""},
+		},
+		{
+			name: "duckduckbot",
+			ua:   "DuckDuckBot-Https/1.1; (+https://duckduckgo.com/duckduckbot)",
+			want: Agent{dto.DeviceTypeBot, "DuckDuckBot", "", "", ""},
+		},
+		{
+			name: "cubot phone is not a bot",
+			ua:   "Mozilla/5.0 (Linux; Android 10; CUBOT_X30) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+			want: Agent{dto.DeviceTypeMobile, "Chrome", "120.0.0.0", "Android", "10"},
+		},
+		{
+			name: "cubot model with space is not a bot",
+			ua:   "Mozilla/5.0 (Linux; Android 9; CUBOT KINGKONG 5 Pro) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Mobile Safari/537.36",
+			want: Agent{dto.DeviceTypeMobile, "Chrome", "119.0.0.0", "Android", "9"},
+		},
+		{
+			name: "curl",
+			ua:   "curl/8.4.0",
+			want: Agent{dto.DeviceTypeBot, "curl", "8.4.0", "", ""},
+		},
+		{
+			name: "native ios app",
+			ua:   "Wallet/3.2.1 CFNetwork/1474 Darwin/23.0.0",
+			want: Agent{dto.DeviceTypeApp, "Wallet", "3.2.1", "iOS", ""},
+		},
+		{
+			name: "native android app",
+			ua:   "okhttp/4.12.0",
+			want: Agent{dto.DeviceTypeApp, "okhttp", "4.12.0", "Android", ""},
+		},
+		{
+			name: "app naming its platform",
+			ua:   "Wallet/3.2.1 (Android 14; Pixel 8)",
+			want: Agent{dto.DeviceTypeApp, "Wallet", "3.2.1", "Android", "14"},
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Parse(tc.ua))
+		})
+	}
+}
+
+func TestParser_AppNames(t *testing.T) {
+	// an app's web view looks like a browser apart from its own token
+	ua := "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 Wallet/3.2.1"
+
+	assert.Equal(t, dto.DeviceTypeMobile, Parse(ua).DeviceType)
+	assert.Equal(t, dto.DeviceTypeApp, NewParser("Wallet/").Parse(ua).DeviceType)
+}
+
+func TestParser_EnrichClaims(t *testing.T) {
+	c := dto.SessionClaims{
+		DeviceUserAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		DeviceType:      "mobile",
+	}
+	NewParser().EnrichClaims(context.TODO(), &c)
+
+	assert.Equal(t, dto.DeviceTypeDesktop, c.DeviceType, "the client's own claim is replaced")
+	assert.Equal(t, "Chrome on macOS", c.DeviceName())
+
+	c = dto.SessionClaims{DeviceType: "mobile"}
+	NewParser().EnrichClaims(context.TODO(), &c)
+	assert.Equal(t, "mobile", c.DeviceType, "kept without a user agent")
+}